@@ -28,6 +28,54 @@ func GetConfig() {
 	viper.SetDefault("redis.port", "6379")
 	viper.SetDefault("jwtKey", "EL PSY KONGROO")
 	viper.SetDefault("jwtRefreshKey", "Steins Gate")
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.host", "smtp.qq.com")
+	viper.SetDefault("mail.port", "587")
+	viper.SetDefault("mail.from", "")
+	viper.SetDefault("mail.linkBase", "http://localhost:8080")
+	viper.SetDefault("moderation.hideThreshold", 5)
+	viper.SetDefault("moderation.newAccountDays", 3)
+	viper.SetDefault("moderation.minApprovedPosts", 1)
+	viper.SetDefault("export.dir", "./exports")
+	viper.SetDefault("export.ttlHours", 24)
+	viper.SetDefault("export.staleMinutes", 30)
+	viper.SetDefault("hot.likeWeight", 1.5)
+	viper.SetDefault("hot.commentWeight", 1.0)
+	viper.SetDefault("hot.viewWeight", 0.1)
+	viper.SetDefault("hot.gravity", 1.8)
+	viper.SetDefault("hot.size", 500)
+	viper.SetDefault("feed.bigVFollowers", 5000)
+	viper.SetDefault("search.engine", "mysql")
+	viper.SetDefault("search.hotDecay", 0.9)
+	viper.SetDefault("ai.provider", "openai")
+	viper.SetDefault("ai.url", "https://open.bigmodel.cn/api/paas/v4/chat/completions")
+	viper.SetDefault("ai.key", "")
+	viper.SetDefault("ai.model", "glm-4.7-flash")
+	viper.SetDefault("ai.thinking", "enabled")
+	viper.SetDefault("ai.temperature", 1.2)
+	viper.SetDefault("ai.timeout", 120)
+	viper.SetDefault("ai.retries", 2)
+	viper.SetDefault("ai.backoffMs", 500)
+	viper.SetDefault("ai.fakeReply", "这是一段测试用的总结喵~")
+	viper.SetDefault("ai.summaryPrompt", "你是一个文章总结员，你的任务是将文章内容进行总结概括，遇到图片地址选择忽略，回复语言要求俏皮可爱，且带有些许傲娇，但概括内容不能有偏差，可以带颜文字和小表情")
+	viper.SetDefault("ai.pricing.input", 0.0)
+	viper.SetDefault("ai.pricing.output", 0.0)
+	viper.SetDefault("ai.quota.trial.daily", 1)
+	viper.SetDefault("ai.quota.trial.monthly", 3)
+	viper.SetDefault("ai.quota.vip.daily", 20)
+	viper.SetDefault("ai.quota.vip.monthly", 300)
+	viper.SetDefault("ai.quota.admin.daily", -1)
+	viper.SetDefault("ai.quota.admin.monthly", -1)
+	viper.SetDefault("embedding.provider", "hash")
+	viper.SetDefault("embedding.dim", 256)
+	viper.SetDefault("embedding.timeout", 30)
+	viper.SetDefault("embedding.minScore", 0.1)
+	viper.SetDefault("recommend.hotWeight", 1.0)
+	viper.SetDefault("recommend.followWeight", 1.5)
+	viper.SetDefault("recommend.similarWeight", 2.0)
+	viper.SetDefault("recommend.poolSize", 200)
+	viper.SetDefault("creator.followerWeight", 0.5)
+	viper.SetDefault("creator.size", 100)
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
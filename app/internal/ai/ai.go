@@ -1,107 +1,65 @@
 package ai
 
 import (
-	"bufio"
-	"bytes"
-	"commmunity/app/zlog"
-	"encoding/json"
-	"net/http"
-	"strings"
+	"context"
 	"time"
 
-	"go.uber.org/zap"
+	"github.com/spf13/viper"
 )
 
-const (
-	APIKEY = "43f29e6afa964c199fbde7a6d7b57794.768b8xPe3IMpGUB7"     //viper.GetString("api.key")
-	APIURL = "https://open.bigmodel.cn/api/paas/v4/chat/completions" //viper.GetString("api.url")
-	MODEL  = "glm-4.7-flash"                                         //viper.GetString("api.model")
-)
-
-type ChatRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	Temperature float64   `json:"temperature"`
-	Thinking    struct {
-		Type string `json:"type,omitempty"`
-	} `json:"thinking,omitempty"`
-}
-
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
-func AutoSummary(content string) (string, error) {
-	requestData := ChatRequest{
-		Model: MODEL,
+type Request struct {
+	Messages    []Message
+	Temperature float64
+}
+
+// Usage 上游没返回用量时按字数估算，Estimated为true
+type Usage struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	Estimated        bool `json:"-"`
+}
+
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+	Latency time.Duration // 包括重试在内的总耗时
+}
+
+// LLMProvider 大模型接口，Stream每收到一段就回调onDelta，结束后返回完整内容和用量
+type LLMProvider interface {
+	Name() string
+	Stream(ctx context.Context, req Request, onDelta func(delta string)) (Response, error)
+}
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+// NewProvider ai.provider配置为fake时不调外部接口，开发和测试用
+func NewProvider() LLMProvider {
+	if viper.GetString("ai.provider") == ProviderFake {
+		return &FakeProvider{Reply: viper.GetString("ai.fakeReply")}
+	}
+	return NewOpenAIProvider()
+}
+
+// AutoSummary 总结文章，人设提示词在ai.summaryPrompt里配置；onDelta可以为nil
+func AutoSummary(ctx context.Context, provider LLMProvider, content string, onDelta func(delta string)) (Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(viper.GetInt("ai.timeout"))*time.Second)
+	defer cancel()
+	req := Request{
 		Messages: []Message{
-			{
-				Role:    "system",
-				Content: "你是一个文章总结员，你的任务是将文章内容进行总结概括，遇到图片地址选择忽略，回复语言要求俏皮可爱，且带有些许傲娇，但概括内容不能有偏差，可以带颜文字和小表情",
-			},
-			{
-				Role:    "user",
-				Content: content,
-			},
+			{Role: "system", Content: viper.GetString("ai.summaryPrompt")},
+			{Role: "user", Content: content},
 		},
-		Stream:      true,
-		Temperature: 1.2,
-		Thinking: struct {
-			Type string `json:"type,omitempty"`
-		}{Type: "enabled"},
-	}
-	jsonData, err := json.Marshal(requestData)
-	if err != nil {
-		zlog.Error("JSON 编码失败", zap.Error(err))
-		return "", err
-	}
-	req, err := http.NewRequest("POST", APIURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		zlog.Error("创建请求失败", zap.Error(err))
-		return "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+APIKEY)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 2 * time.Minute}
-	resp, err := client.Do(req)
-	if err != nil {
-		zlog.Error("网络请求失败", zap.Error(err))
-		return "", err
-	}
-	defer resp.Body.Close()
-	reader := bufio.NewReader(resp.Body)
-	var finalContent string
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			break
-		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if !strings.HasPrefix(line, "data: ") {
-			continue
-		}
-		data := strings.TrimPrefix(line, "data: ")
-		if data == "[DONE]" {
-			break
-		}
-		var chunk struct {
-			Choices []struct {
-				Delta struct {
-					Content string `json:"content"`
-				} `json:"delta"`
-			} `json:"choices"`
-		}
-		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-			continue
-		}
-		if len(chunk.Choices) > 0 {
-			finalContent += chunk.Choices[0].Delta.Content
-		}
+		Temperature: viper.GetFloat64("ai.temperature"),
 	}
-	return finalContent, nil
+	return Call(ctx, provider, req, onDelta)
 }
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeProvider 不调外部接口，把Reply按字逐个吐出来；Err不为空时直接返回错误
+type FakeProvider struct {
+	Reply string
+	Err   error
+	lock  sync.Mutex
+	calls []Request
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *FakeProvider) Stream(ctx context.Context, req Request, onDelta func(delta string)) (Response, error) {
+	p.lock.Lock()
+	p.calls = append(p.calls, req)
+	p.lock.Unlock()
+	if p.Err != nil {
+		return Response{}, p.Err
+	}
+	for _, r := range p.Reply {
+		if ctx.Err() != nil {
+			return Response{}, ctx.Err()
+		}
+		if onDelta != nil {
+			onDelta(string(r))
+		}
+	}
+	return Response{Content: p.Reply, Model: ProviderFake, Usage: estimateUsage(req, p.Reply)}, nil
+}
+
+// Calls 收到过的请求，测试里用来检查提示词
+func (p *FakeProvider) Calls() []Request {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Request(nil), p.calls...)
+}
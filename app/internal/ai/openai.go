@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"commmunity/app/zlog"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// OpenAIProvider OpenAI兼容的chat/completions流式接口，智谱、DeepSeek等都能用
+type OpenAIProvider struct {
+	URL      string
+	Key      string
+	Model    string
+	Thinking string // 智谱的深度思考开关，enabled或disabled，为空不传
+	Client   *http.Client
+}
+
+func NewOpenAIProvider() *OpenAIProvider {
+	return &OpenAIProvider{
+		URL:      viper.GetString("ai.url"),
+		Key:      viper.GetString("ai.key"),
+		Model:    viper.GetString("ai.model"),
+		Thinking: viper.GetString("ai.thinking"),
+		Client:   &http.Client{}, // 超时由调用方的ctx控制
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+type chatRequest struct {
+	Model         string    `json:"model"`
+	Messages      []Message `json:"messages"`
+	Stream        bool      `json:"stream"`
+	Temperature   float64   `json:"temperature"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Thinking *struct {
+		Type string `json:"type"`
+	} `json:"thinking,omitempty"`
+}
+
+type chatChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// StatusError 上游返回了非200，429和5xx可以重试
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("AI接口返回%d: %s", e.Code, e.Body)
+}
+
+// ErrIncomplete 连接在[DONE]或finish_reason之前就断了，已经收到的内容不完整
+var ErrIncomplete = errors.New("AI响应没有正常结束")
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request, onDelta func(delta string)) (Response, error) {
+	body := chatRequest{Model: p.Model, Messages: req.Messages, Stream: true, Temperature: req.Temperature}
+	body.StreamOptions.IncludeUsage = true
+	if p.Thinking != "" {
+		body.Thinking = &struct {
+			Type string `json:"type"`
+		}{Type: p.Thinking}
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		zlog.Error("JSON 编码失败", zap.Error(err))
+		return Response{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.URL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		zlog.Error("创建请求失败", zap.Error(err))
+		return Response{}, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.Key)
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		zlog.Error("网络请求失败", zap.Error(err))
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf := make([]byte, 512)
+		n, _ := resp.Body.Read(buf)
+		return Response{}, &StatusError{Code: resp.StatusCode, Body: string(buf[:n])}
+	}
+	result := Response{Model: p.Model}
+	var content strings.Builder
+	var usage *Usage
+	reader := bufio.NewReader(resp.Body)
+	finished := false
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if data == "[DONE]" {
+				finished = true
+				break
+			}
+			var chunk chatChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err == nil {
+				if chunk.Model != "" {
+					result.Model = chunk.Model
+				}
+				if chunk.Usage != nil {
+					usage = chunk.Usage
+				}
+				if len(chunk.Choices) > 0 {
+					if delta := chunk.Choices[0].Delta.Content; delta != "" {
+						content.WriteString(delta)
+						if onDelta != nil {
+							onDelta(delta)
+						}
+					}
+					if chunk.Choices[0].FinishReason != "" {
+						finished = true
+					}
+				}
+			}
+		}
+		if readErr != nil {
+			if ctx.Err() != nil {
+				result.Content = content.String()
+				return result, ctx.Err()
+			}
+			//有的上游发完finish_reason和用量就直接关连接，不发[DONE]
+			if !finished {
+				result.Content = content.String()
+				zlog.Warn("AI响应中途断开", zap.Int("received", content.Len()), zap.Error(readErr))
+				return result, fmt.Errorf("%w: %v", ErrIncomplete, readErr)
+			}
+			break
+		}
+	}
+	result.Content = content.String()
+	if usage != nil {
+		result.Usage = *usage
+	} else {
+		result.Usage = estimateUsage(req, result.Content)
+	}
+	return result, nil
+}
+
+// estimateUsage 中文大致一个字一个token，粗略估算
+func estimateUsage(req Request, content string) Usage {
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += utf8.RuneCountInString(m.Content)
+	}
+	return Usage{PromptTokens: prompt, CompletionTokens: utf8.RuneCountInString(content), Estimated: true}
+}
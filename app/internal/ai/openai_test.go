@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sseServer 按行写出事件，每写一行就flush
+func sseServer(t *testing.T, status int, lines []string) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.Stream || body.Model != "m" {
+			t.Errorf("bad request body: %+v, %v", body, err)
+		}
+		if r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		for _, l := range lines {
+			fmt.Fprint(w, l)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &OpenAIProvider{URL: srv.URL, Key: "k", Model: "m", Client: srv.Client()}
+}
+
+func chunk(content string, finish string) string {
+	return fmt.Sprintf(`data: {"model":"m-1","choices":[{"delta":{"content":%q},"finish_reason":%q}]}`+"\n\n", content, finish)
+}
+
+func TestOpenAIStream(t *testing.T) {
+	usage := `data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3}}` + "\n\n"
+	tests := []struct {
+		name      string
+		status    int
+		lines     []string
+		content   string
+		usage     Usage
+		err       error
+		statusErr int
+	}{
+		{
+			name:    "正常结束",
+			status:  200,
+			lines:   []string{": ping\n\n", chunk("你", ""), chunk("好", "stop"), usage, "data: [DONE]\n\n"},
+			content: "你好",
+			usage:   Usage{PromptTokens: 7, CompletionTokens: 3},
+		},
+		{
+			name:    "有finish_reason但没发[DONE]也算完整",
+			status:  200,
+			lines:   []string{chunk("你", ""), chunk("好", "stop")},
+			content: "你好",
+			usage:   Usage{PromptTokens: 0, CompletionTokens: 2, Estimated: true},
+		},
+		{
+			name:    "中途断开要报错",
+			status:  200,
+			lines:   []string{chunk("你", ""), chunk("好", "")},
+			content: "你好",
+			err:     ErrIncomplete,
+		},
+		{
+			name:    "最后一行没有换行也能读到",
+			status:  200,
+			lines:   []string{chunk("你", ""), "data: [DONE]"},
+			content: "你",
+			usage:   Usage{PromptTokens: 0, CompletionTokens: 1, Estimated: true},
+		},
+		{
+			name:      "非200返回StatusError",
+			status:    429,
+			lines:     []string{"rate limited"},
+			statusErr: 429,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := sseServer(t, tt.status, tt.lines)
+			var deltas []string
+			resp, err := p.Stream(context.Background(), Request{}, func(d string) { deltas = append(deltas, d) })
+			if tt.statusErr != 0 {
+				var se *StatusError
+				if !errors.As(err, &se) || se.Code != tt.statusErr || !strings.Contains(se.Body, "rate limited") {
+					t.Fatalf("err = %v, want StatusError %d", err, tt.statusErr)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if resp.Content != tt.content || strings.Join(deltas, "") != tt.content {
+				t.Errorf("content = %q, deltas = %v, want %q", resp.Content, deltas, tt.content)
+			}
+			if tt.err == nil {
+				if resp.Usage != tt.usage {
+					t.Errorf("usage = %+v, want %+v", resp.Usage, tt.usage)
+				}
+				if resp.Model != "m-1" {
+					t.Errorf("model = %q, want m-1", resp.Model)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"commmunity/app/zlog"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == 429 || statusErr.Code >= 500
+	}
+	return true // 网络错误
+}
+
+// Call 失败时按ai.retries重试，间隔从ai.backoffMs开始翻倍；已经输出过内容就不再重试，免得客户端收到重复的片段
+func Call(ctx context.Context, provider LLMProvider, req Request, onDelta func(delta string)) (Response, error) {
+	start := time.Now()
+	attempts := viper.GetInt("ai.retries") + 1
+	backoff := time.Duration(viper.GetInt("ai.backoffMs")) * time.Millisecond
+	for i := 0; ; i++ {
+		started := false
+		resp, err := provider.Stream(ctx, req, func(delta string) {
+			started = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		if err == nil {
+			resp.Latency = time.Since(start)
+			zlog.Info("AI调用完成", zap.String("provider", provider.Name()), zap.String("model", resp.Model),
+				zap.Int("prompt_tokens", resp.Usage.PromptTokens), zap.Int("completion_tokens", resp.Usage.CompletionTokens),
+				zap.Bool("estimated", resp.Usage.Estimated), zap.Duration("latency", resp.Latency))
+			return resp, nil
+		}
+		if started || !retryable(err) || i+1 >= attempts {
+			resp.Latency = time.Since(start)
+			zlog.Error("AI调用失败", zap.String("provider", provider.Name()), zap.Int("attempt", i+1), zap.Error(err))
+			return resp, err
+		}
+		zlog.Warn("AI调用失败，准备重试", zap.String("provider", provider.Name()), zap.Int("attempt", i+1), zap.Error(err))
+		select {
+		case <-time.After(backoff << i):
+		case <-ctx.Done():
+			return Response{Latency: time.Since(start)}, ctx.Err()
+		}
+	}
+}
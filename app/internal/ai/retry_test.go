@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	old := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, old) })
+}
+
+// attempt 每次调用的表现：先吐出deltas，再返回err
+type attempt struct {
+	deltas []string
+	err    error
+}
+
+type scriptProvider struct {
+	lock     sync.Mutex
+	attempts []attempt
+	calls    int
+}
+
+func (p *scriptProvider) Name() string {
+	return "script"
+}
+
+func (p *scriptProvider) Stream(ctx context.Context, req Request, onDelta func(delta string)) (Response, error) {
+	p.lock.Lock()
+	a := p.attempts[min(p.calls, len(p.attempts)-1)]
+	p.calls++
+	p.lock.Unlock()
+	var content string
+	for _, d := range a.deltas {
+		content += d
+		onDelta(d)
+	}
+	if a.err != nil {
+		return Response{Content: content}, a.err
+	}
+	return Response{Content: content, Model: "script"}, nil
+}
+
+func (p *scriptProvider) Calls() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.calls
+}
+
+func TestCallRetry(t *testing.T) {
+	setConfig(t, "ai.retries", 2)
+	setConfig(t, "ai.backoffMs", 1)
+	tests := []struct {
+		name     string
+		attempts []attempt
+		calls    int
+		content  string
+		wantErr  bool
+	}{
+		{
+			name:     "429后重试成功",
+			attempts: []attempt{{err: &StatusError{Code: 429}}, {deltas: []string{"好"}}},
+			calls:    2,
+			content:  "好",
+		},
+		{
+			name:     "5xx重试到次数用完",
+			attempts: []attempt{{err: &StatusError{Code: 502}}},
+			calls:    3,
+			wantErr:  true,
+		},
+		{
+			name:     "网络错误也重试",
+			attempts: []attempt{{err: errors.New("connection reset")}, {deltas: []string{"a", "b"}}},
+			calls:    2,
+			content:  "ab",
+		},
+		{
+			name:     "4xx不重试",
+			attempts: []attempt{{err: &StatusError{Code: 400}}, {deltas: []string{"x"}}},
+			calls:    1,
+			wantErr:  true,
+		},
+		{
+			name:     "已经输出过内容就不再重试",
+			attempts: []attempt{{deltas: []string{"半"}, err: ErrIncomplete}, {deltas: []string{"完整"}}},
+			calls:    1,
+			content:  "半",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &scriptProvider{attempts: tt.attempts}
+			var got string
+			resp, err := Call(context.Background(), p, Request{}, func(delta string) { got += delta })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if p.Calls() != tt.calls {
+				t.Errorf("calls = %d, want %d", p.Calls(), tt.calls)
+			}
+			if got != tt.content || resp.Content != tt.content {
+				t.Errorf("deltas = %q, content = %q, want %q", got, resp.Content, tt.content)
+			}
+		})
+	}
+}
+
+func TestCallBackoffCancel(t *testing.T) {
+	setConfig(t, "ai.retries", 3)
+	setConfig(t, "ai.backoffMs", 60000)
+	p := &scriptProvider{attempts: []attempt{{err: &StatusError{Code: 503}}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := Call(ctx, p, Request{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("取消后还在等退避")
+	}
+	if p.Calls() != 1 {
+		t.Errorf("calls = %d, want 1", p.Calls())
+	}
+}
+
+func TestAutoSummaryPrompt(t *testing.T) {
+	setConfig(t, "ai.summaryPrompt", "你是总结助手")
+	setConfig(t, "ai.temperature", 0.3)
+	setConfig(t, "ai.timeout", 5)
+	p := &FakeProvider{Reply: "总结"}
+	resp, err := AutoSummary(context.Background(), p, "正文", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "总结" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	calls := p.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+	want := []Message{{Role: "system", Content: "你是总结助手"}, {Role: "user", Content: "正文"}}
+	if len(calls[0].Messages) != 2 || calls[0].Messages[0] != want[0] || calls[0].Messages[1] != want[1] || calls[0].Temperature != 0.3 {
+		t.Errorf("request = %+v", calls[0])
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/meter"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAIQuota 我的AI剩余次数
+func GetAIQuota(c *gin.Context) {
+	quota, err := meter.RemainingOf(c.GetString("account"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, quota)
+}
+
+// GetAIUsageReport 解析筛选条件：group（user、feature、day）、user、feature、from、to（2006-01-02，包含当天）
+func GetAIUsageReport(c *gin.Context) {
+	query := model.UsageQuery{GroupBy: c.DefaultQuery("group", model.UsageByUser), Feature: c.Query("feature")}
+	if query.GroupBy != model.UsageByUser && query.GroupBy != model.UsageByFeature && query.GroupBy != model.UsageByDay {
+		response.FailWithMessage(c, "group只能是user、feature或day")
+		return
+	}
+	if user := c.Query("user"); user != "" {
+		i, err := strconv.ParseUint(user, 10, 64)
+		if err != nil {
+			response.FailWithMessage(c, "用户ID格式不对")
+			return
+		}
+		query.UserID = uint(i)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "开始日期格式不对")
+			return
+		}
+		query.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "结束日期格式不对")
+			return
+		}
+		t = t.AddDate(0, 0, 1)
+		query.To = &t
+	}
+	stats, err := meter.Report(query)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, stats)
+}
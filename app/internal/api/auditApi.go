@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/audit"
+	"commmunity/app/zlog"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// auditQuery 解析筛选条件：actor、action、from、to（2006-01-02 15:04:05）
+func auditQuery(c *gin.Context) (model.AuditQuery, bool) {
+	var query model.AuditQuery
+	if actor := c.Query("actor"); actor != "" {
+		i, err := strconv.ParseUint(actor, 10, 64)
+		if err != nil {
+			response.FailWithMessage(c, "操作人ID格式不对")
+			return query, false
+		}
+		query.ActorID = uint(i)
+	}
+	query.Action = c.Query("action")
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", from, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "开始时间格式不对")
+			return query, false
+		}
+		query.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", to, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "结束时间格式不对")
+			return query, false
+		}
+		query.To = &t
+	}
+	return query, true
+}
+
+func GetAuditLogs(c *gin.Context) {
+	query, ok := auditQuery(c)
+	if !ok {
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	pageSize := 20
+	offset := (page - 1) * pageSize
+	role := c.MustGet("role").(int)
+	logs, flag, err := audit.GetLogs(role, query, offset, pageSize)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	response.OkWithData(c, logs)
+}
+
+func ExportAuditLogs(c *gin.Context) {
+	query, ok := auditQuery(c)
+	if !ok {
+		return
+	}
+	role := c.MustGet("role").(int)
+	// 先整个写进缓冲区，响应开始后就改不了状态码，中途出错只会得到一份截断的CSV
+	var buf bytes.Buffer
+	flag, err := audit.Export(role, query, &buf)
+	if err != nil {
+		zlog.Error("导出审计日志中断", zap.Error(err))
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_%s.csv", time.Now().Format("20060102150405")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
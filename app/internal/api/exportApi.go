@@ -0,0 +1,61 @@
+package api
+
+import (
+	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/takeout"
+	"commmunity/app/zlog"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RequestExport(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	flag, err := takeout.RequestExport(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "已有导出任务正在进行，请耐心等待")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetExport(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	job, err := takeout.GetLatest(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, job)
+}
+
+func DownloadExport(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	path, flag, err := takeout.DownloadPath(uint(i), expires, c.Query("sig"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		c.Status(http.StatusForbidden)
+		response.FailWithMessage(c, "下载链接无效或已过期")
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("takeout_%d.zip", i))
+}
@@ -3,10 +3,14 @@ package api
 import (
 	"commmunity/app/internal/model"
 	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/audit"
 	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/filter"
 	"commmunity/app/internal/service/login"
-	"commmunity/app/utils"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/service/sanction"
 	"commmunity/app/zlog"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -26,7 +30,11 @@ func Register(c *gin.Context) {
 		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
 		return
 	}
-	err, flag1, flag2 := login.Register(user.Account, user.Password, user.Name)
+	err, flag1, flag2 := login.Register(user.Account, user.Password, user.Name, user.Email)
+	if errors.Is(err, filter.ErrBlocked) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -49,7 +57,16 @@ func Login(c *gin.Context) {
 		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
 		return
 	}
-	err, flag1, flag2 := login.Login(user.Account, user.Password)
+	ttl, err := login.LoginLockTTL(user.Account, c.ClientIP())
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if ttl > 0 {
+		response.FailWithMessage(c, fmt.Sprintf("尝试次数过多，请%d秒后再试", int(ttl.Seconds())+1))
+		return
+	}
+	err, flag1, flag2 := login.Login(user.Account, user.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -62,16 +79,49 @@ func Login(c *gin.Context) {
 		response.FailWithCode(c, response.ERROR_USER_NOT_EXIST_OR_PASSWORD_WRONG, response.GetMsg(response.ERROR_USER_NOT_EXIST_OR_PASSWORD_WRONG))
 		return
 	}
-	role, userId, err := login.GetUserRole(user.Account)
+	mfaToken, mfaRequired, err := login.BeginMfa(user.Account)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	token, refreshToken, err := utils.MakeToken(user.Account, userId, role)
+	if mfaRequired {
+		response.OkWithData(c, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+		return
+	}
+	token, refreshToken, err := login.CreateSession(user.Account, c.ClientIP(), c.Request.UserAgent(), c.GetHeader("X-Device"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	setRefreshCookie(c, refreshToken)
+	response.OkWithData(c, gin.H{"token": token})
+}
+
+func LoginMfa(c *gin.Context) {
+	var req model.TotpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	token, refreshToken, ttl, err, flag := login.CompleteMfa(req.MfaToken, req.Code, c.ClientIP(), c.Request.UserAgent(), c.GetHeader("X-Device"))
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
+	if ttl > 0 {
+		response.FailWithMessage(c, fmt.Sprintf("尝试次数过多，请%d秒后再试", int(ttl.Seconds())+1))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "验证码错误或登录已超时")
+		return
+	}
+	setRefreshCookie(c, refreshToken)
+	response.OkWithData(c, gin.H{"token": token})
+}
+
+func setRefreshCookie(c *gin.Context, refreshToken string) {
 	c.SetSameSite(http.SameSiteStrictMode) //防csrf
 	c.SetCookie(
 		"refresh_token",
@@ -82,7 +132,6 @@ func Login(c *gin.Context) {
 		false, // Secure: 本地开发 false (HTTP)，上线必须 true (HTTPS)
 		true,
 	)
-	response.OkWithData(c, gin.H{"token": token})
 }
 
 func GetProfile(c *gin.Context) {
@@ -131,12 +180,51 @@ func Logout(c *gin.Context) {
 }
 
 func DeleteUser(c *gin.Context) {
+	var req model.DeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
 	account := c.GetString("account")
-	err := login.DeleteUser(account)
+	sessionId := c.MustGet("sessionId").(uint)
+	deletionAt, err, flag := login.RequestDeletion(account, req.Password, req.Code, sessionId)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
+	if !flag {
+		response.FailWithMessage(c, "身份验证失败，请输入密码；第三方登录的账号请输入两步验证码，或重新登录后10分钟内再申请")
+		return
+	}
+	response.OkWithData(c, gin.H{"deletion_at": deletionAt.Format("2006-01-02 15:04:05")})
+}
+
+func GetDeletion(c *gin.Context) {
+	account := c.GetString("account")
+	deletionAt, err := login.GetDeletion(account)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if deletionAt == nil {
+		response.OkWithData(c, gin.H{"deletion_at": ""})
+		return
+	}
+	response.OkWithData(c, gin.H{"deletion_at": deletionAt.Format("2006-01-02 15:04:05")})
+}
+
+func CancelDeletion(c *gin.Context) {
+	account := c.GetString("account")
+	err, flag := login.CancelDeletion(account)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "没有待处理的注销申请")
+		return
+	}
 	response.Ok(c)
 }
 
@@ -148,7 +236,8 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 	user.Account = c.GetString("account")
-	err, flag1, flag2 := login.ChangePassword(user.Account, user.FirstPassWord, user.SecondPassWord)
+	userId := c.MustGet("userId").(uint)
+	err, flag1, flag2 := login.ChangePassword(user.Account, userId, user.FirstPassWord, user.SecondPassWord)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -174,6 +263,10 @@ func ChangeUserName(c *gin.Context) {
 	user.Account = c.GetString("account")
 	userId := c.MustGet("userId").(uint)
 	err, flag1 := login.ChangeName(user.Account, user.Name, userId)
+	if errors.Is(err, filter.ErrBlocked) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -227,6 +320,10 @@ func ChangeIntroduction(c *gin.Context) {
 	user.Account = c.GetString("account")
 	userId := c.MustGet("userId").(uint)
 	err := login.ChangeIntroduction(user.Account, user.Introduction, userId)
+	if errors.Is(err, filter.ErrBlocked) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -242,13 +339,19 @@ func Muted(c *gin.Context) {
 		return
 	}
 	role := c.MustGet("role").(int)
+	operatorId := c.MustGet("userId").(uint)
 	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
 	if err != nil {
 		zlog.Error("转换失败")
 		response.Fail(c)
 	}
 	id := uint(i)
-	err, flag := login.Muted(id, role, user.IsMuted)
+	before, err := sanction.GetActive(id)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	err, flag := sanction.SetMuted(operatorId, role, id, user.IsMuted)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -257,6 +360,8 @@ func Muted(c *gin.Context) {
 		response.FailWithMessage(c, "权限不够")
 		return
 	}
+	after, _ := sanction.GetActive(id)
+	audit.Record(audit.ActorOf(c), model.AuditUserMute, "user", id, before, after)
 	response.Ok(c)
 }
 
@@ -313,15 +418,597 @@ func RefreshToken(c *gin.Context) {
 		response.FailWithMessage(c, "请重新登录")
 		return
 	}
-	claims, err := utils.ParseRefreshToken(refreshToken)
+	if !login.IsTokenValid(refreshToken) {
+		response.FailWithMessage(c, "请重新登录")
+		return
+	}
+	newAccessToken, newRefreshToken, err, flag := login.RefreshSession(refreshToken, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
-		response.FailWithMessage(c, "登录已彻底过期，请重新登录")
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	if !login.IsTokenValid(refreshToken) {
-		response.FailWithMessage(c, "请重新登录")
+	if !flag {
+		response.FailWithMessage(c, "登录已彻底过期，请重新登录")
 		return
 	}
-	newAccessToken, _, err := utils.MakeToken(claims.Account, claims.UserId, claims.Role)
+	setRefreshCookie(c, newRefreshToken)
 	response.OkWithData(c, gin.H{"access_token": newAccessToken})
 }
+
+func GetSessions(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	sessionId := c.MustGet("sessionId").(uint)
+	sessions, err := login.GetSessions(userId, sessionId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, sessions)
+}
+
+func DeleteSession(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	err, flag := login.DeleteSession(userId, uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "未找到该会话")
+		return
+	}
+	response.Ok(c)
+}
+
+func LogoutEverywhere(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	err := login.LogoutEverywhere(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	c.SetCookie(
+		"refresh_token",
+		"",
+		-1,
+		"/",
+		"localhost",
+		false,
+		true,
+	)
+	response.Ok(c)
+}
+
+func BindEmail(c *gin.Context) {
+	var req model.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	err, flag := login.BindEmail(userId, req.Email)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "邮箱格式不对或已被使用")
+		return
+	}
+	response.Ok(c)
+}
+
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	err, flag := login.VerifyEmail(token)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "验证链接无效或已过期")
+		return
+	}
+	response.Ok(c)
+}
+
+func RequestPasswordReset(c *gin.Context) {
+	var req model.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	err := login.RequestPasswordReset(req.Email)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.Ok(c)
+}
+
+func ResetPassword(c *gin.Context) {
+	var req model.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	err, flag := login.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "重置链接无效或已过期")
+		return
+	}
+	response.Ok(c)
+}
+
+func UnlockLogin(c *gin.Context) {
+	var req model.UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	if req.Account == "" && req.IP == "" {
+		response.FailWithMessage(c, "请填写要解锁的账号或IP")
+		return
+	}
+	role := c.MustGet("role").(int)
+	ttl, err := login.LoginLockTTL(req.Account, req.IP)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	err, flag := login.UnlockLogin(role, c.GetString("account"), req.Account, req.IP)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditLoginUnlock, "account", 0,
+		gin.H{"account": req.Account, "ip": req.IP, "locked_seconds": int(ttl.Seconds())},
+		gin.H{"account": req.Account, "ip": req.IP, "locked_seconds": 0})
+	response.Ok(c)
+}
+
+func EnrollTotp(c *gin.Context) {
+	account := c.GetString("account")
+	secret, uri, err, flag := login.EnrollTotp(account)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "已开启两步验证，请先关闭")
+		return
+	}
+	response.OkWithData(c, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+func ConfirmTotp(c *gin.Context) {
+	var req model.TotpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	account := c.GetString("account")
+	codes, err, flag := login.ConfirmTotp(account, req.Code)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "验证码错误")
+		return
+	}
+	response.OkWithData(c, gin.H{"recovery_codes": codes})
+}
+
+func DisableTotp(c *gin.Context) {
+	var req model.TotpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	account := c.GetString("account")
+	err, flag := login.DisableTotp(account, req.Code)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "验证码错误")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetRoles(c *gin.Context) {
+	roles, err := rbac.GetRoles()
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, roles)
+}
+
+func SetUserRole(c *gin.Context) {
+	var req model.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := rbac.RoleOf(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	flag1, flag2, err := rbac.AssignRole(role, uint(i), req.Role)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "角色不存在")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditRoleAssign, "user", uint(i), gin.H{"role": before}, gin.H{"role": req.Role})
+	response.Ok(c)
+}
+
+func SetRolePermissions(c *gin.Context) {
+	var req model.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.Atoi(c.Param("Id"))
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := rbac.RolePermissions(i)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	flag1, flag2, err := rbac.SetRolePermissions(role, i, req.Permissions)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "角色或权限不存在")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditRolePermissions, "role", uint(i), gin.H{"permissions": before}, gin.H{"permissions": req.Permissions})
+	response.Ok(c)
+}
+
+func IssueSanction(c *gin.Context) {
+	var req model.SanctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	operatorId := c.MustGet("userId").(uint)
+	before, err := sanction.GetActive(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	err, flag1, flag2 := sanction.Issue(operatorId, role, uint(i), req.Type, req.Reason, time.Duration(req.Duration)*time.Minute)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限，只能处罚角色比自己低的用户")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "用户不存在，或处罚类型、原因、时长不正确")
+		return
+	}
+	after, _ := sanction.GetActive(uint(i))
+	audit.Record(audit.ActorOf(c), model.AuditSanctionIssue, "user", uint(i), before, after)
+	response.Ok(c)
+}
+
+func LiftSanction(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := sanction.Get(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	err, flag := sanction.Lift(role, uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限或处罚不存在")
+		return
+	}
+	after, _ := sanction.Get(uint(i))
+	audit.Record(audit.ActorOf(c), model.AuditSanctionLift, "sanction", uint(i), before, after)
+	response.Ok(c)
+}
+
+func GetMySanctions(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	sanctions, err := sanction.GetActive(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, sanctions)
+}
+
+func AppealSanction(c *gin.Context) {
+	var req model.SanctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	err, flag := sanction.Appeal(userId, uint(i), req.Appeal)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "该处罚无法申诉或已申诉过")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetAppeals(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	pageSize := 10
+	offset := (page - 1) * pageSize
+	appeals, err := sanction.GetPendingAppeals(offset, pageSize)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, appeals)
+}
+
+func ReviewAppeal(c *gin.Context) {
+	var req model.SanctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := sanction.Get(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	err, flag := sanction.ReviewAppeal(role, uint(i), req.Accept)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限或申诉已处理")
+		return
+	}
+	after, _ := sanction.Get(uint(i))
+	audit.Record(audit.ActorOf(c), model.AuditAppealReview, "sanction", uint(i), before, after)
+	response.Ok(c)
+}
+
+func CreateAccessToken(c *gin.Context) {
+	var req model.AccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	plain, token, flag, err := login.CreateAccessToken(userId, req)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "参数有误或令牌数量已达上限")
+		return
+	}
+	response.OkWithData(c, gin.H{"token": plain, "info": token})
+}
+
+func GetAccessTokens(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	tokens, err := login.GetAccessTokens(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, tokens)
+}
+
+func RevokeAccessToken(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	flag, err := login.RevokeAccessToken(userId, uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "未找到该令牌")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetOidcProviders(c *gin.Context) {
+	response.OkWithData(c, login.OidcProviders())
+}
+
+// OidcLogin 浏览器直接跳转到第三方授权页
+func OidcLogin(c *gin.Context) {
+	link, flag, err := login.BeginOidc(c.Param("provider"), 0)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "不支持该登录方式")
+		return
+	}
+	c.Redirect(http.StatusFound, link)
+}
+
+func OidcCallback(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		zlog.Warn("第三方授权被拒绝", zap.String("provider", c.Param("provider")), zap.String("error", e))
+		response.FailWithMessage(c, "第三方授权失败")
+		return
+	}
+	result, err, flag := login.CompleteOidc(c.Param("provider"), c.Query("code"), c.Query("state"), c.ClientIP(), c.Request.UserAgent(), c.GetHeader("X-Device"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "第三方登录失败，链接已过期或该账号已绑定其他用户")
+		return
+	}
+	if result.Linked {
+		response.OkWithData(c, gin.H{"linked": true})
+		return
+	}
+	if result.MfaToken != "" {
+		response.OkWithData(c, gin.H{"mfa_required": true, "mfa_token": result.MfaToken})
+		return
+	}
+	setRefreshCookie(c, result.RefreshToken)
+	response.OkWithData(c, gin.H{"token": result.Token})
+}
+
+// LinkOidc 已登录用户绑定第三方账号，返回授权地址由前端跳转
+func LinkOidc(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	link, flag, err := login.BeginOidc(c.Param("provider"), userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "不支持该登录方式")
+		return
+	}
+	response.OkWithData(c, gin.H{"url": link})
+}
+
+func GetIdentities(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	identities, err := login.GetIdentities(userId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, identities)
+}
+
+func UnlinkOidc(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	err, flag1, flag2 := login.UnlinkOidc(userId, c.Param("provider"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "这是唯一的登录方式，请先设置密码再解绑")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "未绑定该第三方账号")
+		return
+	}
+	response.Ok(c)
+}
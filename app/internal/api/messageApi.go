@@ -1,10 +1,13 @@
 package api
 
 import (
+	"commmunity/app/internal/model"
 	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/audit"
 	"commmunity/app/internal/service/controller"
 	"commmunity/app/zlog"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,36 +21,115 @@ func GetHistoryMessage(c *gin.Context) {
 		return
 	}
 	toUserId := uint(i)
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
-		zlog.Warn("请求出错了")
-		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+	page, ok := pageQuery(c, 10)
+	if !ok {
 		return
 	}
-	pageSize := 10
-	offset := (page - 1) * pageSize
-	messages, err := controller.GetHistoryMessage(formUserId, toUserId, offset, pageSize)
+	messages, next, err := controller.GetHistoryMessage(formUserId, toUserId, page)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
+	if page.Cursor {
+		response.OkWithData(c, gin.H{"list": messages, "next_cursor": next})
+		return
+	}
 	response.OkWithData(c, messages)
 }
 
 func GetNotice(c *gin.Context) {
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	page, ok := pageQuery(c, 10)
+	if !ok {
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	notices, next, err := controller.GetUnreadNotice(userId, page)
 	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if page.Cursor {
+		response.OkWithData(c, gin.H{"list": notices, "next_cursor": next})
+		return
+	}
+	response.OkWithData(c, notices)
+}
+
+func CreateAnnouncement(c *gin.Context) {
+	var req model.AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		zlog.Warn("请求出错了")
 		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
 		return
 	}
-	pageSize := 10
-	offset := (page - 1) * pageSize
+	publishAt := time.Now()
+	if req.PublishAt != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.PublishAt, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "发布时间格式不对")
+			return
+		}
+		publishAt = t
+	}
+	var expireAt *time.Time
+	if req.ExpireAt != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.ExpireAt, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "过期时间格式不对")
+			return
+		}
+		expireAt = &t
+	}
+	role := c.MustGet("role").(int)
 	userId := c.MustGet("userId").(uint)
-	notices, err := controller.GetUnreadNotice(userId, offset, pageSize)
+	err, flag, id := controller.CreateAnnouncement(role, userId, req, publishAt, expireAt)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	response.OkWithData(c, notices)
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if id == 0 {
+		response.FailWithMessage(c, "请完善公告信息")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditAnnouncementPost, "announcement", id, nil, req)
+	response.Ok(c)
+}
+
+func CancelAnnouncement(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err, flag1, flag2 := controller.CancelAnnouncement(role, uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "公告不存在")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditAnnouncementClear, "announcement", uint(i), gin.H{"status": before.Status}, gin.H{"status": model.AnnouncementCancelled})
+	response.Ok(c)
+}
+
+func GetAnnouncements(c *gin.Context) {
+	account := c.GetString("account")
+	announcements, err := controller.GetActiveAnnouncements(account)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, announcements)
 }
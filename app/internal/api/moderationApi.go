@@ -0,0 +1,284 @@
+package api
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/audit"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/moderation"
+	"commmunity/app/zlog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreateReport(c *gin.Context) {
+	var req model.ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	err, flag := moderation.Report(userId, req.TargetType, req.TargetID, req.Reason, req.Detail)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "举报对象不存在或参数有误")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetReportQueue(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	pageSize := 10
+	offset := (page - 1) * pageSize
+	role := c.MustGet("role").(int)
+	groups, flag, err := moderation.GetQueue(role, offset, pageSize)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	response.OkWithData(c, groups)
+}
+
+func reportTarget(c *gin.Context) (int, uint, bool) {
+	targetType, err := strconv.Atoi(c.Param("Type"))
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return 0, 0, false
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return 0, 0, false
+	}
+	return targetType, uint(i), true
+}
+
+func GetReports(c *gin.Context) {
+	targetType, targetId, ok := reportTarget(c)
+	if !ok {
+		return
+	}
+	role := c.MustGet("role").(int)
+	reports, flag, err := moderation.GetReports(role, targetType, targetId)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	response.OkWithData(c, reports)
+}
+
+func HandleReport(c *gin.Context) {
+	var req model.ReportActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	targetType, targetId, ok := reportTarget(c)
+	if !ok {
+		return
+	}
+	account := c.MustGet("account").(string)
+	role := c.MustGet("role").(int)
+	err, flag1, flag2 := moderation.Handle(audit.ActorOf(c), account, role, targetType, targetId, req)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "没有待处理的举报或操作无效")
+		return
+	}
+	response.Ok(c)
+}
+
+func GetSensitiveWords(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	pageSize := 50
+	offset := (page - 1) * pageSize
+	role := c.MustGet("role").(int)
+	words, flag, err := filter.GetWords(role, offset, pageSize)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	response.OkWithData(c, words)
+}
+
+func AddSensitiveWord(c *gin.Context) {
+	var req model.SensitiveWordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	role := c.MustGet("role").(int)
+	word, flag1, flag2, err := filter.AddWord(role, req.Word, req.Action)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "敏感词已存在或参数有误")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditWordAdd, "word", word.ID, nil, gin.H{"word": word.Word, "action": word.Action})
+	response.Ok(c)
+}
+
+func UpdateSensitiveWord(c *gin.Context) {
+	var req model.SensitiveWordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := filter.GetWord(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	flag1, flag2, err := filter.UpdateWord(role, uint(i), req.Action)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "敏感词不存在或参数有误")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditWordUpdate, "word", uint(i),
+		gin.H{"word": before.Word, "action": before.Action}, gin.H{"word": before.Word, "action": req.Action})
+	response.Ok(c)
+}
+
+func DeleteSensitiveWord(c *gin.Context) {
+	i, err := strconv.ParseUint(c.Param("Id"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	before, err := filter.GetWord(uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	flag1, flag2, err := filter.DeleteWord(role, uint(i))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "敏感词不存在")
+		return
+	}
+	audit.Record(audit.ActorOf(c), model.AuditWordDelete, "word", uint(i), gin.H{"word": before.Word, "action": before.Action}, nil)
+	response.Ok(c)
+}
+
+func GetPendingPosts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	pageSize := 10
+	offset := (page - 1) * pageSize
+	role := c.MustGet("role").(int)
+	posts, flag, err := moderation.GetPendingPosts(role, offset, pageSize)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	response.OkWithData(c, posts)
+}
+
+func ReviewPost(c *gin.Context) {
+	var req model.PostReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Warn("请求出错了")
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	postId, err := strconv.ParseUint(c.Param("postId"), 10, 64)
+	if err != nil {
+		zlog.Error("转换失败")
+		response.Fail(c)
+		return
+	}
+	role := c.MustGet("role").(int)
+	err, flag1, flag2 := moderation.ReviewPost(audit.ActorOf(c), role, uint(postId), req.Approve, req.Reason)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !flag1 {
+		response.FailWithMessage(c, "暂无权限")
+		return
+	}
+	if !flag2 {
+		response.FailWithMessage(c, "帖子不存在或已审核")
+		return
+	}
+	response.Ok(c)
+}
@@ -3,13 +3,21 @@ package api
 import (
 	"commmunity/app/internal/model"
 	"commmunity/app/internal/response"
+	"commmunity/app/internal/service/audit"
 	"commmunity/app/internal/service/controller"
 	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/meter"
+	"commmunity/app/internal/service/recommend"
+	"commmunity/app/utils"
 	"commmunity/app/zlog"
+	"errors"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -24,16 +32,20 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 	account := c.GetString("account")
-	err, flag := controller.CreatePost(account, post.Title, post.Content)
+	err, flag, pending := controller.CreatePost(account, post.Title, post.Content)
+	if errors.Is(err, filter.ErrBlocked) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
 	if !flag {
-		response.FailWithMessage(c, "你已被禁言")
+		response.FailWithMessage(c, "你已被禁言或禁止发帖")
 		return
 	}
-	response.Ok(c)
+	response.OkWithData(c, gin.H{"pending_review": pending}) // 新账号的帖子需审核后才公开
 }
 
 func UploadImage(c *gin.Context) {
@@ -66,20 +78,48 @@ func UploadImage(c *gin.Context) {
 	response.OkWithData(c, gin.H{"url": url})
 }
 
-func GetPostList(c *gin.Context) {
+// pageQuery 带了cursor参数（第一页传空串）就走游标分页，否则按page走原来的offset分页
+func pageQuery(c *gin.Context, pageSize int) (model.PageQuery, bool) {
+	query := model.PageQuery{Limit: pageSize}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		query.Cursor = true
+		if cursor == "" {
+			return query, true
+		}
+		t, id, ok := utils.DecodeCursor(cursor)
+		if !ok {
+			response.FailWithMessage(c, "游标格式不对")
+			return query, false
+		}
+		query.CursorTime = t
+		query.CursorID = id
+		return query, true
+	}
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
+	if err != nil || page < 1 {
 		zlog.Warn("请求出错了")
 		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return query, false
+	}
+	query.Offset = (page - 1) * pageSize
+	return query, true
+}
+
+// GetPostList 游标模式返回{list, next_cursor}，next_cursor为空表示没有更多了
+func GetPostList(c *gin.Context) {
+	page, ok := pageQuery(c, 10)
+	if !ok {
 		return
 	}
-	pageSize := 10
-	offset := (page - 1) * pageSize
-	posts, err := controller.GetPostList(offset, pageSize)
+	posts, next, err := controller.GetPostList(page)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
+	if page.Cursor {
+		response.OkWithData(c, gin.H{"list": posts, "next_cursor": next})
+		return
+	}
 	if len(posts) == 0 {
 		response.FailWithMessage(c, "该页没有对应数据")
 		return
@@ -108,6 +148,25 @@ func GetPostDetail(c *gin.Context) {
 	response.OkWithData(c, post)
 }
 
+// GetRelatedPosts 内容相近的帖子
+func GetRelatedPosts(c *gin.Context) {
+	postId, err := strconv.ParseUint(c.Param("postId"), 10, 64)
+	if err != nil {
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	related, found, err := controller.GetRelatedPosts(uint(postId), 10)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	if !found {
+		response.FailWithMessage(c, "未找到该文章")
+		return
+	}
+	response.OkWithData(c, related)
+}
+
 func CreateComment(c *gin.Context) {
 	var comment model.CommentRequest
 	if err := c.ShouldBindJSON(&comment); err != nil {
@@ -123,6 +182,10 @@ func CreateComment(c *gin.Context) {
 	}
 	postIdInt := uint(postId)
 	err, flag := controller.CreateComment(account, postIdInt, comment.Content)
+	if errors.Is(err, filter.ErrBlocked) || errors.Is(err, controller.ErrPostNotFound) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -162,7 +225,7 @@ func DeletePost(c *gin.Context) {
 		response.Fail(c)
 	}
 	postIdInt := uint(postId)
-	err, flag := controller.DeletePost(account, postIdInt, role)
+	err, flag := controller.DeletePost(account, postIdInt, role, audit.ActorOf(c))
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -183,7 +246,7 @@ func DeleteComment(c *gin.Context) {
 	commentIdInt := uint(commentId)
 	account := c.GetString("account")
 	role := c.MustGet("role").(int)
-	err, flag := controller.DeleteComment(account, commentIdInt, role)
+	err, flag := controller.DeleteComment(account, commentIdInt, role, audit.ActorOf(c))
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
@@ -212,68 +275,62 @@ func ToggleLike(c *gin.Context) {
 	response.OkWithData(c, gin.H{"isLike": isLike, "count": count})
 }
 
+// GetFollowingPost 时间线按帖子ID排序，游标里只用到ID部分
 func GetFollowingPost(c *gin.Context) {
-	account := c.GetString("account")
 	userId := c.MustGet("userId").(uint)
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
-		zlog.Warn("请求出错了")
-		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+	page, ok := pageQuery(c, 10)
+	if !ok {
+		return
+	}
+	if !page.Cursor {
+		posts, _, err := feed.GetFollowingPosts(userId, 0, page.Offset, page.Limit)
+		if err != nil {
+			response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+			return
+		}
+		if len(posts) == 0 {
+			response.OkWithData(c, "你的暂时没有关注的对象哦")
+			return
+		}
+		response.OkWithData(c, posts)
 		return
 	}
-	pageSize := 10
-	offset := (page - 1) * pageSize
-	posts, err := feed.GetFollowingPosts(account, userId, offset, pageSize)
+	posts, next, err := feed.GetFollowingPosts(userId, page.CursorID, 0, page.Limit)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	if len(posts) == 0 {
-		response.OkWithData(c, "你的暂时没有关注的对象哦")
-		return
+	nextCursor := ""
+	if next > 0 {
+		nextCursor = utils.EncodeCursor(time.Unix(0, 0), next)
 	}
-	response.OkWithData(c, posts)
+	response.OkWithData(c, gin.H{"list": posts, "next_cursor": nextCursor})
 }
 
-func GetHotRank(c *gin.Context) {
-	var hotPosts []interface{}
-	posts, score, err := controller.GetHotRank()
+// GetRecommendedPosts 每次请求返回新的一批，reason是推荐理由
+func GetRecommendedPosts(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	account := c.MustGet("account").(string)
+	posts, err := recommend.GetRecommended(userId, account, 10)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	for _, post := range posts {
-		if s, ok := score[post.PostID]; ok {
-			hotPosts = append(hotPosts, gin.H{"post": post, "score": s})
-		}
-	}
-	response.OkWithData(c, hotPosts)
+	response.OkWithData(c, posts)
 }
 
-func SearchPosts(c *gin.Context) {
-	keyword := c.Query("keyword")
-	if keyword == "" {
-		response.FailWithMessage(c, "搜索关键词不能为空")
-		return
-	}
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
-		zlog.Warn("请求出错了")
+func GetHotRank(c *gin.Context) {
+	window := c.DefaultQuery("window", hot.WindowWeek)
+	if !hot.ValidWindow(window) {
 		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
 		return
 	}
-	pageSize := 10
-	offset := (page - 1) * pageSize
-	posts, err := controller.SearchPosts(keyword, offset, pageSize)
+	hotPosts, err := controller.GetHotRank(window)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	if len(posts) == 0 {
-		response.OkWithData(c, "暂无相关内容")
-		return
-	}
-	response.OkWithData(c, posts)
+	response.OkWithData(c, hotPosts)
 }
 
 func SetPostPaid(c *gin.Context) {
@@ -284,6 +341,11 @@ func SetPostPaid(c *gin.Context) {
 	}
 	postIdInt := uint(postId)
 	role := c.MustGet("role").(int)
+	before, err := controller.PostPaid(postIdInt)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
 	flag, err := controller.SetPostPaid(role, postIdInt)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
@@ -293,6 +355,7 @@ func SetPostPaid(c *gin.Context) {
 		response.FailWithMessage(c, "你暂无该权限")
 		return
 	}
+	audit.Record(audit.ActorOf(c), model.AuditPostPaid, "post", postIdInt, gin.H{"paid": before}, gin.H{"paid": true})
 	response.Ok(c)
 }
 
@@ -304,6 +367,11 @@ func SetVip(c *gin.Context) {
 	}
 	id := uint(i)
 	role := c.MustGet("role").(int)
+	before, err := controller.IsVip(id)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
 	flag, err := controller.PayVip(role, id)
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
@@ -313,6 +381,7 @@ func SetVip(c *gin.Context) {
 		response.FailWithMessage(c, "暂无权限")
 		return
 	}
+	audit.Record(audit.ActorOf(c), model.AuditVipGrant, "user", id, gin.H{"vip": before}, gin.H{"vip": true})
 	response.Ok(c)
 }
 
@@ -325,14 +394,56 @@ func AiSummary(c *gin.Context) {
 	}
 	postIdInt := uint(postId)
 	account := c.GetString("account")
-	postSummary, err := controller.AiSummary(account, postIdInt)
+	postSummary, quota, err := controller.AiSummary(c.Request.Context(), account, postIdInt)
+	if errors.Is(err, meter.ErrQuotaExceeded) || errors.Is(err, controller.ErrPostNotFound) || errors.Is(err, controller.ErrVipRequired) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	if postSummary == "" {
-		response.FailWithMessage(c, "请解锁会员使用")
+	response.OkWithData(c, gin.H{"postSummary": postSummary, "quota": quota})
+}
+
+// AiSummaryStream 用SSE边生成边推送：先是quota事件，delta事件是增量文本，最后是done或error事件
+func AiSummaryStream(c *gin.Context) {
+	postId, err := strconv.ParseUint(c.Param("postId"), 10, 64)
+	if err != nil {
+		response.FailWithCode(c, response.INVALID_PARAMS, response.GetMsg(response.INVALID_PARAMS))
+		return
+	}
+	watcher, quota, err := controller.WatchSummary(c.GetString("account"), uint(postId))
+	if errors.Is(err, meter.ErrQuotaExceeded) || errors.Is(err, controller.ErrPostNotFound) || errors.Is(err, controller.ErrVipRequired) {
+		response.FailWithMessage(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
 		return
 	}
-	response.OkWithData(c, gin.H{"postSummary": postSummary})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("quota", quota)
+	ctx := c.Request.Context()
+	for {
+		chunks, done, err := watcher.Next(ctx)
+		for _, chunk := range chunks {
+			c.SSEvent("delta", chunk)
+		}
+		if done {
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				c.SSEvent("error", "总结生成失败")
+			} else {
+				c.SSEvent("done", "")
+			}
+			c.Writer.Flush()
+			return
+		}
+		c.Writer.Flush()
+	}
 }
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"commmunity/app/internal/response"
+	"commmunity/app/internal/search"
+	"commmunity/app/internal/service/controller"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchQuery 解析筛选条件：author（用户ID）、from、to（2006-01-02，包含当天）
+func searchQuery(c *gin.Context) (search.Query, bool) {
+	query := search.Query{Keyword: c.Query("keyword")}
+	if query.Keyword == "" {
+		response.FailWithMessage(c, "搜索关键词不能为空")
+		return query, false
+	}
+	query.Type = c.DefaultQuery("type", search.TypePost)
+	if !search.ValidType(query.Type) {
+		response.FailWithMessage(c, "搜索类型只能是post、comment或user")
+		return query, false
+	}
+	query.Mode = c.DefaultQuery("mode", search.ModeKeyword)
+	if query.Mode != search.ModeKeyword && query.Mode != search.ModeSemantic {
+		response.FailWithMessage(c, "搜索方式只能是keyword或semantic")
+		return query, false
+	}
+	if query.Mode == search.ModeSemantic && query.Type != search.TypePost {
+		response.FailWithMessage(c, "语义搜索只支持帖子")
+		return query, false
+	}
+	if author := c.Query("author"); author != "" {
+		i, err := strconv.ParseUint(author, 10, 64)
+		if err != nil {
+			response.FailWithMessage(c, "作者ID格式不对")
+			return query, false
+		}
+		query.AuthorID = uint(i)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "开始日期格式不对")
+			return query, false
+		}
+		query.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			response.FailWithMessage(c, "结束日期格式不对")
+			return query, false
+		}
+		t = t.AddDate(0, 0, 1)
+		query.To = &t
+	}
+	page, ok := pageQuery(c, 10)
+	if !ok {
+		return query, false
+	}
+	query.Page = page
+	return query, true
+}
+
+// SearchPosts 搜索帖子、评论或用户；搜帖子且不带cursor时保持原来的数组格式
+func SearchPosts(c *gin.Context) {
+	query, ok := searchQuery(c)
+	if !ok {
+		return
+	}
+	controller.RecordSearch(c.MustGet("userId").(uint), query)
+	var list interface{}
+	var total int64
+	var next string
+	var err error
+	switch query.Type {
+	case search.TypeComment:
+		list, total, next, err = controller.SearchComments(query)
+	case search.TypeUser:
+		list, total, next, err = controller.SearchUsers(c.MustGet("userId").(uint), query)
+	default:
+		var posts []controller.SearchPostDTO
+		posts, total, next, err = controller.SearchPosts(query)
+		if err == nil && !query.Page.Cursor {
+			if len(posts) == 0 {
+				response.OkWithData(c, "暂无相关内容")
+				return
+			}
+			response.OkWithData(c, posts)
+			return
+		}
+		list = posts
+	}
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, gin.H{"list": list, "total": total, "next_cursor": next})
+}
+
+// Suggest 输入框联想，q为前缀
+func Suggest(c *gin.Context) {
+	suggestions, err := controller.Suggest(c.Query("q"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, suggestions)
+}
+
+func GetHotSearches(c *gin.Context) {
+	hotSearches, err := controller.GetHotSearches()
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, hotSearches)
+}
+
+func GetSearchHistory(c *gin.Context) {
+	history, err := controller.GetSearchHistory(c.MustGet("userId").(uint))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, history)
+}
+
+// ClearSearchHistory 带q时只删除这一条
+func ClearSearchHistory(c *gin.Context) {
+	err := controller.ClearSearchHistory(c.MustGet("userId").(uint), c.Query("q"))
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.Ok(c)
+}
+
+// GetPopularCreators 热门作者，按粉丝数和最近一周的互动排名
+func GetPopularCreators(c *gin.Context) {
+	creators, err := controller.GetPopularCreators(c.MustGet("userId").(uint), 20)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		return
+	}
+	response.OkWithData(c, creators)
+}
@@ -2,6 +2,12 @@ package cron
 
 import (
 	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/service/controller"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/login"
+	"commmunity/app/internal/service/recommend"
+	"commmunity/app/internal/service/sanction"
+	"commmunity/app/internal/service/takeout"
 	"commmunity/app/zlog"
 	"context"
 	"fmt"
@@ -133,24 +139,66 @@ func SyncView(ctx context.Context) {
 }
 
 func RefreshHot(ctx context.Context) {
+	hot.Refresh(ctx)
+}
+
+func PrecomputeRecommend(ctx context.Context) {
+	recommend.Precompute(ctx)
+}
+
+func RefreshCreators(ctx context.Context) {
+	hot.RefreshCreators(ctx)
+}
+
+func DecayHotSearches(ctx context.Context) {
+	controller.DecayHotSearches(ctx)
+}
+
+func PublishAnnouncements(ctx context.Context) {
 	select {
 	case <-ctx.Done():
-		zlog.Info("播放量同步任务被取消，停止扫描")
+		zlog.Info("公告发布任务被取消")
 		return
 	default:
 	}
-	recentTime := time.Now().AddDate(0, 0, -7)
-	post, err := global.Post.RecentPosts(recentTime)
+	now := time.Now()
+	announcements, err := global.Message.GetDueAnnouncements(now, now.Add(-controller.AnnouncementStaleAfter))
 	if err != nil {
-		zlog.Error("获取旧文章失败", zap.Error(err))
+		zlog.Error("获取待发布公告失败", zap.Error(err))
 		return
 	}
-	if len(post) == 0 {
-		zlog.Info("目前没有帖子")
+	for _, announcement := range announcements {
+		controller.DispatchAnnouncement(announcement)
+	}
+}
+
+func LiftExpiredSanctions(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		zlog.Info("处罚解除任务被取消")
 		return
+	default:
 	}
-	err = global.PostRedis.HotRank(post)
-	if err != nil {
+	sanction.LiftExpired(ctx)
+}
+
+func ProcessExports(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		zlog.Info("数据导出任务被取消")
 		return
+	default:
+	}
+	takeout.ProcessPending(ctx)
+	takeout.CleanExpired(ctx)
+}
+
+func PurgeDeletedAccounts(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		zlog.Info("账号注销任务被取消")
+		return
+	default:
 	}
+	login.PurgeDeletedAccounts(ctx)
 }
@@ -1,15 +1,54 @@
 package global
 
 import (
+	"commmunity/app/internal/ai"
 	"commmunity/app/internal/db/msq"
 	"commmunity/app/internal/db/red"
+	"commmunity/app/internal/mail"
+	"commmunity/app/internal/search"
 )
 
 var (
-	User         msq.UserData     = msq.NewGorm(msq.ConnectMysql())
-	UserRedis    red.UserRedis    = red.NewRedis(red.ConnectRedis())
-	Post         msq.PostData     = msq.NewGorm(msq.ConnectMysql())
-	PostRedis    red.PostRedis    = red.NewRedis(red.ConnectRedis())
-	Message      msq.MessageData  = msq.NewGorm(msq.ConnectMysql())
-	MessageRedis red.MessageRedis = red.NewRedis(red.ConnectRedis())
+	User         msq.UserData
+	UserRedis    red.UserRedis
+	Post         msq.PostData
+	PostRedis    red.PostRedis
+	Feed         red.FeedRedis
+	Recommend    red.RecommendRedis
+	SearchRedis  red.SearchRedis
+	Message      msq.MessageData
+	MessageRedis red.MessageRedis
+	Moderation   msq.ModerationData
+	Audit        msq.AuditData
+	Export       msq.ExportData
+	Usage        msq.UsageData
+	Quota        red.QuotaRedis
+	Mail         mail.Sender
+	Search       search.Index
+	Embedder     search.Embedder
+	Vectors      *search.VectorIndex
+	LLM          ai.LLMProvider
 )
+
+// Init 连接数据库和Redis并装配各个依赖，程序启动时调用一次；测试里不调用，直接给需要的变量赋假实现
+func Init() {
+	User = msq.NewGorm(msq.ConnectMysql())
+	UserRedis = red.NewRedis(red.ConnectRedis())
+	Post = msq.NewGorm(msq.ConnectMysql())
+	PostRedis = red.NewRedis(red.ConnectRedis())
+	Feed = red.NewRedis(red.ConnectRedis())
+	Recommend = red.NewRedis(red.ConnectRedis())
+	SearchRedis = red.NewRedis(red.ConnectRedis())
+	Message = msq.NewGorm(msq.ConnectMysql())
+	MessageRedis = red.NewRedis(red.ConnectRedis())
+	Moderation = msq.NewGorm(msq.ConnectMysql())
+	Audit = msq.NewGorm(msq.ConnectMysql())
+	Export = msq.NewGorm(msq.ConnectMysql())
+	Usage = msq.NewGorm(msq.ConnectMysql())
+	Quota = red.NewRedis(red.ConnectRedis())
+	Mail = mail.NewSender()
+	Search = search.NewIndex(msq.NewGorm(msq.ConnectMysql()))
+	Embedder = search.NewEmbedder()
+	Vectors = search.NewVectorIndex()
+	LLM = ai.NewProvider()
+}
@@ -0,0 +1,62 @@
+package msq
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/zlog"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func (db Gorm) SaveAuditLog(log *model.AuditLog) error {
+	err := db.db.Create(log).Error
+	if err != nil {
+		zlog.Error("写入审计日志失败", zap.String("action", log.Action), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func auditFilter(query *gorm.DB, q model.AuditQuery) *gorm.DB {
+	if q.ActorID != 0 {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.From != nil {
+		query = query.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("created_at < ?", *q.To)
+	}
+	return query
+}
+
+func (db Gorm) GetAuditLogs(query model.AuditQuery, offset int, limit int) ([]model.AuditLog, error) {
+	var logs []model.AuditLog
+	err := auditFilter(db.db.Model(&model.AuditLog{}), query).
+		Order("id desc").
+		Offset(offset).
+		Limit(limit).
+		Find(&logs).Error
+	if err != nil {
+		zlog.Error("查询审计日志失败", zap.Error(err))
+		return nil, err
+	}
+	return logs, nil
+}
+
+// ExportAuditLogs 分批读出，避免一次性把整张表读进内存
+func (db Gorm) ExportAuditLogs(query model.AuditQuery, batch func([]model.AuditLog) error) error {
+	var logs []model.AuditLog
+	err := auditFilter(db.db.Model(&model.AuditLog{}), query).
+		FindInBatches(&logs, 1000, func(tx *gorm.DB, _ int) error {
+			return batch(logs)
+		}).Error
+	if err != nil {
+		zlog.Error("导出审计日志失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
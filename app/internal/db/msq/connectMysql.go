@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Gorm struct {
@@ -35,19 +36,54 @@ func ConnectMysql() *gorm.DB {
 	if err != nil {
 		zlog.Fatal("数据库连接失败", zap.Error(err))
 	}
-	err = db.AutoMigrate(&model.User{}, &model.UserProfile{}, &model.Post{}, &model.Comment{}, &model.Message{}, &model.Notice{})
+	err = db.AutoMigrate(&model.User{}, &model.UserProfile{}, &model.Post{}, &model.Comment{}, &model.Message{}, &model.Notice{}, &model.Announcement{}, &model.SecurityLog{}, &model.Session{}, &model.RecoveryCode{}, &model.Role{}, &model.RolePermission{}, &model.Sanction{}, &model.Report{}, &model.SensitiveWord{}, &model.AuditLog{}, &model.ExportJob{}, &model.AccessToken{}, &model.UserIdentity{}, &model.PostEmbedding{}, &model.AIUsage{})
 	if err != nil {
 		zlog.Fatal("自动迁移失败", zap.Error(err))
 	}
 	zlog.Info("自动迁移成功")
-	if !db.Migrator().HasIndex(&model.Post{}, "idx_fulltext_search") {
-		err = db.Exec("ALTER TABLE posts ADD FULLTEXT INDEX idx_fulltext_search (title, content) WITH PARSER ngram").Error
-		if err != nil {
-			zlog.Error("创建全文索引失败", zap.Error(err))
-		} else {
-			zlog.Info("创建全文索引成功")
-		}
+	seedRoles(db)
+	//verified_email是后加的列，把之前已验证的邮箱补上，重复的只保留先写入的那个
+	if err = db.Exec("UPDATE IGNORE users SET verified_email = email WHERE email_verified = ? AND email <> '' AND verified_email IS NULL", true).Error; err != nil {
+		zlog.Error("补全已验证邮箱失败", zap.Error(err))
 	}
+	ensureFulltext(db, &model.Post{}, "posts", "idx_fulltext_search", "title, content")
+	ensureFulltext(db, &model.Comment{}, "comments", "idx_fulltext_comment", "content")
+	ensureFulltext(db, &model.UserProfile{}, "user_profiles", "idx_fulltext_profile", "name, introduction")
 
 	return db
 }
+
+// ensureFulltext MySQL搜索引擎用的ngram全文索引，AutoMigrate建不了，缺了就补上
+func ensureFulltext(db *gorm.DB, value interface{}, table string, name string, columns string) {
+	if db.Migrator().HasIndex(value, name) {
+		return
+	}
+	err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s) WITH PARSER ngram", table, name, columns)).Error
+	if err != nil {
+		zlog.Error("创建全文索引失败", zap.String("index", name), zap.Error(err))
+		return
+	}
+	zlog.Info("创建全文索引成功", zap.String("index", name))
+}
+
+// seedRoles 每次启动都对一遍，缺的角色和后来新增的默认权限补上，管理员手动加的权限不动
+func seedRoles(db *gorm.DB) {
+	for id, name := range model.RoleNames {
+		role := model.Role{ID: id, Name: name}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&role).Error; err != nil {
+			zlog.Error("初始化角色失败", zap.String("role", name), zap.Error(err))
+			continue
+		}
+		perms := make([]model.RolePermission, 0, len(model.DefaultRolePermissions[id]))
+		for _, p := range model.DefaultRolePermissions[id] {
+			perms = append(perms, model.RolePermission{RoleID: id, Permission: p})
+		}
+		if len(perms) == 0 {
+			continue
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&perms).Error; err != nil {
+			zlog.Error("补全角色权限失败", zap.String("role", name), zap.Error(err))
+		}
+	}
+	zlog.Info("角色权限校对完成")
+}
@@ -0,0 +1,148 @@
+package msq
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/zlog"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func (db Gorm) CreateExportJob(job *model.ExportJob) error {
+	err := db.db.Create(job).Error
+	if err != nil {
+		zlog.Error("创建导出任务失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetExportJob(jobId uint) (model.ExportJob, error) {
+	var job model.ExportJob
+	err := db.db.First(&job, jobId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ExportJob{}, nil
+		}
+		zlog.Error("查找导出任务失败", zap.Error(err))
+		return model.ExportJob{}, err
+	}
+	return job, nil
+}
+
+func (db Gorm) GetLatestExportJob(userId uint) (model.ExportJob, error) {
+	var job model.ExportJob
+	err := db.db.Where("user_id = ?", userId).Order("id desc").First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ExportJob{}, nil
+		}
+		zlog.Error("查找导出任务失败", zap.Error(err))
+		return model.ExportJob{}, err
+	}
+	return job, nil
+}
+
+func (db Gorm) GetPendingExportJobs(limit int) ([]model.ExportJob, error) {
+	var jobs []model.ExportJob
+	err := db.db.Where("status = ?", model.ExportPending).Order("id asc").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		zlog.Error("查找待处理导出任务失败", zap.Error(err))
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimExportJob 条件更新抢占任务，多实例时只有一个能拿到
+func (db Gorm) ClaimExportJob(jobId uint) (bool, error) {
+	result := db.db.Model(&model.ExportJob{}).
+		Where("id = ? AND status = ?", jobId, model.ExportPending).
+		Update("status", model.ExportRunning)
+	if result.Error != nil {
+		zlog.Error("抢占导出任务失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetStaleExportJobs 打包中但很久没有更新过的任务，一般是进程在打包途中退出了
+func (db Gorm) GetStaleExportJobs(staleBefore time.Time) ([]model.ExportJob, error) {
+	var jobs []model.ExportJob
+	err := db.db.Where("status = ? AND updated_at < ?", model.ExportRunning, staleBefore).Find(&jobs).Error
+	if err != nil {
+		zlog.Error("查找超时导出任务失败", zap.Error(err))
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// FailStaleExportJob 条件更新，任务在这期间正常结束的话不会被改掉
+func (db Gorm) FailStaleExportJob(jobId uint, staleBefore time.Time, errMsg string) (bool, error) {
+	result := db.db.Model(&model.ExportJob{}).
+		Where("id = ? AND status = ? AND updated_at < ?", jobId, model.ExportRunning, staleBefore).
+		Updates(map[string]interface{}{"status": model.ExportFailed, "error": errMsg})
+	if result.Error != nil {
+		zlog.Error("标记超时导出任务失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) FinishExportJob(jobId uint, status int, filePath string, expireAt *time.Time, errMsg string) error {
+	err := db.db.Model(&model.ExportJob{}).Where("id = ?", jobId).Updates(map[string]interface{}{
+		"status":    status,
+		"file_path": filePath,
+		"expire_at": expireAt,
+		"error":     errMsg,
+	}).Error
+	if err != nil {
+		zlog.Error("更新导出任务失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetExpiredExportJobs(now time.Time) ([]model.ExportJob, error) {
+	var jobs []model.ExportJob
+	err := db.db.Where("status = ? AND expire_at <= ?", model.ExportDone, now).Find(&jobs).Error
+	if err != nil {
+		zlog.Error("查找过期导出任务失败", zap.Error(err))
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (db Gorm) GetUserPosts(userId uint, lastId uint, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := db.db.Where("user_id = ? AND id > ?", userId, lastId).Order("id asc").Limit(limit).Find(&posts).Error
+	if err != nil {
+		zlog.Error("分批查找用户帖子失败", zap.Error(err))
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (db Gorm) GetUserComments(userId uint, lastId uint, limit int) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := db.db.Where("user_id = ? AND id > ?", userId, lastId).Order("id asc").Limit(limit).Find(&comments).Error
+	if err != nil {
+		zlog.Error("分批查找用户评论失败", zap.Error(err))
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (db Gorm) GetUserMessages(userId uint, lastId uint, limit int) ([]model.Message, error) {
+	var messages []model.Message
+	err := db.db.Where("(from_user_id = ? OR to_user_id = ?) AND id > ?", userId, userId, lastId).
+		Order("id asc").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		zlog.Error("分批查找用户私信失败", zap.Error(err))
+		return nil, err
+	}
+	return messages, nil
+}
@@ -6,10 +6,9 @@ import (
 )
 
 type UserData interface {
-	CreateUser(account string, hash string, name string) error
+	CreateUser(account string, hash string, name string, email string) (uint, error)
 	GetUser(account string) (*model.User, error)
 	GetProfile(account string) (model.User, error)
-	DeleteUser(account string) error
 	ChangePassword(account string, hash string) error
 	ChangeUserName(account string, name string) error
 	ChangeAvatar(account string, avatar string) error
@@ -21,32 +20,153 @@ type UserData interface {
 	GetFollowers(userId uint) ([]model.User, error)
 	GetFollowings(userId uint) ([]model.User, error)
 	IsFollowing(followedId uint, followerId uint) (bool, error)
+	GetFollowerIds(userId uint, lastId uint, limit int) ([]uint, error)
+	GetFollowingIds(userId uint) ([]uint, error)
+	CountFollowers(userId uint) (int64, error)
 	SetVip(userId uint, vip bool) error
+	GetUserIds(lastId uint, vipOnly bool, limit int) ([]uint, error)
+	GetUserByEmail(email string) (*model.User, error)
+	SetEmail(userId uint, email string) error
+	VerifyEmail(userId uint, email string) (bool, error)
+	ResetPassword(userId uint, hash string) error
+	SaveSecurityLog(log model.SecurityLog)
+	CreateSession(session *model.Session) error
+	GetSession(sessionId uint) (model.Session, error)
+	RotateSession(sessionId uint, oldJti string, newJti string, ip string) (bool, error)
+	RevokeSession(sessionId uint) error
+	RevokeUserSessions(userId uint) ([]uint, error)
+	GetActiveSessions(userId uint, since time.Time) ([]model.Session, error)
+	GetRoles() ([]model.Role, error)
+	SetRolePermissions(roleId int, permissions []string) error
+	SetUserRole(userId uint, role int) error
+	GetRoleVersion(userId uint) (int, int, error)
+	SetTotpSecret(userId uint, secret string) error
+	EnableTotp(userId uint, codeHashes []string) error
+	DisableTotp(userId uint) error
+	GetRecoveryCodes(userId uint) ([]model.RecoveryCode, error)
+	UseRecoveryCode(codeId uint) (bool, error)
+	UseTotpStep(userId uint, step int64) (bool, error)
+	ScheduleDeletion(userId uint, at *time.Time) error
+	GetDueDeletions(now time.Time, limit int) ([]model.User, error)
+	AnonymizeUser(userId uint) ([]uint, error)
+	CreateAccessToken(token *model.AccessToken) error
+	CountAccessTokens(userId uint) (int64, error)
+	GetAccessTokens(userId uint) ([]model.AccessToken, error)
+	GetAccessTokenByHash(hash string) (model.AccessToken, error)
+	RevokeAccessToken(userId uint, tokenId uint) (bool, error)
+	TouchAccessToken(tokenId uint, now time.Time) error
+	GetUserById(userId uint) (*model.User, error)
+	CreateIdentity(identity *model.UserIdentity) (bool, error)
+	GetIdentity(provider string, subject string) (model.UserIdentity, error)
+	GetIdentities(userId uint) ([]model.UserIdentity, error)
+	DeleteIdentity(userId uint, provider string) (bool, error)
+	ScanUsers(lastId uint, limit int) ([]model.User, error)
+	GetUsersByIds(userIds []uint) ([]model.User, error)
+	CountFollowersByIds(userIds []uint) (map[uint]int64, error)
+	FollowingAmong(followerId uint, userIds []uint) ([]uint, error)
+	CreatorStats(since time.Time, limit int) ([]model.CreatorStat, error)
 }
 
 type PostData interface {
-	CreatePost(userID uint, title string, content string) error
-	GetPostList(offset int, pageSize int) ([]model.Post, error)
+	CreatePost(userID uint, title string, content string, status int) (uint, error)
+	GetPostList(page model.PageQuery) ([]model.Post, error)
 	GetPostDetail(postID uint) (model.Post, error)
-	CreateComment(userID uint, postID uint, content string) error
+	CreateComment(userID uint, postID uint, content string) (uint, error)
 	GetUserProfile(userID uint) (model.User, error)
 	DeletePost(postID uint) error
 	DeleteComment(commentID uint) error
 	GetCommentDetail(commentID uint) (model.Comment, error)
 	Like(postId uint, likeCount uint) error
-	GetFollowingPosts(userId uint, offset int, pageSize int) ([]model.Post, error)
+	GetPostIdsByUsers(userIds []uint, limit int) ([]uint, error)
 	View(postId uint, viewCount uint) error
 	RecentPosts(recentTime time.Time) ([]model.Post, error)
 	HotPosts(postIds []uint) ([]model.Post, error)
-	SearchPosts(keyword string, offset, pageSize int) ([]model.Post, error)
+	ScanPosts(lastId uint, limit int) ([]model.Post, error)
+	VisiblePostIds(postIds []uint) ([]uint, error)
+	ScanComments(lastId uint, limit int) ([]model.Comment, error)
+	GetCommentsByIds(commentIds []uint) ([]model.Comment, error)
+	SuggestPosts(prefix string, limit int) ([]model.Post, error)
+	SuggestUsers(prefix string, limit int) ([]model.UserProfile, error)
 	SetPostPaid(postId uint, isPaid bool) error
 	GetPoster(postId uint) (uint, error)
+	GetPost(postId uint) (model.Post, error)
+	CountPublishedPosts(userId uint) (int64, error)
+	GetPendingPosts(offset int, limit int) ([]model.Post, error)
+	ReviewPost(postId uint, status int) (bool, error)
+	SaveEmbedding(embedding *model.PostEmbedding) error
+	ScanEmbeddings(lastId uint, limit int) ([]model.PostEmbedding, error)
+	DeleteEmbedding(postId uint) error
 }
 
 type MessageData interface {
-	SaveMessage(formUserId uint, toUserId uint, content string, tp int)
-	GetHistoryMessage(userId1 uint, userId2 uint, offset int, limit int) ([]model.Message, error)
+	SaveMessage(formUserId uint, toUserId uint, content string, tp int) uint
+	GetHistoryMessage(userId1 uint, userId2 uint, page model.PageQuery) ([]model.Message, error)
+	GetMessage(messageId uint) (model.Message, error)
+	DeleteMessage(messageId uint) error
+	GetMessagePartners(userId uint) ([]uint, error)
 	SaveNotice(userId uint, senderId uint, typ int, content string, postId uint)
-	GetUnreadNotices(userID uint, offset int, limit int) ([]model.Notice, error)
+	GetUnreadNotices(userID uint, page model.PageQuery) ([]model.Notice, error)
 	ReadAllNotices(userID uint) error
+	ReadNotices(userID uint, ids []uint) error
+	SaveNotices(notices []model.Notice) error
+	CreateAnnouncement(announcement *model.Announcement) error
+	GetAnnouncement(id uint) (model.Announcement, error)
+	GetDueAnnouncements(now time.Time, staleBefore time.Time) ([]model.Announcement, error)
+	GetActiveAnnouncements(now time.Time) ([]model.Announcement, error)
+	ClaimAnnouncement(id uint, from int, to int) (bool, error)
+	ReclaimAnnouncement(id uint, staleBefore time.Time) (bool, error)
+	SaveAnnouncementProgress(id uint, lastUser uint) (bool, error)
+	UpdateAnnouncementStatus(id uint, status int) error
+	ExpireAnnouncementNotices(id uint, expireAt time.Time) error
+}
+
+type ModerationData interface {
+	CreateSanction(sanction *model.Sanction) error
+	GetSanction(sanctionId uint) (model.Sanction, error)
+	GetActiveSanctions(userId uint, now time.Time) ([]model.Sanction, error)
+	CountActiveSanctions(userId uint, typ int, now time.Time) (int64, error)
+	GetActiveSanctionsByType(typ int, now time.Time) ([]model.Sanction, error)
+	GetExpiredSanctions(now time.Time) ([]model.Sanction, error)
+	LiftSanction(sanctionId uint) (bool, error)
+	AppealSanction(sanctionId uint, appeal string) (bool, error)
+	ReviewAppeal(sanctionId uint, status int) (bool, error)
+	GetPendingAppeals(offset int, limit int) ([]model.Sanction, error)
+	CreateReport(report *model.Report) (bool, error)
+	CountPendingReports(targetType int, targetId uint) (int64, error)
+	GetReportQueue(offset int, limit int) ([]model.ReportGroup, error)
+	GetTargetReports(targetType int, targetId uint) ([]model.Report, error)
+	ResolveReports(targetType int, targetId uint, status int, handlerId uint) (bool, error)
+	SetHidden(targetType int, targetId uint, hidden bool) (bool, error)
+	GetAllWords() ([]model.SensitiveWord, error)
+	GetWords(offset int, limit int) ([]model.SensitiveWord, error)
+	GetWord(wordId uint) (model.SensitiveWord, error)
+	CreateWord(word *model.SensitiveWord) (bool, error)
+	UpdateWord(wordId uint, action int) (bool, error)
+	DeleteWord(wordId uint) (bool, error)
+}
+
+type AuditData interface {
+	SaveAuditLog(log *model.AuditLog) error
+	GetAuditLogs(query model.AuditQuery, offset int, limit int) ([]model.AuditLog, error)
+	ExportAuditLogs(query model.AuditQuery, batch func([]model.AuditLog) error) error
+}
+
+type UsageData interface {
+	SaveUsage(usage *model.AIUsage) error
+	UsageReport(query model.UsageQuery, limit int) ([]model.UsageStat, error)
+}
+
+type ExportData interface {
+	CreateExportJob(job *model.ExportJob) error
+	GetExportJob(jobId uint) (model.ExportJob, error)
+	GetLatestExportJob(userId uint) (model.ExportJob, error)
+	GetPendingExportJobs(limit int) ([]model.ExportJob, error)
+	ClaimExportJob(jobId uint) (bool, error)
+	GetStaleExportJobs(staleBefore time.Time) ([]model.ExportJob, error)
+	FailStaleExportJob(jobId uint, staleBefore time.Time, errMsg string) (bool, error)
+	FinishExportJob(jobId uint, status int, filePath string, expireAt *time.Time, errMsg string) error
+	GetExpiredExportJobs(now time.Time) ([]model.ExportJob, error)
+	GetUserPosts(userId uint, lastId uint, limit int) ([]model.Post, error)
+	GetUserComments(userId uint, lastId uint, limit int) ([]model.Comment, error)
+	GetUserMessages(userId uint, lastId uint, limit int) ([]model.Message, error)
 }
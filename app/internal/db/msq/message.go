@@ -3,11 +3,14 @@ package msq
 import (
 	"commmunity/app/internal/model"
 	"commmunity/app/zlog"
+	"errors"
+	"time"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
-func (db Gorm) SaveMessage(formUserId uint, toUserId uint, content string, tp int) {
+func (db Gorm) SaveMessage(formUserId uint, toUserId uint, content string, tp int) uint {
 	chatMsg := model.Message{
 		FromUserID: formUserId,
 		ToUserID:   toUserId,
@@ -17,17 +20,16 @@ func (db Gorm) SaveMessage(formUserId uint, toUserId uint, content string, tp in
 	err := db.db.Create(&chatMsg).Error
 	if err != nil {
 		zlog.Error("保存消息失败", zap.Error(err))
-		return
+		return 0
 	}
+	return chatMsg.ID
 }
 
-func (db Gorm) GetHistoryMessage(userId1 uint, userId2 uint, offset int, limit int) ([]model.Message, error) {
+func (db Gorm) GetHistoryMessage(userId1 uint, userId2 uint, page model.PageQuery) ([]model.Message, error) {
 	var chatMsgs []model.Message
-	err := db.db.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)", userId1, userId2, userId2, userId1).
-		Order("created_at desc").
-		Offset(offset).
-		Limit(limit).
-		Find(&chatMsgs).Error
+	tx := db.db.Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)", userId1, userId2, userId2, userId1).
+		Where("hidden = ?", false)
+	err := paginate(tx, page).Find(&chatMsgs).Error
 	if err != nil {
 		zlog.Error("查找历史聊天失败", zap.Error(err))
 		return nil, err
@@ -35,6 +37,50 @@ func (db Gorm) GetHistoryMessage(userId1 uint, userId2 uint, offset int, limit i
 	return chatMsgs, nil
 }
 
+func (db Gorm) GetMessage(messageId uint) (model.Message, error) {
+	var message model.Message
+	err := db.db.First(&message, messageId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Message{}, nil
+		}
+		zlog.Error("查找私信失败", zap.Error(err))
+		return model.Message{}, err
+	}
+	return message, nil
+}
+
+func (db Gorm) DeleteMessage(messageId uint) error {
+	err := db.db.Delete(&model.Message{}, messageId).Error
+	if err != nil {
+		zlog.Error("删除私信失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetMessagePartners 和这个用户互发过私信的所有人，包括被隐藏的私信
+func (db Gorm) GetMessagePartners(userId uint) ([]uint, error) {
+	var to, from []uint
+	err := db.db.Model(&model.Message{}).Where("from_user_id = ?", userId).Distinct().Pluck("to_user_id", &to).Error
+	if err == nil {
+		err = db.db.Model(&model.Message{}).Where("to_user_id = ?", userId).Distinct().Pluck("from_user_id", &from).Error
+	}
+	if err != nil {
+		zlog.Error("查找私信对象失败", zap.Uint("userId", userId), zap.Error(err))
+		return nil, err
+	}
+	seen := make(map[uint]bool, len(to)+len(from))
+	ids := make([]uint, 0, len(to)+len(from))
+	for _, id := range append(to, from...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 func (db Gorm) SaveNotice(userId uint, senderId uint, typ int, content string, postId uint) {
 	notice := model.Notice{
 		UserID:   userId,
@@ -50,13 +96,11 @@ func (db Gorm) SaveNotice(userId uint, senderId uint, typ int, content string, p
 	}
 }
 
-func (db Gorm) GetUnreadNotices(userID uint, offset int, limit int) ([]model.Notice, error) {
+func (db Gorm) GetUnreadNotices(userID uint, page model.PageQuery) ([]model.Notice, error) {
 	var notices []model.Notice
-	err := db.db.Where("user_id = ? AND is_read = ?", userID, false).
-		Order("created_at desc").
-		Offset(offset).
-		Limit(limit).
-		Find(&notices).Error
+	tx := db.db.Where("user_id = ? AND is_read = ?", userID, false).
+		Where("expire_at IS NULL OR expire_at > ?", time.Now())
+	err := paginate(tx, page).Find(&notices).Error
 	if err != nil {
 		zlog.Error("查找未读通知失败", zap.Error(err))
 		return nil, err
@@ -74,3 +118,131 @@ func (db Gorm) ReadAllNotices(userID uint) error {
 	}
 	return nil
 }
+
+// ReadNotices 游标翻页时只把这一页标记为已读，后面的页还能接着取
+func (db Gorm) ReadNotices(userID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := db.db.Model(&model.Notice{}).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Update("is_read", true).Error
+	if err != nil {
+		zlog.Error("标记已读失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) SaveNotices(notices []model.Notice) error {
+	err := db.db.CreateInBatches(&notices, 500).Error
+	if err != nil {
+		zlog.Error("批量保存通知失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) CreateAnnouncement(announcement *model.Announcement) error {
+	err := db.db.Create(announcement).Error
+	if err != nil {
+		zlog.Error("创建公告失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetAnnouncement(id uint) (model.Announcement, error) {
+	var announcement model.Announcement
+	err := db.db.First(&announcement, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Warn("未找到该公告")
+			return model.Announcement{}, nil
+		}
+		zlog.Error("查找公告失败", zap.Error(err))
+		return model.Announcement{}, err
+	}
+	return announcement, nil
+}
+
+// GetDueAnnouncements 到时间的待发布公告，加上staleBefore之后没有进度的发布中公告（投递的进程挂了）
+func (db Gorm) GetDueAnnouncements(now time.Time, staleBefore time.Time) ([]model.Announcement, error) {
+	var announcements []model.Announcement
+	err := db.db.Where("(status = ? AND publish_at <= ?) OR (status = ? AND updated_at < ?)",
+		model.AnnouncementPending, now, model.AnnouncementSending, staleBefore).
+		Order("publish_at asc").
+		Find(&announcements).Error
+	if err != nil {
+		zlog.Error("查找待发布公告失败", zap.Error(err))
+		return nil, err
+	}
+	return announcements, nil
+}
+
+func (db Gorm) GetActiveAnnouncements(now time.Time) ([]model.Announcement, error) {
+	var announcements []model.Announcement
+	err := db.db.Where("status IN ? AND publish_at <= ?", []int{model.AnnouncementSending, model.AnnouncementPublished}, now).
+		Where("expire_at IS NULL OR expire_at > ?", now).
+		Order("publish_at desc").
+		Find(&announcements).Error
+	if err != nil {
+		zlog.Error("查找生效公告失败", zap.Error(err))
+		return nil, err
+	}
+	return announcements, nil
+}
+
+// 只有状态仍为from时才更新，保证同一条公告只会被投递一次
+func (db Gorm) ClaimAnnouncement(id uint, from int, to int) (bool, error) {
+	result := db.db.Model(&model.Announcement{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	if result.Error != nil {
+		zlog.Error("更新公告状态失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReclaimAnnouncement 接手长时间没有进度的发布中公告，只有一个进程能接手成功
+func (db Gorm) ReclaimAnnouncement(id uint, staleBefore time.Time) (bool, error) {
+	result := db.db.Model(&model.Announcement{}).
+		Where("id = ? AND status = ? AND updated_at < ?", id, model.AnnouncementSending, staleBefore).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		zlog.Error("接手公告失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// SaveAnnouncementProgress 记录投递进度，公告已经不是发布中（比如被撤回）时返回false
+func (db Gorm) SaveAnnouncementProgress(id uint, lastUser uint) (bool, error) {
+	result := db.db.Model(&model.Announcement{}).
+		Where("id = ? AND status = ?", id, model.AnnouncementSending).
+		Update("last_user", lastUser)
+	if result.Error != nil {
+		zlog.Error("保存公告投递进度失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) UpdateAnnouncementStatus(id uint, status int) error {
+	err := db.db.Model(&model.Announcement{}).Where("id = ?", id).Update("status", status).Error
+	if err != nil {
+		zlog.Error("更新公告状态失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) ExpireAnnouncementNotices(id uint, expireAt time.Time) error {
+	err := db.db.Model(&model.Notice{}).Where("announcement_id = ?", id).Update("expire_at", expireAt).Error
+	if err != nil {
+		zlog.Error("公告通知过期失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
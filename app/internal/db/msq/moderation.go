@@ -0,0 +1,291 @@
+package msq
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/zlog"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func (db Gorm) CreateSanction(sanction *model.Sanction) error {
+	err := db.db.Create(sanction).Error
+	if err != nil {
+		zlog.Error("创建处罚失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetSanction(sanctionId uint) (model.Sanction, error) {
+	var sanction model.Sanction
+	err := db.db.First(&sanction, sanctionId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Sanction{}, nil
+		}
+		zlog.Error("查找处罚失败", zap.Error(err))
+		return model.Sanction{}, err
+	}
+	return sanction, nil
+}
+
+func activeSanction(query *gorm.DB, now time.Time) *gorm.DB {
+	return query.Where("lifted_at IS NULL AND start_at <= ?", now).
+		Where("end_at IS NULL OR end_at > ?", now)
+}
+
+func (db Gorm) GetActiveSanctions(userId uint, now time.Time) ([]model.Sanction, error) {
+	var sanctions []model.Sanction
+	err := activeSanction(db.db.Where("user_id = ?", userId), now).
+		Order("created_at desc").
+		Find(&sanctions).Error
+	if err != nil {
+		zlog.Error("查找生效处罚失败", zap.Error(err))
+		return nil, err
+	}
+	return sanctions, nil
+}
+
+func (db Gorm) CountActiveSanctions(userId uint, typ int, now time.Time) (int64, error) {
+	var count int64
+	err := activeSanction(db.db.Model(&model.Sanction{}).Where("user_id = ? AND type = ?", userId, typ), now).
+		Count(&count).Error
+	if err != nil {
+		zlog.Error("统计生效处罚失败", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db Gorm) GetActiveSanctionsByType(typ int, now time.Time) ([]model.Sanction, error) {
+	var sanctions []model.Sanction
+	err := activeSanction(db.db.Where("type = ?", typ), now).Find(&sanctions).Error
+	if err != nil {
+		zlog.Error("查找生效处罚失败", zap.Error(err))
+		return nil, err
+	}
+	return sanctions, nil
+}
+
+func (db Gorm) GetExpiredSanctions(now time.Time) ([]model.Sanction, error) {
+	var sanctions []model.Sanction
+	err := db.db.Where("lifted_at IS NULL AND end_at IS NOT NULL AND end_at <= ?", now).
+		Limit(1000).
+		Find(&sanctions).Error
+	if err != nil {
+		zlog.Error("查找到期处罚失败", zap.Error(err))
+		return nil, err
+	}
+	return sanctions, nil
+}
+
+func (db Gorm) LiftSanction(sanctionId uint) (bool, error) {
+	result := db.db.Model(&model.Sanction{}).Where("id = ? AND lifted_at IS NULL", sanctionId).Update("lifted_at", time.Now())
+	if result.Error != nil {
+		zlog.Error("解除处罚失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AppealSanction 每条处罚只能申诉一次
+func (db Gorm) AppealSanction(sanctionId uint, appeal string) (bool, error) {
+	result := db.db.Model(&model.Sanction{}).
+		Where("id = ? AND lifted_at IS NULL AND appeal_status = ?", sanctionId, model.AppealNone).
+		Updates(map[string]interface{}{"appeal": appeal, "appeal_status": model.AppealPending})
+	if result.Error != nil {
+		zlog.Error("提交申诉失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) ReviewAppeal(sanctionId uint, status int) (bool, error) {
+	result := db.db.Model(&model.Sanction{}).
+		Where("id = ? AND appeal_status = ?", sanctionId, model.AppealPending).
+		Update("appeal_status", status)
+	if result.Error != nil {
+		zlog.Error("处理申诉失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) GetPendingAppeals(offset int, limit int) ([]model.Sanction, error) {
+	var sanctions []model.Sanction
+	err := db.db.Where("appeal_status = ?", model.AppealPending).
+		Order("updated_at asc").
+		Offset(offset).
+		Limit(limit).
+		Find(&sanctions).Error
+	if err != nil {
+		zlog.Error("查找待处理申诉失败", zap.Error(err))
+		return nil, err
+	}
+	return sanctions, nil
+}
+
+func (db Gorm) CreateReport(report *model.Report) (bool, error) {
+	var count int64
+	err := db.db.Model(&model.Report{}).
+		Where("reporter_id = ? AND target_type = ? AND target_id = ?", report.ReporterID, report.TargetType, report.TargetID).
+		Count(&count).Error
+	if err != nil {
+		zlog.Error("查找举报失败", zap.Error(err))
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	err = db.db.Create(report).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return false, nil
+		}
+		zlog.Error("创建举报失败", zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+func (db Gorm) CountPendingReports(targetType int, targetId uint) (int64, error) {
+	var count int64
+	err := db.db.Model(&model.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetId, model.ReportPending).
+		Count(&count).Error
+	if err != nil {
+		zlog.Error("统计举报失败", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db Gorm) GetReportQueue(offset int, limit int) ([]model.ReportGroup, error) {
+	var groups []model.ReportGroup
+	err := db.db.Model(&model.Report{}).
+		Select("target_type, target_id, MAX(author_id) AS author_id, COUNT(*) AS count, MAX(created_at) AS last_reported_at").
+		Where("status = ?", model.ReportPending).
+		Group("target_type, target_id").
+		Order("count desc, last_reported_at desc").
+		Offset(offset).
+		Limit(limit).
+		Scan(&groups).Error
+	if err != nil {
+		zlog.Error("查找审核队列失败", zap.Error(err))
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (db Gorm) GetTargetReports(targetType int, targetId uint) ([]model.Report, error) {
+	var reports []model.Report
+	err := db.db.Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetId, model.ReportPending).
+		Order("created_at desc").
+		Find(&reports).Error
+	if err != nil {
+		zlog.Error("查找举报详情失败", zap.Error(err))
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (db Gorm) ResolveReports(targetType int, targetId uint, status int, handlerId uint) (bool, error) {
+	result := db.db.Model(&model.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetId, model.ReportPending).
+		Updates(map[string]interface{}{"status": status, "handler_id": handlerId, "handled_at": time.Now()})
+	if result.Error != nil {
+		zlog.Error("处理举报失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SetHidden 返回状态是否真的发生了变化，已经是目标状态时什么都不做
+func (db Gorm) SetHidden(targetType int, targetId uint, hidden bool) (bool, error) {
+	var target interface{}
+	switch targetType {
+	case model.ReportPost:
+		target = &model.Post{}
+	case model.ReportComment:
+		target = &model.Comment{}
+	case model.ReportMessage:
+		target = &model.Message{}
+	default:
+		return false, nil
+	}
+	result := db.db.Model(target).Where("id = ? AND hidden <> ?", targetId, hidden).Update("hidden", hidden)
+	if result.Error != nil {
+		zlog.Error("更新隐藏状态失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) GetAllWords() ([]model.SensitiveWord, error) {
+	var words []model.SensitiveWord
+	err := db.db.Select("id, word, action").Find(&words).Error
+	if err != nil {
+		zlog.Error("加载敏感词失败", zap.Error(err))
+		return nil, err
+	}
+	return words, nil
+}
+
+func (db Gorm) GetWords(offset int, limit int) ([]model.SensitiveWord, error) {
+	var words []model.SensitiveWord
+	err := db.db.Order("id desc").Offset(offset).Limit(limit).Find(&words).Error
+	if err != nil {
+		zlog.Error("查找敏感词失败", zap.Error(err))
+		return nil, err
+	}
+	return words, nil
+}
+
+func (db Gorm) CreateWord(word *model.SensitiveWord) (bool, error) {
+	var count int64
+	err := db.db.Model(&model.SensitiveWord{}).Where("word = ?", word.Word).Count(&count).Error
+	if err != nil {
+		zlog.Error("查找敏感词失败", zap.Error(err))
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	err = db.db.Create(word).Error
+	if err != nil {
+		zlog.Error("添加敏感词失败", zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+func (db Gorm) GetWord(wordId uint) (model.SensitiveWord, error) {
+	var word model.SensitiveWord
+	err := db.db.Where("id = ?", wordId).Limit(1).Find(&word).Error
+	if err != nil {
+		zlog.Error("查找敏感词失败", zap.Error(err))
+		return word, err
+	}
+	return word, nil
+}
+
+func (db Gorm) UpdateWord(wordId uint, action int) (bool, error) {
+	result := db.db.Model(&model.SensitiveWord{}).Where("id = ?", wordId).Update("action", action)
+	if result.Error != nil {
+		zlog.Error("修改敏感词失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (db Gorm) DeleteWord(wordId uint) (bool, error) {
+	result := db.db.Unscoped().Delete(&model.SensitiveWord{}, wordId)
+	if result.Error != nil {
+		zlog.Error("删除敏感词失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
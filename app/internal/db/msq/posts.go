@@ -4,42 +4,59 @@ import (
 	"commmunity/app/internal/model"
 	"commmunity/app/zlog"
 	"errors"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func (db Gorm) CreatePost(userID uint, title string, content string) error {
+func (db Gorm) CreatePost(userID uint, title string, content string, status int) (uint, error) {
 	tx := db.db.Begin()
 	post := model.Post{
 		UserID:  userID,
 		Title:   title,
 		Content: content,
+		Status:  status,
 	}
 	result := tx.Create(&post)
 	if result.Error != nil {
 		zlog.Error("帖子创建失败", zap.Error(result.Error))
 		tx.Rollback()
-		return result.Error
+		return 0, result.Error
 	}
 	err := tx.Commit().Error
 	if err != nil {
 		zlog.Error("事务提交失败", zap.Error(err))
-		return err
+		return 0, err
 	}
-	return nil
+	return post.ID, nil
+}
+
+// paginate 游标模式按(created_at,id)倒序接着上一页最后一条往后取，新插入的数据不会让翻页重复或漏掉；否则按offset翻页
+func paginate(tx *gorm.DB, page model.PageQuery) *gorm.DB {
+	if !page.Cursor {
+		return tx.Order("created_at desc").Offset(page.Offset).Limit(page.Limit)
+	}
+	return cursorPage(tx, page, "id")
+}
+
+// cursorPage idColumn是游标里ID对应的列
+func cursorPage(tx *gorm.DB, page model.PageQuery, idColumn string) *gorm.DB {
+	if page.CursorID > 0 {
+		tx = tx.Where(fmt.Sprintf("(created_at < ? OR (created_at = ? AND %s < ?))", idColumn), page.CursorTime, page.CursorTime, page.CursorID)
+	}
+	return tx.Order(fmt.Sprintf("created_at desc, %s desc", idColumn)).Limit(page.Limit)
 }
 
-func (db Gorm) GetPostList(offset int, pageSize int) ([]model.Post, error) {
+func (db Gorm) GetPostList(page model.PageQuery) ([]model.Post, error) {
 	var posts []model.Post
-	err := db.db.Preload("User").
+	tx := db.db.Preload("User").
 		Preload("User.UserProfile").
 		Select("id, user_id, title, created_at, view_count, like_count, comment_count").
-		Order("created_at desc").
-		Offset(offset).
-		Limit(pageSize).
-		Find(&posts).Error
+		Where("hidden = ? AND status = ?", false, model.PostPublished)
+	err := paginate(tx, page).Find(&posts).Error
 	if err != nil {
 		zlog.Error("论坛生成失败", zap.Error(err))
 		return nil, err
@@ -51,7 +68,7 @@ func (db Gorm) GetPostDetail(postID uint) (model.Post, error) {
 	var post model.Post
 	err := db.db.Preload("User").
 		Preload("User.UserProfile").
-		Preload("Comments").
+		Preload("Comments", "hidden = ?", false).
 		Preload("Comments.User").
 		Preload("Comments.User.UserProfile").
 		First(&post, postID).Error
@@ -66,7 +83,7 @@ func (db Gorm) GetPostDetail(postID uint) (model.Post, error) {
 	return post, nil
 }
 
-func (db Gorm) CreateComment(userID uint, postID uint, content string) error {
+func (db Gorm) CreateComment(userID uint, postID uint, content string) (uint, error) {
 	tx := db.db.Begin()
 	comment := model.Comment{
 		PostID:  postID,
@@ -77,25 +94,25 @@ func (db Gorm) CreateComment(userID uint, postID uint, content string) error {
 	if result.Error != nil {
 		zlog.Error("评论创建失败", zap.Error(result.Error))
 		tx.Rollback()
-		return result.Error
+		return 0, result.Error
 	}
 	err := tx.Model(&model.Post{}).Where("id = ?", postID).
 		UpdateColumn("comment_count", gorm.Expr("comment_count + ?", 1)).Error
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
 	}
 	err = tx.Commit().Error
 	if err != nil {
 		zlog.Error("事务提交失败", zap.Error(err))
-		return err
+		return 0, err
 	}
-	return nil
+	return comment.ID, nil
 }
 
 func (db Gorm) GetUserProfile(userID uint) (model.User, error) {
 	var user model.User
-	err := db.db.Preload("UserProfile").Preload("Posts").First(&user, userID).Error
+	err := db.db.Preload("UserProfile").Preload("Posts", "hidden = ? AND status = ?", false, model.PostPublished).First(&user, userID).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			zlog.Warn("用户未找到", zap.Uint("userID", userID))
@@ -148,34 +165,22 @@ func (db Gorm) Like(postId uint, likeCount uint) error {
 	return nil
 }
 
-func (db Gorm) GetFollowingPosts(userId uint, offset int, pageSize int) ([]model.Post, error) {
-	var posts []model.Post
-	var followedIds []uint
-
-	err := db.db.Model(&model.UserRelation{}).
-		Where("follower_id IN (?)", userId).
-		Pluck("followed_id", &followedIds).Error
-	if err != nil {
-		zlog.Error("查找关注失败", zap.Error(err))
-		return nil, err
+// GetPostIdsByUsers 时间线冷启动和关注回填用，只取ID
+func (db Gorm) GetPostIdsByUsers(userIds []uint, limit int) ([]uint, error) {
+	var ids []uint
+	if len(userIds) == 0 {
+		return ids, nil
 	}
-	if len(followedIds) == 0 {
-		return posts, nil
-	}
-	err = db.db.Model(model.Post{}).
-		Preload("User").
-		Preload("User.UserProfile").
-		Where("user_id IN ?", followedIds).
-		Preload("User").
-		Order("created_at desc").
-		Limit(pageSize).
-		Offset(offset).
-		Find(&posts).Error
+	err := db.db.Model(&model.Post{}).
+		Where("user_id IN ? AND hidden = ? AND status = ?", userIds, false, model.PostPublished).
+		Order("id desc").
+		Limit(limit).
+		Pluck("id", &ids).Error
 	if err != nil {
 		zlog.Error("加载关注动态失败", zap.Error(err))
 		return nil, err
 	}
-	return posts, nil
+	return ids, nil
 }
 
 func (db Gorm) View(postId uint, viewCount uint) error {
@@ -189,12 +194,11 @@ func (db Gorm) View(postId uint, viewCount uint) error {
 
 func (db Gorm) RecentPosts(recentTime time.Time) ([]model.Post, error) {
 	var posts []model.Post
-	err := db.db.Preload("User.UserProfile").
-		Select("id, like_count, comment_count, view_count").
-		Where("created_at > ?", recentTime).
+	err := db.db.Select("id, created_at, like_count, comment_count, view_count").
+		Where("created_at > ? AND hidden = ? AND status = ?", recentTime, false, model.PostPublished).
 		Find(&posts).Error
 	if err != nil {
-		zlog.Error("查找过去7天文章失败", zap.Error(err))
+		zlog.Error("查找近期文章失败", zap.Error(err))
 		return nil, err
 	}
 	return posts, nil
@@ -204,8 +208,8 @@ func (db Gorm) HotPosts(postIds []uint) ([]model.Post, error) {
 	var posts []model.Post
 	err := db.db.Preload("User").
 		Preload("User.UserProfile").
-		Select("id, user_id, title, created_at, view_count, like_count, comment_count").
-		Where("id IN (?)", postIds).Find(&posts).Error
+		Select("id, user_id, title, paid, created_at, view_count, like_count, comment_count").
+		Where("id IN (?) AND hidden = ? AND status = ?", postIds, false, model.PostPublished).Find(&posts).Error
 	if err != nil {
 		zlog.Error("热度榜查找失败", zap.Error(err))
 		return nil, err
@@ -213,41 +217,167 @@ func (db Gorm) HotPosts(postIds []uint) ([]model.Post, error) {
 	return posts, nil
 }
 
-func (db Gorm) SearchPosts(keyword string, offset int, pageSize int) ([]model.Post, error) {
-	var posts []model.Post
-	if keyword == "" {
-		zlog.Error("搜索不可为空")
-		return nil, errors.New("搜索不可为空")
+func (db Gorm) SetPostPaid(postId uint, isPaid bool) error {
+	err := db.db.Model(&model.Post{}).Select("paid").Where("id = ?", postId).Update("paid", isPaid).Error
+	if err != nil {
+		zlog.Error("更新付费文章失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetPoster(postId uint) (uint, error) {
+	var post model.Post
+	err := db.db.Where("id = ?", postId).First(&post).Error
+	if err != nil {
+		zlog.Error("查找作者失败", zap.Error(err))
+		return 0, err
+	}
+	return post.UserID, nil
+}
+
+// GetPost 不带评论和作者，只用来判断帖子状态；找不到返回空帖子
+func (db Gorm) GetPost(postId uint) (model.Post, error) {
+	var post model.Post
+	err := db.db.Select("id, user_id, hidden, status, paid").First(&post, postId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Post{}, nil
+		}
+		zlog.Error("查询文章失败", zap.Error(err))
+		return model.Post{}, err
+	}
+	return post, nil
+}
+
+func (db Gorm) CountPublishedPosts(userId uint) (int64, error) {
+	var count int64
+	err := db.db.Model(&model.Post{}).Where("user_id = ? AND status = ?", userId, model.PostPublished).Count(&count).Error
+	if err != nil {
+		zlog.Error("统计已发布帖子失败", zap.Error(err))
+		return 0, err
 	}
-	err := db.db.Where("MATCH (title, content) AGAINST (? IN NATURAL LANGUAGE MODE)", keyword).
-		Preload("User").
+	return count, nil
+}
+
+func (db Gorm) GetPendingPosts(offset int, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := db.db.Preload("User").
 		Preload("User.UserProfile").
-		Select("id, user_id, title, content, created_at, view_count, like_count, comment_count").
+		Where("status = ?", model.PostPendingReview).
+		Order("created_at asc").
 		Offset(offset).
-		Limit(pageSize).
+		Limit(limit).
 		Find(&posts).Error
 	if err != nil {
-		zlog.Error("搜索帖子失败", zap.Error(err))
+		zlog.Error("查找待审核帖子失败", zap.Error(err))
 		return nil, err
 	}
 	return posts, nil
 }
 
-func (db Gorm) SetPostPaid(postId uint, isPaid bool) error {
-	err := db.db.Model(&model.Post{}).Select("paid").Where("id = ?", postId).Update("paid", isPaid).Error
+// ReviewPost 只处理仍在待审核的帖子，防止重复审核
+func (db Gorm) ReviewPost(postId uint, status int) (bool, error) {
+	result := db.db.Model(&model.Post{}).
+		Where("id = ? AND status = ?", postId, model.PostPendingReview).
+		Update("status", status)
+	if result.Error != nil {
+		zlog.Error("审核帖子失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// VisiblePostIds 过滤出仍然公开的帖子：存在、没被隐藏、已发布
+func (db Gorm) VisiblePostIds(postIds []uint) ([]uint, error) {
+	var ids []uint
+	err := db.db.Model(&model.Post{}).
+		Where("id IN (?) AND hidden = ? AND status = ?", postIds, false, model.PostPublished).
+		Pluck("id", &ids).Error
 	if err != nil {
-		zlog.Error("更新付费文章失败", zap.Error(err))
+		zlog.Error("查询帖子状态失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+// visiblePosts 公开帖子ID的子查询，评论是否可见还要看所在的帖子
+func (db Gorm) visiblePosts() *gorm.DB {
+	return db.db.Model(&model.Post{}).Select("id").Where("hidden = ? AND status = ?", false, model.PostPublished)
+}
+
+// ScanPosts 按ID顺序分批取公开的帖子，重建搜索索引用
+func (db Gorm) ScanPosts(lastId uint, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := db.db.Select("id, user_id, title, content, paid, created_at").
+		Where("id > ? AND hidden = ? AND status = ?", lastId, false, model.PostPublished).
+		Order("id").
+		Limit(limit).
+		Find(&posts).Error
+	if err != nil {
+		zlog.Error("分批加载帖子失败", zap.Error(err))
+		return nil, err
+	}
+	return posts, nil
+}
+
+// ScanComments 只取公开帖子下的评论，重建搜索索引用
+func (db Gorm) ScanComments(lastId uint, limit int) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := db.db.Where("id > ? AND hidden = ? AND post_id IN (?)", lastId, false, db.visiblePosts()).
+		Order("id").
+		Limit(limit).
+		Find(&comments).Error
+	if err != nil {
+		zlog.Error("分批加载评论失败", zap.Error(err))
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (db Gorm) GetCommentsByIds(commentIds []uint) ([]model.Comment, error) {
+	var comments []model.Comment
+	if len(commentIds) == 0 {
+		return comments, nil
+	}
+	err := db.db.Preload("User").
+		Preload("User.UserProfile").
+		Where("id IN ? AND hidden = ?", commentIds, false).
+		Find(&comments).Error
+	if err != nil {
+		zlog.Error("查找评论失败", zap.Error(err))
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (db Gorm) SaveEmbedding(embedding *model.PostEmbedding) error {
+	err := db.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(embedding).Error
+	if err != nil {
+		zlog.Error("保存帖子向量失败", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (db Gorm) GetPoster(postId uint) (uint, error) {
-	var post model.Post
-	err := db.db.Where("id = ?", postId).First(&post).Error
+func (db Gorm) ScanEmbeddings(lastId uint, limit int) ([]model.PostEmbedding, error) {
+	var embeddings []model.PostEmbedding
+	err := db.db.Where("post_id > ?", lastId).
+		Order("post_id").
+		Limit(limit).
+		Find(&embeddings).Error
 	if err != nil {
-		zlog.Error("查找作者失败", zap.Error(err))
-		return 0, err
+		zlog.Error("分批加载帖子向量失败", zap.Error(err))
+		return nil, err
 	}
-	return post.UserID, nil
+	return embeddings, nil
+}
+
+func (db Gorm) DeleteEmbedding(postId uint) error {
+	err := db.db.Where("post_id = ?", postId).Delete(&model.PostEmbedding{}).Error
+	if err != nil {
+		zlog.Error("删除帖子向量失败", zap.Error(err))
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,133 @@
+package msq
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"commmunity/app/zlog"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Gorm也实现了search.Index，全文索引由MySQL自己维护，增删改不用额外处理
+
+func (db Gorm) IndexDocument(doc search.Document) error {
+	return nil
+}
+
+func (db Gorm) DeleteDocument(docType string, id uint) error {
+	return nil
+}
+
+type searchRow struct {
+	ID        uint
+	PostID    uint
+	AuthorID  uint
+	Title     string
+	Content   string
+	Paid      bool
+	CreatedAt time.Time
+	Score     float64
+}
+
+func (db Gorm) Search(query search.Query) (search.Result, error) {
+	var tx *gorm.DB
+	var match, columns, idColumn string
+	switch query.Type {
+	case search.TypePost:
+		tx = db.db.Model(&model.Post{}).Where("hidden = ? AND status = ?", false, model.PostPublished)
+		match = "MATCH (title, content) AGAINST (? IN NATURAL LANGUAGE MODE)"
+		columns = "id, 0 AS post_id, user_id AS author_id, title, content, paid, created_at, "
+		idColumn = "id"
+	case search.TypeComment:
+		tx = db.db.Model(&model.Comment{}).Where("hidden = ? AND post_id IN (?)", false, db.visiblePosts())
+		match = "MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)"
+		columns = "id, post_id, user_id AS author_id, '' AS title, content, false AS paid, created_at, "
+		idColumn = "id"
+	case search.TypeUser:
+		tx = db.db.Model(&model.UserProfile{}).
+			Where("user_id NOT IN (?)", db.db.Model(&model.User{}).Select("id").Where("anonymized = ?", true))
+		match = "MATCH (name, introduction) AGAINST (? IN NATURAL LANGUAGE MODE)"
+		columns = "user_id AS id, 0 AS post_id, user_id AS author_id, name AS title, introduction AS content, false AS paid, created_at, "
+		idColumn = "user_id"
+	default:
+		return search.Result{Hits: []search.Hit{}}, nil
+	}
+	tx = tx.Where(match, query.Keyword)
+	if query.AuthorID != 0 {
+		tx = tx.Where("user_id = ?", query.AuthorID)
+	}
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		zlog.Error("搜索计数失败", zap.String("type", query.Type), zap.Error(err))
+		return search.Result{}, err
+	}
+	tx = tx.Select(columns+match+" AS score", query.Keyword)
+	if query.Page.Cursor {
+		tx = cursorPage(tx, query.Page, idColumn)
+	} else {
+		tx = tx.Order("score desc").Order(idColumn + " desc").Offset(query.Page.Offset).Limit(query.Page.Limit)
+	}
+	var rows []searchRow
+	if err := tx.Scan(&rows).Error; err != nil {
+		zlog.Error("搜索失败", zap.String("type", query.Type), zap.Error(err))
+		return search.Result{}, err
+	}
+	terms := search.Terms(query.Keyword)
+	result := search.Result{Total: total, Hits: make([]search.Hit, len(rows))}
+	for i, r := range rows {
+		result.Hits[i] = search.Hit{
+			Type:      query.Type,
+			ID:        r.ID,
+			PostID:    r.PostID,
+			AuthorID:  r.AuthorID,
+			Score:     r.Score,
+			Title:     search.Highlight(r.Title, terms),
+			Snippet:   search.Snippet(search.Visible(r.Content, r.Paid), terms),
+			CreatedAt: r.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+// likePrefix 转义LIKE的通配符，只做前缀匹配，能走索引
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// SuggestPosts 标题前缀补全，点赞多的排前面
+func (db Gorm) SuggestPosts(prefix string, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := db.db.Select("id, title").
+		Where("title LIKE ? AND hidden = ? AND status = ?", likePrefix(prefix), false, model.PostPublished).
+		Order("like_count desc").
+		Limit(limit).
+		Find(&posts).Error
+	if err != nil {
+		zlog.Error("标题补全失败", zap.Error(err))
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (db Gorm) SuggestUsers(prefix string, limit int) ([]model.UserProfile, error) {
+	var profiles []model.UserProfile
+	err := db.db.Select("user_id, name, avatar").
+		Where("name LIKE ?", likePrefix(prefix)).
+		Where("user_id NOT IN (?)", db.db.Model(&model.User{}).Select("id").Where("anonymized = ?", true)).
+		Limit(limit).
+		Find(&profiles).Error
+	if err != nil {
+		zlog.Error("昵称补全失败", zap.Error(err))
+		return nil, err
+	}
+	return profiles, nil
+}
@@ -0,0 +1,53 @@
+package msq
+
+import (
+	"commmunity/app/internal/model"
+	"commmunity/app/zlog"
+
+	"go.uber.org/zap"
+)
+
+func (db Gorm) SaveUsage(usage *model.AIUsage) error {
+	err := db.db.Create(usage).Error
+	if err != nil {
+		zlog.Error("写入AI用量失败", zap.Uint("user_id", usage.UserID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// UsageReport 按用户、功能或日期汇总，按用户时只取费用最高的limit个
+func (db Gorm) UsageReport(query model.UsageQuery, limit int) ([]model.UsageStat, error) {
+	var key, order string
+	switch query.GroupBy {
+	case model.UsageByFeature:
+		key, order = "feature", "cost desc"
+	case model.UsageByDay:
+		key, order = "DATE_FORMAT(created_at, '%Y-%m-%d')", "`key`"
+	default:
+		key, order = "CAST(user_id AS CHAR)", "cost desc"
+	}
+	tx := db.db.Model(&model.AIUsage{}).
+		Select(key + " AS `key`, COUNT(*) AS calls, SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failed, " +
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, " +
+			"SUM(cost) AS cost, AVG(latency_ms) AS avg_latency_ms")
+	if query.UserID != 0 {
+		tx = tx.Where("user_id = ?", query.UserID)
+	}
+	if query.Feature != "" {
+		tx = tx.Where("feature = ?", query.Feature)
+	}
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+	var stats []model.UsageStat
+	err := tx.Group("`key`").Order(order).Limit(limit).Scan(&stats).Error
+	if err != nil {
+		zlog.Error("统计AI用量失败", zap.Error(err))
+		return nil, err
+	}
+	return stats, nil
+}
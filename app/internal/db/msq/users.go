@@ -4,20 +4,27 @@ import (
 	"commmunity/app/internal/model"
 	"commmunity/app/zlog"
 	"errors"
+	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
-func (db Gorm) CreateUser(account string, hash string, name string) error {
+func (db Gorm) CreateUser(account string, hash string, name string, email string) (uint, error) {
 	user := model.User{
 		Account: account,
 		Hash:    hash,
+		Email:   email,
 		UserProfile: model.UserProfile{
 			Name: name,
 		},
 	}
-	return db.db.Create(&user).Error
+	err := db.db.Create(&user).Error
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
 }
 
 func (db Gorm) GetProfile(account string) (model.User, error) {
@@ -50,14 +57,6 @@ func (db Gorm) GetUser(account string) (*model.User, error) {
 	return &user, nil
 }
 
-func (db Gorm) DeleteUser(account string) error {
-	var user model.User
-	if err := db.db.Where("account = ?", account).First(&user).Error; err != nil {
-		return err
-	}
-	return db.db.Unscoped().Select("UserProfile", "Posts").Delete(&user).Error
-}
-
 func (db Gorm) ChangePassword(account string, hash string) error {
 	user := model.User{
 		Account: account,
@@ -162,6 +161,41 @@ func (db Gorm) GetFollowers(userId uint) ([]model.User, error) {
 	return users, nil
 }
 
+// GetFollowerIds 按粉丝ID分批取，分发时间线用
+func (db Gorm) GetFollowerIds(userId uint, lastId uint, limit int) ([]uint, error) {
+	var ids []uint
+	err := db.db.Model(&model.UserRelation{}).
+		Where("followed_id = ? AND follower_id > ?", userId, lastId).
+		Order("follower_id asc").
+		Limit(limit).
+		Pluck("follower_id", &ids).Error
+	if err != nil {
+		zlog.Error("获取粉丝ID失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (db Gorm) GetFollowingIds(userId uint) ([]uint, error) {
+	var ids []uint
+	err := db.db.Model(&model.UserRelation{}).Where("follower_id = ?", userId).Pluck("followed_id", &ids).Error
+	if err != nil {
+		zlog.Error("查找关注失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (db Gorm) CountFollowers(userId uint) (int64, error) {
+	var count int64
+	err := db.db.Model(&model.UserRelation{}).Where("followed_id = ?", userId).Count(&count).Error
+	if err != nil {
+		zlog.Error("统计粉丝数失败", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
 func (db Gorm) GetFollowings(userId uint) ([]model.User, error) {
 	var users []model.User
 	me := model.User{Model: gorm.Model{ID: userId}}
@@ -191,3 +225,604 @@ func (db Gorm) SetVip(userId uint, vip bool) error {
 	}
 	return nil
 }
+
+func (db Gorm) GetUserIds(lastId uint, vipOnly bool, limit int) ([]uint, error) {
+	var ids []uint
+	query := db.db.Model(&model.User{}).Where("id > ?", lastId)
+	if vipOnly {
+		query = query.Where("vip = ?", true)
+	}
+	err := query.Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil {
+		zlog.Error("分批查找用户失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetUserByEmail 只按已验证的邮箱查找，未验证的邮箱可能同时填在多个账号上
+func (db Gorm) GetUserByEmail(email string) (*model.User, error) {
+	var user model.User
+	result := db.db.Where("verified_email = ?", email).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		zlog.Error("按邮箱查找用户失败", zap.Error(result.Error))
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+func (db Gorm) SetEmail(userId uint, email string) error {
+	err := db.db.Model(&model.User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"email": email, "email_verified": false, "verified_email": nil}).Error
+	if err != nil {
+		zlog.Error("绑定邮箱失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// 邮箱在发出验证邮件后被改掉，或已经被别的账号验证过的话，验证不生效
+func (db Gorm) VerifyEmail(userId uint, email string) (bool, error) {
+	var count int64
+	err := db.db.Model(&model.User{}).Where("verified_email = ? AND id <> ?", email, userId).Count(&count).Error
+	if err != nil {
+		zlog.Error("验证邮箱失败", zap.Error(err))
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	result := db.db.Model(&model.User{}).Where("id = ? AND email = ?", userId, email).
+		Updates(map[string]interface{}{"email_verified": true, "verified_email": email})
+	if result.Error != nil {
+		zlog.Error("验证邮箱失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) ResetPassword(userId uint, hash string) error {
+	err := db.db.Model(&model.User{}).Where("id = ?", userId).Update("hash", hash).Error
+	if err != nil {
+		zlog.Error("重置密码失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) SaveSecurityLog(log model.SecurityLog) {
+	err := db.db.Create(&log).Error
+	if err != nil {
+		zlog.Error("保存安全日志失败", zap.Error(err))
+		return
+	}
+}
+
+func (db Gorm) CreateSession(session *model.Session) error {
+	err := db.db.Create(session).Error
+	if err != nil {
+		zlog.Error("创建会话失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetSession(sessionId uint) (model.Session, error) {
+	var session model.Session
+	err := db.db.First(&session, sessionId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Session{}, nil
+		}
+		zlog.Error("查找会话失败", zap.Error(err))
+		return model.Session{}, err
+	}
+	return session, nil
+}
+
+// RotateSession 只有旧令牌仍是当前令牌时才轮换，并发刷新时只有一个能成功
+func (db Gorm) RotateSession(sessionId uint, oldJti string, newJti string, ip string) (bool, error) {
+	result := db.db.Model(&model.Session{}).
+		Where("id = ? AND current_jti = ? AND revoked_at IS NULL", sessionId, oldJti).
+		Updates(map[string]interface{}{"current_jti": newJti, "ip": ip, "last_used_at": time.Now()})
+	if result.Error != nil {
+		zlog.Error("轮换会话令牌失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (db Gorm) RevokeSession(sessionId uint) error {
+	err := db.db.Model(&model.Session{}).Where("id = ? AND revoked_at IS NULL", sessionId).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		zlog.Error("注销会话失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) RevokeUserSessions(userId uint) ([]uint, error) {
+	var ids []uint
+	err := db.db.Model(&model.Session{}).Where("user_id = ? AND revoked_at IS NULL", userId).Pluck("id", &ids).Error
+	if err != nil {
+		zlog.Error("查找用户会话失败", zap.Error(err))
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	err = db.db.Model(&model.Session{}).Where("id IN ?", ids).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		zlog.Error("注销用户全部会话失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (db Gorm) GetActiveSessions(userId uint, since time.Time) ([]model.Session, error) {
+	var sessions []model.Session
+	err := db.db.Where("user_id = ? AND revoked_at IS NULL AND last_used_at > ?", userId, since).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		zlog.Error("查找会话列表失败", zap.Error(err))
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (db Gorm) GetRoles() ([]model.Role, error) {
+	var roles []model.Role
+	err := db.db.Preload("Permissions").Order("id asc").Find(&roles).Error
+	if err != nil {
+		zlog.Error("查找角色失败", zap.Error(err))
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (db Gorm) SetRolePermissions(roleId int, permissions []string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", roleId).Delete(&model.RolePermission{}).Error; err != nil {
+			zlog.Error("清除角色权限失败", zap.Error(err))
+			return err
+		}
+		if len(permissions) == 0 {
+			return nil
+		}
+		rows := make([]model.RolePermission, 0, len(permissions))
+		for _, p := range permissions {
+			rows = append(rows, model.RolePermission{RoleID: roleId, Permission: p})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			zlog.Error("写入角色权限失败", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// SetUserRole 角色变更时版本号加一，旧token里的角色随之失效
+func (db Gorm) SetUserRole(userId uint, role int) error {
+	err := db.db.Model(&model.User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"role": role, "role_version": gorm.Expr("role_version + ?", 1)}).Error
+	if err != nil {
+		zlog.Error("修改用户角色失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetRoleVersion(userId uint) (int, int, error) {
+	var user model.User
+	err := db.db.Select("id, role, role_version").First(&user, userId).Error
+	if err != nil {
+		zlog.Error("查找用户角色失败", zap.Error(err))
+		return 0, 0, err
+	}
+	return user.Role, user.RoleVersion, nil
+}
+
+func (db Gorm) SetTotpSecret(userId uint, secret string) error {
+	err := db.db.Model(&model.User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": false}).Error
+	if err != nil {
+		zlog.Error("保存两步验证密钥失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) EnableTotp(userId uint, codeHashes []string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userId).Update("totp_enabled", true).Error; err != nil {
+			zlog.Error("开启两步验证失败", zap.Error(err))
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+			zlog.Error("清除旧恢复码失败", zap.Error(err))
+			return err
+		}
+		codes := make([]model.RecoveryCode, 0, len(codeHashes))
+		for _, h := range codeHashes {
+			codes = append(codes, model.RecoveryCode{UserID: userId, Hash: h})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			zlog.Error("保存恢复码失败", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+func (db Gorm) DisableTotp(userId uint) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false}).Error
+		if err != nil {
+			zlog.Error("关闭两步验证失败", zap.Error(err))
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+func (db Gorm) GetRecoveryCodes(userId uint) ([]model.RecoveryCode, error) {
+	var codes []model.RecoveryCode
+	err := db.db.Where("user_id = ? AND used_at IS NULL", userId).Find(&codes).Error
+	if err != nil {
+		zlog.Error("查找恢复码失败", zap.Error(err))
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (db Gorm) UseRecoveryCode(codeId uint) (bool, error) {
+	result := db.db.Model(&model.RecoveryCode{}).Where("id = ? AND used_at IS NULL", codeId).Update("used_at", time.Now())
+	if result.Error != nil {
+		zlog.Error("使用恢复码失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseTotpStep 时间步只能往前走，同一个验证码或更早的验证码再用一次会失败
+func (db Gorm) UseTotpStep(userId uint, step int64) (bool, error) {
+	result := db.db.Model(&model.User{}).Where("id = ? AND totp_last_step < ?", userId, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		zlog.Error("记录验证码时间步失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ScheduleDeletion at为空表示撤销注销申请
+func (db Gorm) ScheduleDeletion(userId uint, at *time.Time) error {
+	err := db.db.Model(&model.User{}).Where("id = ? AND anonymized = ?", userId, false).Update("deletion_at", at).Error
+	if err != nil {
+		zlog.Error("更新注销时间失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetDueDeletions(now time.Time, limit int) ([]model.User, error) {
+	var users []model.User
+	err := db.db.Where("deletion_at <= ? AND anonymized = ?", now, false).Order("id asc").Limit(limit).Find(&users).Error
+	if err != nil {
+		zlog.Error("查找到期注销用户失败", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+// AnonymizeUser 保留用户行作为占位，帖子评论仍能关联到"已注销用户"，返回其帖子ID用于清缓存
+func (db Gorm) AnonymizeUser(userId uint) ([]uint, error) {
+	var postIds []uint
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+			"account":        fmt.Sprintf("deleted_%d", userId),
+			"hash":           "",
+			"email":          "",
+			"email_verified": false,
+			"verified_email": nil,
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"vip":            false,
+			"role":           model.RoleUser,
+			"role_version":   gorm.Expr("role_version + ?", 1),
+			"anonymized":     true,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.UserProfile{}).Where("user_id = ?", userId).Updates(map[string]interface{}{
+			"name":         "已注销用户",
+			"introduction": "",
+			"avatar":       "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("follower_id = ? OR followed_id = ?", userId, userId).Delete(&model.UserRelation{}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("user_id = ?", userId).Delete(&model.Notice{}).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("user_id = ?", userId).Delete(&model.AccessToken{}).Error; err != nil {
+			return err
+		}
+		if err = tx.Unscoped().Where("user_id = ?", userId).Delete(&model.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Post{}).Where("user_id = ?", userId).Pluck("id", &postIds).Error
+	})
+	if err != nil {
+		zlog.Error("匿名化用户失败", zap.Uint("userId", userId), zap.Error(err))
+		return nil, err
+	}
+	return postIds, nil
+}
+
+func (db Gorm) CreateAccessToken(token *model.AccessToken) error {
+	err := db.db.Create(token).Error
+	if err != nil {
+		zlog.Error("创建访问令牌失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) CountAccessTokens(userId uint) (int64, error) {
+	var count int64
+	err := db.db.Model(&model.AccessToken{}).Where("user_id = ? AND revoked_at IS NULL", userId).Count(&count).Error
+	if err != nil {
+		zlog.Error("统计访问令牌失败", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db Gorm) GetAccessTokens(userId uint) ([]model.AccessToken, error) {
+	var tokens []model.AccessToken
+	err := db.db.Where("user_id = ? AND revoked_at IS NULL", userId).Order("id desc").Find(&tokens).Error
+	if err != nil {
+		zlog.Error("查找访问令牌失败", zap.Error(err))
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (db Gorm) GetAccessTokenByHash(hash string) (model.AccessToken, error) {
+	var token model.AccessToken
+	err := db.db.Preload("User").Where("hash = ?", hash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.AccessToken{}, nil
+		}
+		zlog.Error("查找访问令牌失败", zap.Error(err))
+		return model.AccessToken{}, err
+	}
+	return token, nil
+}
+
+func (db Gorm) RevokeAccessToken(userId uint, tokenId uint) (bool, error) {
+	result := db.db.Model(&model.AccessToken{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenId, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		zlog.Error("撤销访问令牌失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// TouchAccessToken 最近使用时间精确到分钟就够了，避免每个请求都写库
+func (db Gorm) TouchAccessToken(tokenId uint, now time.Time) error {
+	err := db.db.Model(&model.AccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tokenId, now.Add(-time.Minute)).
+		Update("last_used_at", now).Error
+	if err != nil {
+		zlog.Error("更新令牌使用时间失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (db Gorm) GetUserById(userId uint) (*model.User, error) {
+	var user model.User
+	err := db.db.First(&user, userId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		zlog.Error("找用户时出错了", zap.Error(err))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateIdentity 同一个第三方账号已经绑定过时返回false
+func (db Gorm) CreateIdentity(identity *model.UserIdentity) (bool, error) {
+	var count int64
+	err := db.db.Model(&model.UserIdentity{}).
+		Where("(provider = ? AND subject = ?) OR (provider = ? AND user_id = ?)", identity.Provider, identity.Subject, identity.Provider, identity.UserID).
+		Count(&count).Error
+	if err != nil {
+		zlog.Error("查找第三方身份失败", zap.Error(err))
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	err = db.db.Create(identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return false, nil
+		}
+		zlog.Error("绑定第三方身份失败", zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+func (db Gorm) GetIdentity(provider string, subject string) (model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := db.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.UserIdentity{}, nil
+		}
+		zlog.Error("查找第三方身份失败", zap.Error(err))
+		return model.UserIdentity{}, err
+	}
+	return identity, nil
+}
+
+func (db Gorm) GetIdentities(userId uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := db.db.Where("user_id = ?", userId).Order("id asc").Find(&identities).Error
+	if err != nil {
+		zlog.Error("查找第三方身份失败", zap.Error(err))
+		return nil, err
+	}
+	return identities, nil
+}
+
+// DeleteIdentity 硬删除，解绑后同一个第三方账号还能重新绑定
+func (db Gorm) DeleteIdentity(userId uint, provider string) (bool, error) {
+	result := db.db.Unscoped().Where("user_id = ? AND provider = ?", userId, provider).Delete(&model.UserIdentity{})
+	if result.Error != nil {
+		zlog.Error("解绑第三方身份失败", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ScanUsers 按ID顺序分批取未注销的用户，重建搜索索引用
+func (db Gorm) ScanUsers(lastId uint, limit int) ([]model.User, error) {
+	var users []model.User
+	err := db.db.Preload("UserProfile").
+		Where("id > ? AND anonymized = ?", lastId, false).
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		zlog.Error("分批加载用户失败", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+func (db Gorm) GetUsersByIds(userIds []uint) ([]model.User, error) {
+	var users []model.User
+	if len(userIds) == 0 {
+		return users, nil
+	}
+	err := db.db.Preload("UserProfile").
+		Where("id IN ? AND anonymized = ?", userIds, false).
+		Find(&users).Error
+	if err != nil {
+		zlog.Error("查找用户失败", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+type followerCount struct {
+	FollowedID uint
+	Count      int64
+}
+
+// CountFollowersByIds 批量统计粉丝数，没有粉丝的用户不在结果里
+func (db Gorm) CountFollowersByIds(userIds []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(userIds))
+	if len(userIds) == 0 {
+		return counts, nil
+	}
+	var rows []followerCount
+	err := db.db.Model(&model.UserRelation{}).
+		Select("followed_id, COUNT(*) AS count").
+		Where("followed_id IN ?", userIds).
+		Group("followed_id").
+		Scan(&rows).Error
+	if err != nil {
+		zlog.Error("统计粉丝数失败", zap.Error(err))
+		return nil, err
+	}
+	for _, r := range rows {
+		counts[r.FollowedID] = r.Count
+	}
+	return counts, nil
+}
+
+// FollowingAmong userIds里哪些已经被followerId关注
+func (db Gorm) FollowingAmong(followerId uint, userIds []uint) ([]uint, error) {
+	var ids []uint
+	if len(userIds) == 0 {
+		return ids, nil
+	}
+	err := db.db.Model(&model.UserRelation{}).
+		Where("follower_id = ? AND followed_id IN ?", followerId, userIds).
+		Pluck("followed_id", &ids).Error
+	if err != nil {
+		zlog.Error("判断是否关注失败", zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+// CreatorStats 粉丝最多的limit个作者，加上since之后发过帖的作者
+func (db Gorm) CreatorStats(since time.Time, limit int) ([]model.CreatorStat, error) {
+	var engagement []model.CreatorStat
+	err := db.db.Model(&model.Post{}).
+		Select("user_id, SUM(like_count) AS likes, SUM(comment_count) AS comments, SUM(view_count) AS views").
+		Where("created_at >= ? AND hidden = ? AND status = ?", since, false, model.PostPublished).
+		Group("user_id").
+		Scan(&engagement).Error
+	if err != nil {
+		zlog.Error("统计作者互动数据失败", zap.Error(err))
+		return nil, err
+	}
+	var top []followerCount
+	err = db.db.Model(&model.UserRelation{}).
+		Select("followed_id, COUNT(*) AS count").
+		Group("followed_id").
+		Order("count desc").
+		Limit(limit).
+		Scan(&top).Error
+	if err != nil {
+		zlog.Error("统计粉丝数失败", zap.Error(err))
+		return nil, err
+	}
+	stats := make(map[uint]*model.CreatorStat, len(engagement)+len(top))
+	for i := range engagement {
+		stats[engagement[i].UserID] = &engagement[i]
+	}
+	for _, t := range top {
+		if _, ok := stats[t.FollowedID]; !ok {
+			stats[t.FollowedID] = &model.CreatorStat{UserID: t.FollowedID}
+		}
+	}
+	ids := make([]uint, 0, len(stats))
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	counts, err := db.CountFollowersByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.CreatorStat, 0, len(stats))
+	for id, s := range stats {
+		s.Followers = counts[id]
+		result = append(result, *s)
+	}
+	return result, nil
+}
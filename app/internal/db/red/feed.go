@@ -0,0 +1,214 @@
+package red
+
+import (
+	"commmunity/app/zlog"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	timelineTTL = 7 * 24 * time.Hour
+	outboxTTL   = 30 * 24 * time.Hour
+	bigVKey     = "feed:bigv"
+)
+
+// 时间线和发件箱都用帖子ID做分数，ID自增，天然按发布时间排序；
+// 成员0是占位，表示这个key已经建好，哪怕一个帖子都没有
+const placeholder = "0"
+
+func timelineKey(userId uint) string {
+	return fmt.Sprintf("timeline:%d", userId)
+}
+
+func outboxKey(userId uint) string {
+	return fmt.Sprintf("outbox:%d", userId)
+}
+
+// exists 以占位成员为准：分发时恰好赶上过期，key会被重新建出来但没有占位，读取时照样当作不存在去重建
+func (rdb Redis) exists(key string) (bool, error) {
+	err := rdb.redis.ZScore(rdb.context, key, placeholder).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		zlog.Error("查找缓存失败", zap.String("key", key), zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+func (rdb Redis) addIds(key string, postIds []uint, size int, ttl time.Duration) error {
+	members := make([]redis.Z, 0, len(postIds)+1)
+	members = append(members, redis.Z{Score: 0, Member: placeholder})
+	for _, id := range postIds {
+		members = append(members, redis.Z{Score: float64(id), Member: id})
+	}
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(rdb.context, key, members...)
+		pipe.ZRemRangeByRank(rdb.context, key, 0, int64(-size-2))
+		pipe.Expire(rdb.context, key, ttl)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("写入时间线失败", zap.String("key", key), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) rangeIds(key string, beforeId uint, limit int) ([]uint, error) {
+	max := "+inf"
+	if beforeId > 0 {
+		max = "(" + strconv.FormatUint(uint64(beforeId), 10)
+	}
+	members, err := rdb.redis.ZRevRangeByScore(rdb.context, key, &redis.ZRangeBy{
+		Min:   "(0",
+		Max:   max,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		zlog.Error("读取时间线失败", zap.String("key", key), zap.Error(err))
+		return nil, err
+	}
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func (rdb Redis) TimelineExists(userId uint) (bool, error) {
+	return rdb.exists(timelineKey(userId))
+}
+
+func (rdb Redis) AddTimeline(userId uint, postIds []uint, size int) error {
+	return rdb.addIds(timelineKey(userId), postIds, size, timelineTTL)
+}
+
+// FanoutTimeline 只往已经建好的时间线里写，不活跃用户的时间线过期后等下次读取时再重建。
+// 每条命令只碰一个key，先批量查占位再批量写，分片部署下不会跨slot
+func (rdb Redis) FanoutTimeline(userIds []uint, postIds []uint, size int) error {
+	if len(userIds) == 0 || len(postIds) == 0 {
+		return nil
+	}
+	checks := make([]*redis.FloatCmd, len(userIds))
+	_, err := rdb.redis.Pipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		for i, id := range userIds {
+			checks[i] = pipe.ZScore(rdb.context, timelineKey(id), placeholder)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		zlog.Error("分发时间线失败", zap.Uints("postIds", postIds), zap.Error(err))
+		return err
+	}
+	members := make([]redis.Z, len(postIds))
+	for i, id := range postIds {
+		members[i] = redis.Z{Score: float64(id), Member: id}
+	}
+	_, err = rdb.redis.Pipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		for i, id := range userIds {
+			if checks[i].Err() != nil {
+				continue
+			}
+			key := timelineKey(id)
+			pipe.ZAdd(rdb.context, key, members...)
+			pipe.ZRemRangeByRank(rdb.context, key, 0, int64(-size-2))
+		}
+		return nil
+	})
+	if err != nil {
+		zlog.Error("分发时间线失败", zap.Uints("postIds", postIds), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) RemoveTimeline(userId uint, postIds []uint) error {
+	if len(postIds) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(postIds))
+	for i, id := range postIds {
+		members[i] = id
+	}
+	err := rdb.redis.ZRem(rdb.context, timelineKey(userId), members...).Err()
+	if err != nil {
+		zlog.Error("清理时间线失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetTimeline 读取时顺便续期，长期不看的用户时间线自然过期
+func (rdb Redis) GetTimeline(userId uint, beforeId uint, limit int) ([]uint, error) {
+	key := timelineKey(userId)
+	ids, err := rdb.rangeIds(key, beforeId, limit)
+	if err != nil {
+		return nil, err
+	}
+	_ = rdb.redis.Expire(rdb.context, key, timelineTTL).Err()
+	return ids, nil
+}
+
+func (rdb Redis) OutboxExists(userId uint) (bool, error) {
+	return rdb.exists(outboxKey(userId))
+}
+
+func (rdb Redis) AddOutbox(userId uint, postIds []uint, size int) error {
+	return rdb.addIds(outboxKey(userId), postIds, size, outboxTTL)
+}
+
+func (rdb Redis) RemoveOutbox(userId uint, postId uint) error {
+	err := rdb.redis.ZRem(rdb.context, outboxKey(userId), postId).Err()
+	if err != nil {
+		zlog.Error("清理发件箱失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetOutbox(userId uint, beforeId uint, limit int) ([]uint, error) {
+	return rdb.rangeIds(outboxKey(userId), beforeId, limit)
+}
+
+// SetBigV 返回名单是否有变化
+func (rdb Redis) SetBigV(userId uint, bigV bool) (bool, error) {
+	var n int64
+	var err error
+	if bigV {
+		n, err = rdb.redis.SAdd(rdb.context, bigVKey, userId).Result()
+	} else {
+		n, err = rdb.redis.SRem(rdb.context, bigVKey, userId).Result()
+	}
+	if err != nil {
+		zlog.Error("更新大V名单失败", zap.Uint("userId", userId), zap.Error(err))
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (rdb Redis) GetBigVs() ([]uint, error) {
+	members, err := rdb.redis.SMembers(rdb.context, bigVKey).Result()
+	if err != nil {
+		zlog.Error("获取大V名单失败", zap.Error(err))
+		return nil, err
+	}
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -1,7 +1,6 @@
 package red
 
 import (
-	"commmunity/app/internal/model"
 	"context"
 	"time"
 
@@ -11,6 +10,7 @@ import (
 type UserRedis interface {
 	AddToBlacklist(tokenString string, expiration time.Duration) error
 	IsInBlacklist(tokenString string) bool
+	RemoveFromBlacklist(tokenString string) error
 	UserProfile(userId uint, userDetail interface{}) error
 	GetUserCache(userId uint) (string, error)
 	DelUserCache(userId uint) error
@@ -20,6 +20,23 @@ type UserRedis interface {
 	SetFollowingsCache(account string, followings interface{}) error
 	GetFollowingsCache(account string) (string, error)
 	DelFollowingsCache(account string) error
+	SetOnceToken(purpose string, token string, value string, expiration time.Duration) error
+	ConsumeOnceToken(purpose string, token string) (string, error)
+	IncrLoginFail(target string, window time.Duration) (int64, error)
+	ClearLoginFail(target string) error
+	LockLogin(target string, expiration time.Duration) error
+	LoginLockTTL(target string) (time.Duration, error)
+	UnlockLogin(target string) error
+	RevokeSession(sessionId uint, expiration time.Duration) error
+	IsSessionRevoked(sessionId uint) bool
+	GetOnceToken(purpose string, token string) (string, error)
+	SetRoleCache(userId uint, role int, version int) error
+	GetRoleCache(userId uint) (int, int, bool, error)
+	DelRoleCache(userId uint) error
+	SetCreatorRank(scores []redis.Z) error
+	GetCreatorRank(limit int) ([]redis.Z, error)
+	MarkBansSynced() error
+	BansSynced() (bool, error)
 }
 
 type PostRedis interface {
@@ -33,21 +50,71 @@ type PostRedis interface {
 	LimitView(key string) (bool, error)
 	View(key string) error
 	ViewCount(key string) (int, error)
-	HotRank(posts []model.Post) error
-	GetHotRank() ([]redis.Z, error)
+	RebuildHotRank(points map[uint]float64, created map[uint]int64, ranks map[string][]redis.Z, size int, ref int64) error
+	TrackHot(postId uint, created int64) error
+	BumpHot(postId uint, delta float64) (float64, int64, int64, error)
+	SetHotScores(postId uint, scores map[string]float64) error
+	RemoveHot(postId uint, windows []string) error
+	GetHotRank(window string, limit int) ([]redis.Z, error)
 	SetPostCache(postId uint, postDetail interface{}) error
 	GetPostCache(postId uint) (string, error)
 	DelPostCache(postId uint) error
-	SetPostListCache(offset, pageSize int, posts interface{}) error
-	GetPostListCache(offset, pageSize int) (string, error)
-	SetFollowingPostsCache(account string, offset, pageSize int, posts interface{}) error
-	GetFollowingPostsCache(account string, offset, pageSize int) (string, error)
+	SetPostListCache(page string, pageSize int, posts interface{}) error
+	GetPostListCache(page string, pageSize int) (string, error)
+	DelPostListCache() error
 	SetSummaryCache(postId uint, summary string) error
 	GetSummaryCache(postId uint) (string, error)
 }
 
+type FeedRedis interface {
+	TimelineExists(userId uint) (bool, error)
+	AddTimeline(userId uint, postIds []uint, size int) error
+	FanoutTimeline(userIds []uint, postIds []uint, size int) error
+	RemoveTimeline(userId uint, postIds []uint) error
+	GetTimeline(userId uint, beforeId uint, limit int) ([]uint, error)
+	OutboxExists(userId uint) (bool, error)
+	AddOutbox(userId uint, postIds []uint, size int) error
+	RemoveOutbox(userId uint, postId uint) error
+	GetOutbox(userId uint, beforeId uint, limit int) ([]uint, error)
+	SetBigV(userId uint, bigV bool) (bool, error)
+	GetBigVs() ([]uint, error)
+}
+
+type SearchRedis interface {
+	RecordHotSearch(userId uint, query string) error
+	DecayHotSearch(factor float64, min float64, size int) error
+	GetHotSearch(limit int) ([]redis.Z, error)
+	AddSearchHistory(userId uint, query string) error
+	GetSearchHistory(userId uint) ([]string, error)
+	DelSearchHistory(userId uint, query string) error
+}
+
+type RecommendRedis interface {
+	TrackLike(account string, postId uint, like bool) error
+	GetLiked(account string, limit int) ([]uint, error)
+	GetAllLiked(account string) ([]uint, error)
+	DelLiked(account string) error
+	LikedIndexReady() (bool, error)
+	IndexLikes(postId uint) error
+	MarkLikedIndexReady() error
+	GetLikers(postId uint, count int) ([]string, error)
+	MarkRecommendActive(userId uint) error
+	GetRecommendActive(since time.Time) ([]uint, error)
+	CandidatesExist(userId uint) (bool, error)
+	SetCandidates(userId uint, scores map[uint]float64, reasons map[uint]string) error
+	PopCandidates(userId uint, count int) ([]uint, map[uint]string, error)
+	MarkSeen(userId uint, postIds []uint) error
+	FilterSeen(userId uint, postIds []uint) ([]uint, error)
+}
+
+type QuotaRedis interface {
+	ReserveQuota(userId uint, now time.Time, dailyLimit int, monthlyLimit int) (int64, int64, bool, error)
+	RefundQuota(userId uint, now time.Time) error
+	GetQuotaUsed(userId uint, now time.Time) (int64, int64, error)
+}
+
 type MessageRedis interface {
-	SetMessageCache(userId1 uint, userId2 uint, value interface{}, offset, pageSize int) error
-	GetMessageCache(userId1 uint, userId2 uint, offset int, pageSize int) (string, error)
+	SetMessageCache(userId1 uint, userId2 uint, value interface{}, page string, pageSize int) error
+	GetMessageCache(userId1 uint, userId2 uint, page string, pageSize int) (string, error)
 	DelMessageCache(userId1 uint, userId2 uint) error
 }
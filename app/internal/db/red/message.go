@@ -12,9 +12,9 @@ import (
 	"go.uber.org/zap"
 )
 
-func (rdb Redis) SetMessageCache(userId1 uint, userId2 uint, value interface{}, offset, pageSize int) error {
-	key := fmt.Sprintf("message_cache:%d:%d:%d:%d", userId1, userId2, offset, pageSize)
-	key1 := fmt.Sprintf("message_cache:%d:%d:%d:%d", userId2, userId1, offset, pageSize)
+func (rdb Redis) SetMessageCache(userId1 uint, userId2 uint, value interface{}, page string, pageSize int) error {
+	key := fmt.Sprintf("message_cache:%d:%d:%s:%d", userId1, userId2, page, pageSize)
+	key1 := fmt.Sprintf("message_cache:%d:%d:%s:%d", userId2, userId1, page, pageSize)
 	data, err := json.Marshal(value)
 	if err != nil {
 		zlog.Error("JSON序列化失败", zap.Error(err))
@@ -33,8 +33,8 @@ func (rdb Redis) SetMessageCache(userId1 uint, userId2 uint, value interface{},
 	return nil
 }
 
-func (rdb Redis) GetMessageCache(userId1 uint, userId2 uint, offset int, pageSize int) (string, error) {
-	key := fmt.Sprintf("message_cache:%d:%d:%d:%d", userId1, userId2, offset, pageSize)
+func (rdb Redis) GetMessageCache(userId1 uint, userId2 uint, page string, pageSize int) (string, error) {
+	key := fmt.Sprintf("message_cache:%d:%d:%s:%d", userId1, userId2, page, pageSize)
 	data, err := rdb.redis.Get(rdb.context, key).Result()
 	if err != nil {
 		if !errors.Is(err, redis.Nil) {
@@ -46,29 +46,15 @@ func (rdb Redis) GetMessageCache(userId1 uint, userId2 uint, offset int, pageSiz
 	return data, nil
 }
 
+// DelMessageCache 新消息只影响offset页和游标第一页，但被隐藏、删除的私信可能在任意一页，所以游标页全部删掉；
+// 游标页的key是"c"加游标，第一页就是"c"
 func (rdb Redis) DelMessageCache(userId1 uint, userId2 uint) error {
-	pattern := fmt.Sprintf("message_cache:%d:%d:*", userId1, userId2)
-	iter := rdb.redis.Scan(rdb.context, 0, pattern, 0).Iterator()
-	if err := iter.Err(); err != nil {
-		zlog.Error("遍历缓存key失败", zap.Error(err))
-		return err
-	}
-	for iter.Next(rdb.context) {
-		err := rdb.redis.Del(rdb.context, iter.Val()).Err()
-		if err != nil {
-			zlog.Error("删除缓存失败", zap.Error(err), zap.String("key", iter.Val()))
+	for _, pair := range [][2]uint{{userId1, userId2}, {userId2, userId1}} {
+		if err := rdb.delKeys(fmt.Sprintf("message_cache:%d:%d:[0-9]*", pair[0], pair[1])); err != nil {
+			return err
 		}
-	}
-	pattern2 := fmt.Sprintf("message_cache:%d:%d:*", userId2, userId1)
-	iter2 := rdb.redis.Scan(rdb.context, 0, pattern2, 0).Iterator()
-	if err := iter2.Err(); err != nil {
-		zlog.Error("遍历缓存key失败", zap.Error(err))
-		return err
-	}
-	for iter2.Next(rdb.context) {
-		err := rdb.redis.Del(rdb.context, iter2.Val()).Err()
-		if err != nil {
-			zlog.Error("删除缓存失败", zap.Error(err), zap.String("key", iter2.Val()))
+		if err := rdb.delKeys(fmt.Sprintf("message_cache:%d:%d:c*", pair[0], pair[1])); err != nil {
+			return err
 		}
 	}
 	return nil
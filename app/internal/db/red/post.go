@@ -1,7 +1,6 @@
 package red
 
 import (
-	"commmunity/app/internal/model"
 	"commmunity/app/utils"
 	"commmunity/app/zlog"
 	"context"
@@ -101,27 +100,125 @@ func (rdb Redis) ViewCount(key string) (int, error) {
 	return count, nil
 }
 
-func (rdb Redis) HotRank(posts []model.Post) error {
-	var zMembers []redis.Z
-	for _, post := range posts {
-		score := float64(post.LikeCount)*1.5 + float64(post.CommentCount)*1 + float64(post.ViewCount)*0.1
-		zMembers = append(zMembers, redis.Z{
-			Score:  score,
-			Member: post.ID,
-		})
+const (
+	hotPointsKey  = "rank:hot:points"
+	hotCreatedKey = "rank:hot:created"
+	hotRefKey     = "rank:hot:ref"
+)
+
+func hotRankKey(window string) string {
+	return "rank:hot:" + window
+}
+
+// RebuildHotRank 先写临时key再一次性rename，已删除或过期的帖子随旧key一起消失；ref是这次算分用的时间，增量更新沿用它
+func (rdb Redis) RebuildHotRank(points map[uint]float64, created map[uint]int64, ranks map[string][]redis.Z, size int, ref int64) error {
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.Del(rdb.context, "rank:hot", hotPointsKey, hotCreatedKey) // rank:hot是旧版本的榜单
+		pipe.Set(rdb.context, hotRefKey, ref, 0)
+		if len(points) > 0 {
+			pointValues := make(map[string]interface{}, len(points))
+			createdValues := make(map[string]interface{}, len(created))
+			for id, p := range points {
+				pointValues[strconv.FormatUint(uint64(id), 10)] = p
+			}
+			for id, t := range created {
+				createdValues[strconv.FormatUint(uint64(id), 10)] = t
+			}
+			pipe.HSet(rdb.context, hotPointsKey, pointValues)
+			pipe.HSet(rdb.context, hotCreatedKey, createdValues)
+		}
+		for window, members := range ranks {
+			key := hotRankKey(window)
+			pipe.Del(rdb.context, key)
+			if len(members) == 0 {
+				continue
+			}
+			pipe.ZAdd(rdb.context, key, members...)
+			pipe.ZRemRangeByRank(rdb.context, key, 0, int64(-size-1))
+		}
+		return nil
+	})
+	if err != nil {
+		zlog.Error("重建热度榜失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// TrackHot 新发布的帖子加入热度统计，等下一次点赞评论浏览再算分
+func (rdb Redis) TrackHot(postId uint, created int64) error {
+	field := strconv.FormatUint(uint64(postId), 10)
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(rdb.context, hotCreatedKey, field, created)
+		pipe.HSetNX(rdb.context, hotPointsKey, field, 0)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("加入热度统计失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// BumpHot 累加原始热度，返回累加后的值、发布时间和上次重算用的时间，不在统计范围内的帖子发布时间返回0，还没重算过时间返回0
+func (rdb Redis) BumpHot(postId uint, delta float64) (float64, int64, int64, error) {
+	field := strconv.FormatUint(uint64(postId), 10)
+	created, err := rdb.redis.HGet(rdb.context, hotCreatedKey, field).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, 0, 0, nil
+		}
+		zlog.Error("查找帖子发布时间失败", zap.Error(err))
+		return 0, 0, 0, err
+	}
+	points, err := rdb.redis.HIncrByFloat(rdb.context, hotPointsKey, field, delta).Result()
+	if err != nil {
+		zlog.Error("累加热度失败", zap.Error(err))
+		return 0, 0, 0, err
+	}
+	ref, err := rdb.redis.Get(rdb.context, hotRefKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		zlog.Error("查找热度榜重算时间失败", zap.Error(err))
+		return 0, 0, 0, err
 	}
-	err := rdb.redis.ZAdd(rdb.context, "rank:hot", zMembers...).Err()
+	return points, created, ref, nil
+}
+
+func (rdb Redis) SetHotScores(postId uint, scores map[string]float64) error {
+	_, err := rdb.redis.Pipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		for window, score := range scores {
+			pipe.ZAdd(rdb.context, hotRankKey(window), redis.Z{Score: score, Member: postId})
+		}
+		return nil
+	})
+	if err != nil {
+		zlog.Error("更新热度分数失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) RemoveHot(postId uint, windows []string) error {
+	field := strconv.FormatUint(uint64(postId), 10)
+	_, err := rdb.redis.Pipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		for _, window := range windows {
+			pipe.ZRem(rdb.context, hotRankKey(window), field)
+		}
+		pipe.HDel(rdb.context, hotPointsKey, field)
+		pipe.HDel(rdb.context, hotCreatedKey, field)
+		return nil
+	})
 	if err != nil {
-		zlog.Error("存入热度缓存失败", zap.Error(err))
+		zlog.Error("移出热度榜失败", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (rdb Redis) GetHotRank() ([]redis.Z, error) {
-	results, err := rdb.redis.ZRevRangeWithScores(rdb.context, "rank:hot", 0, 9).Result()
+func (rdb Redis) GetHotRank(window string, limit int) ([]redis.Z, error) {
+	results, err := rdb.redis.ZRevRangeWithScores(rdb.context, hotRankKey(window), 0, int64(limit-1)).Result()
 	if err != nil {
-		zlog.Error("提取热度前10失败", zap.Error(err))
+		zlog.Error("提取热度榜失败", zap.Error(err))
 		return nil, err
 	}
 	return results, err
@@ -169,8 +266,9 @@ func (rdb Redis) DelPostCache(postId uint) error {
 	return nil
 }
 
-func (rdb Redis) GetPostListCache(offset, pageSize int) (string, error) {
-	key := fmt.Sprintf("post:list:%d:%d", offset, pageSize)
+// 列表缓存的page部分：offset模式是数字；游标模式是"c"加游标，第一页就是"c"
+func (rdb Redis) GetPostListCache(page string, pageSize int) (string, error) {
+	key := fmt.Sprintf("post:list:%s:%d", page, pageSize)
 	data, err := rdb.redis.Get(rdb.context, key).Result()
 	if err != nil {
 		if !errors.Is(err, redis.Nil) {
@@ -182,8 +280,8 @@ func (rdb Redis) GetPostListCache(offset, pageSize int) (string, error) {
 	return data, nil
 }
 
-func (rdb Redis) SetPostListCache(offset, pageSize int, posts interface{}) error {
-	key := fmt.Sprintf("post:list:%d:%d", offset, pageSize)
+func (rdb Redis) SetPostListCache(page string, pageSize int, posts interface{}) error {
+	key := fmt.Sprintf("post:list:%s:%d", page, pageSize)
 	data, err := json.Marshal(posts)
 	if err != nil {
 		zlog.Error("JSON序列化失败", zap.Error(err))
@@ -197,32 +295,29 @@ func (rdb Redis) SetPostListCache(offset, pageSize int, posts interface{}) error
 	return nil
 }
 
-func (rdb Redis) SetFollowingPostsCache(account string, offset, pageSize int, posts interface{}) error {
-	key := fmt.Sprintf("following:posts:%s:%d:%d", account, offset, pageSize)
-	data, err := json.Marshal(posts)
-	if err != nil {
-		zlog.Error("JSON序列化失败", zap.Error(err))
-		return err
+// delKeys 按通配符删除缓存
+func (rdb Redis) delKeys(pattern string) error {
+	iter := rdb.redis.Scan(rdb.context, 0, pattern, 0).Iterator()
+	for iter.Next(rdb.context) {
+		err := rdb.redis.Del(rdb.context, iter.Val()).Err()
+		if err != nil {
+			zlog.Error("删除缓存失败", zap.Error(err), zap.String("key", iter.Val()))
+		}
 	}
-	err = rdb.redis.Set(rdb.context, key, data, 3*time.Minute+utils.RandomDuration(1)).Err()
-	if err != nil {
-		zlog.Error("建立动态列表缓存失败", zap.Error(err))
+	if err := iter.Err(); err != nil {
+		zlog.Error("遍历缓存key失败", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (rdb Redis) GetFollowingPostsCache(account string, offset, pageSize int) (string, error) {
-	key := fmt.Sprintf("following:posts:%s:%d:%d", account, offset, pageSize)
-	data, err := rdb.redis.Get(rdb.context, key).Result()
-	if err != nil {
-		if !errors.Is(err, redis.Nil) {
-			zlog.Error("获取动态列表缓存失败", zap.Error(err))
-			return "", err
-		}
-		return "", nil
+// DelPostListCache 发帖时offset页整体后移、游标第一页多出一条；删帖、隐藏的帖子可能在任意一页，
+// 所以offset页和所有游标页都要删。游标页的key是"c"加游标，第一页就是"c"
+func (rdb Redis) DelPostListCache() error {
+	if err := rdb.delKeys("post:list:[0-9]*"); err != nil {
+		return err
 	}
-	return data, nil
+	return rdb.delKeys("post:list:c*")
 }
 
 func (rdb Redis) SetSummaryCache(postId uint, summary string) error {
@@ -0,0 +1,71 @@
+package red
+
+import (
+	"commmunity/app/zlog"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func quotaKeys(userId uint, now time.Time) (string, string) {
+	return fmt.Sprintf("ai:quota:%d:d:%s", userId, now.Format("20060102")),
+		fmt.Sprintf("ai:quota:%d:m:%s", userId, now.Format("200601"))
+}
+
+// ReserveQuota 先占一次额度，超了再退回去；limit小于0表示不限
+func (rdb Redis) ReserveQuota(userId uint, now time.Time, dailyLimit int, monthlyLimit int) (int64, int64, bool, error) {
+	dayKey, monthKey := quotaKeys(userId, now)
+	var day, month *redis.IntCmd
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		day = pipe.Incr(rdb.context, dayKey)
+		pipe.Expire(rdb.context, dayKey, 48*time.Hour)
+		month = pipe.Incr(rdb.context, monthKey)
+		pipe.Expire(rdb.context, monthKey, 32*24*time.Hour)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("占用AI额度失败", zap.Error(err))
+		return 0, 0, false, err
+	}
+	if (dailyLimit >= 0 && day.Val() > int64(dailyLimit)) || (monthlyLimit >= 0 && month.Val() > int64(monthlyLimit)) {
+		if err = rdb.RefundQuota(userId, now); err != nil {
+			return 0, 0, false, err
+		}
+		return day.Val() - 1, month.Val() - 1, false, nil
+	}
+	return day.Val(), month.Val(), true, nil
+}
+
+// RefundQuota 调用失败或没有真正发起调用时退回
+func (rdb Redis) RefundQuota(userId uint, now time.Time) error {
+	dayKey, monthKey := quotaKeys(userId, now)
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.Decr(rdb.context, dayKey)
+		pipe.Decr(rdb.context, monthKey)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("退回AI额度失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetQuotaUsed(userId uint, now time.Time) (int64, int64, error) {
+	dayKey, monthKey := quotaKeys(userId, now)
+	values, err := rdb.redis.MGet(rdb.context, dayKey, monthKey).Result()
+	if err != nil {
+		zlog.Error("获取AI额度失败", zap.Error(err))
+		return 0, 0, err
+	}
+	used := make([]int64, 2)
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			used[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return used[0], used[1], nil
+}
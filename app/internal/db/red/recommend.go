@@ -0,0 +1,273 @@
+package red
+
+import (
+	"commmunity/app/zlog"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	likedReadyKey = "user:liked:ready"
+	poolTTL       = time.Hour
+	seenTTL       = 7 * 24 * time.Hour
+	recActiveKey  = "rec:active"
+)
+
+// post:likes里存的是账号，反向索引也按账号存，协同过滤时不用再查一次用户
+func likedKey(account string) string {
+	return fmt.Sprintf("user:liked:%s", account)
+}
+
+func poolKey(userId uint) string {
+	return fmt.Sprintf("rec:pool:%d", userId)
+}
+
+func reasonKey(userId uint) string {
+	return fmt.Sprintf("rec:reason:%d", userId)
+}
+
+func seenKey(userId uint) string {
+	return fmt.Sprintf("rec:seen:%d", userId)
+}
+
+func parseIds(members []string) []uint {
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
+
+// TrackLike 维护用户点赞过的帖子，完整保留不过期，数据导出和注销都靠它找到用户的点赞
+func (rdb Redis) TrackLike(account string, postId uint, like bool) error {
+	key := likedKey(account)
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		if like {
+			pipe.ZAdd(rdb.context, key, redis.Z{Score: float64(time.Now().Unix()), Member: postId})
+		} else {
+			pipe.ZRem(rdb.context, key, postId)
+		}
+		//之前的版本给这个key设过过期时间
+		pipe.Persist(rdb.context, key)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("记录点赞历史失败", zap.String("account", account), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetLiked(account string, limit int) ([]uint, error) {
+	members, err := rdb.redis.ZRevRange(rdb.context, likedKey(account), 0, int64(limit-1)).Result()
+	if err != nil {
+		zlog.Error("获取点赞历史失败", zap.String("account", account), zap.Error(err))
+		return nil, err
+	}
+	return parseIds(members), nil
+}
+
+func (rdb Redis) GetAllLiked(account string) ([]uint, error) {
+	members, err := rdb.redis.ZRange(rdb.context, likedKey(account), 0, -1).Result()
+	if err != nil {
+		zlog.Error("获取点赞历史失败", zap.String("account", account), zap.Error(err))
+		return nil, err
+	}
+	return parseIds(members), nil
+}
+
+func (rdb Redis) DelLiked(account string) error {
+	return rdb.redis.Del(rdb.context, likedKey(account)).Err()
+}
+
+// LikedIndexReady 反向索引从post:likes全量回填过之后才算完整，在此之前只能扫描
+func (rdb Redis) LikedIndexReady() (bool, error) {
+	n, err := rdb.redis.Exists(rdb.context, likedReadyKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// IndexLikes 把一个帖子现有的点赞补进反向索引，时间未知记为0；已经在索引里的保留原来的时间
+func (rdb Redis) IndexLikes(postId uint) error {
+	accounts, err := rdb.redis.SMembers(rdb.context, fmt.Sprintf("post:likes:%d", postId)).Result()
+	if err != nil {
+		zlog.Error("获取点赞用户失败", zap.Uint("postId", postId), zap.Error(err))
+		return err
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+	_, err = rdb.redis.Pipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		for _, account := range accounts {
+			pipe.ZAddNX(rdb.context, likedKey(account), redis.Z{Score: 0, Member: postId})
+		}
+		return nil
+	})
+	if err != nil {
+		zlog.Error("回填点赞索引失败", zap.Uint("postId", postId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) MarkLikedIndexReady() error {
+	err := rdb.redis.Set(rdb.context, likedReadyKey, 1, 0).Err()
+	if err != nil {
+		zlog.Error("标记点赞索引失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetLikers 随机取一部分点赞的人，热门帖子点赞的人太多，没必要全取
+func (rdb Redis) GetLikers(postId uint, count int) ([]string, error) {
+	key := fmt.Sprintf("post:likes:%d", postId)
+	accounts, err := rdb.redis.SRandMemberN(rdb.context, key, int64(count)).Result()
+	if err != nil {
+		zlog.Error("获取点赞用户失败", zap.Uint("postId", postId), zap.Error(err))
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (rdb Redis) MarkRecommendActive(userId uint) error {
+	err := rdb.redis.ZAdd(rdb.context, recActiveKey, redis.Z{Score: float64(time.Now().Unix()), Member: userId}).Err()
+	if err != nil {
+		zlog.Error("记录活跃用户失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetRecommendActive 最近用过推荐的用户，顺便清理不活跃的
+func (rdb Redis) GetRecommendActive(since time.Time) ([]uint, error) {
+	min := strconv.FormatInt(since.Unix(), 10)
+	_ = rdb.redis.ZRemRangeByScore(rdb.context, recActiveKey, "-inf", "("+min).Err()
+	members, err := rdb.redis.ZRangeByScore(rdb.context, recActiveKey, &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		zlog.Error("获取活跃用户失败", zap.Error(err))
+		return nil, err
+	}
+	return parseIds(members), nil
+}
+
+func (rdb Redis) CandidatesExist(userId uint) (bool, error) {
+	return rdb.exists(poolKey(userId))
+}
+
+// SetCandidates 整体替换候选池，推荐理由单独放一个hash
+func (rdb Redis) SetCandidates(userId uint, scores map[uint]float64, reasons map[uint]string) error {
+	pool, reason := poolKey(userId), reasonKey(userId)
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.Del(rdb.context, pool, reason)
+		if len(scores) == 0 {
+			return nil
+		}
+		members := make([]redis.Z, 0, len(scores))
+		fields := make(map[string]interface{}, len(reasons))
+		for id, s := range scores {
+			members = append(members, redis.Z{Score: s, Member: id})
+			fields[strconv.FormatUint(uint64(id), 10)] = reasons[id]
+		}
+		pipe.ZAdd(rdb.context, pool, members...)
+		pipe.HSet(rdb.context, reason, fields)
+		pipe.Expire(rdb.context, pool, poolTTL)
+		pipe.Expire(rdb.context, reason, poolTTL)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("写入推荐候选池失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PopCandidates 取出分数最高的几条，取出即从候选池删除
+func (rdb Redis) PopCandidates(userId uint, count int) ([]uint, map[uint]string, error) {
+	zs, err := rdb.redis.ZPopMax(rdb.context, poolKey(userId), int64(count)).Result()
+	if err != nil {
+		zlog.Error("读取推荐候选池失败", zap.Uint("userId", userId), zap.Error(err))
+		return nil, nil, err
+	}
+	if len(zs) == 0 {
+		return nil, map[uint]string{}, nil
+	}
+	ids := make([]uint, 0, len(zs))
+	fields := make([]string, 0, len(zs))
+	for _, z := range zs {
+		m := z.Member.(string)
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+		fields = append(fields, m)
+	}
+	reasons := make(map[uint]string, len(ids))
+	values, err := rdb.redis.HMGet(rdb.context, reasonKey(userId), fields...).Result()
+	if err != nil {
+		zlog.Error("读取推荐理由失败", zap.Uint("userId", userId), zap.Error(err))
+		return ids, reasons, nil
+	}
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			reasons[ids[i]] = s
+		}
+	}
+	return ids, reasons, nil
+}
+
+// MarkSeen 看过的帖子用set去重，7天后可以再推
+func (rdb Redis) MarkSeen(userId uint, postIds []uint) error {
+	if len(postIds) == 0 {
+		return nil
+	}
+	key := seenKey(userId)
+	members := make([]interface{}, len(postIds))
+	for i, id := range postIds {
+		members[i] = id
+	}
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(rdb.context, key, members...)
+		pipe.Expire(rdb.context, key, seenTTL)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("记录已推荐帖子失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// FilterSeen 去掉已经推荐过的帖子
+func (rdb Redis) FilterSeen(userId uint, postIds []uint) ([]uint, error) {
+	if len(postIds) == 0 {
+		return postIds, nil
+	}
+	members := make([]interface{}, len(postIds))
+	for i, id := range postIds {
+		members[i] = id
+	}
+	seen, err := rdb.redis.SMIsMember(rdb.context, seenKey(userId), members...).Result()
+	if err != nil {
+		zlog.Error("查询已推荐帖子失败", zap.Uint("userId", userId), zap.Error(err))
+		return nil, err
+	}
+	result := make([]uint, 0, len(postIds))
+	for i, id := range postIds {
+		if !seen[i] {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
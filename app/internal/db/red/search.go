@@ -0,0 +1,104 @@
+package red
+
+import (
+	"commmunity/app/zlog"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	hotSearchKey = "search:hot"
+	historySize  = 20
+	historyTTL   = 90 * 24 * time.Hour
+)
+
+func historyKey(userId uint) string {
+	return fmt.Sprintf("search:history:%d", userId)
+}
+
+// RecordHotSearch 同一个人一天内搜同一个词只算一次，防止刷热搜
+func (rdb Redis) RecordHotSearch(userId uint, query string) error {
+	key := fmt.Sprintf("search:hot:seen:%s:%d:%s", time.Now().Format("20060102"), userId, query)
+	first, err := rdb.redis.SetNX(rdb.context, key, 1, 24*time.Hour).Result()
+	if err != nil {
+		zlog.Error("记录热搜失败", zap.Error(err))
+		return err
+	}
+	if !first {
+		return nil
+	}
+	err = rdb.redis.ZIncrBy(rdb.context, hotSearchKey, 1, query).Err()
+	if err != nil {
+		zlog.Error("记录热搜失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// DecayHotSearch 所有分数乘以factor，衰减到min以下的删掉，只保留前size个
+func (rdb Redis) DecayHotSearch(factor float64, min float64, size int) error {
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(rdb.context, hotSearchKey, &redis.ZStore{Keys: []string{hotSearchKey}, Weights: []float64{factor}})
+		pipe.ZRemRangeByScore(rdb.context, hotSearchKey, "-inf", fmt.Sprintf("(%f", min))
+		pipe.ZRemRangeByRank(rdb.context, hotSearchKey, 0, int64(-size-1))
+		return nil
+	})
+	if err != nil {
+		zlog.Error("热搜衰减失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetHotSearch(limit int) ([]redis.Z, error) {
+	zs, err := rdb.redis.ZRevRangeWithScores(rdb.context, hotSearchKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		zlog.Error("获取热搜失败", zap.Error(err))
+		return nil, err
+	}
+	return zs, nil
+}
+
+// AddSearchHistory 同一个词只留最新的一次，最多保留20条
+func (rdb Redis) AddSearchHistory(userId uint, query string) error {
+	key := historyKey(userId)
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.LRem(rdb.context, key, 0, query)
+		pipe.LPush(rdb.context, key, query)
+		pipe.LTrim(rdb.context, key, 0, historySize-1)
+		pipe.Expire(rdb.context, key, historyTTL)
+		return nil
+	})
+	if err != nil {
+		zlog.Error("记录搜索历史失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetSearchHistory(userId uint) ([]string, error) {
+	history, err := rdb.redis.LRange(rdb.context, historyKey(userId), 0, historySize-1).Result()
+	if err != nil {
+		zlog.Error("获取搜索历史失败", zap.Uint("userId", userId), zap.Error(err))
+		return nil, err
+	}
+	return history, nil
+}
+
+// DelSearchHistory query为空时清空全部
+func (rdb Redis) DelSearchHistory(userId uint, query string) error {
+	var err error
+	if query == "" {
+		err = rdb.redis.Del(rdb.context, historyKey(userId)).Err()
+	} else {
+		err = rdb.redis.LRem(rdb.context, historyKey(userId), 0, query).Err()
+	}
+	if err != nil {
+		zlog.Error("清除搜索历史失败", zap.Uint("userId", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
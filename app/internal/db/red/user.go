@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -21,6 +23,23 @@ func (rdb Redis) IsInBlacklist(tokenString string) bool {
 	return n > 0
 }
 
+func (rdb Redis) RemoveFromBlacklist(tokenString string) error {
+	return rdb.redis.Del(rdb.context, "blacklist:"+tokenString).Err()
+}
+
+// MarkBansSynced 封禁标记从数据库重建完成后打上，Redis被清空时这个标记会跟着消失
+func (rdb Redis) MarkBansSynced() error {
+	return rdb.redis.Set(rdb.context, "ban:synced", "1", 0).Err()
+}
+
+func (rdb Redis) BansSynced() (bool, error) {
+	n, err := rdb.redis.Exists(rdb.context, "ban:synced").Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
 func (rdb Redis) UserProfile(userId uint, userDetail interface{}) error {
 	key := fmt.Sprintf("user:cache:%d", userId)
 	data, err := json.Marshal(userDetail)
@@ -138,3 +157,177 @@ func (rdb Redis) DelFollowingsCache(account string) error {
 	}
 	return nil
 }
+
+func (rdb Redis) SetOnceToken(purpose string, token string, value string, expiration time.Duration) error {
+	key := fmt.Sprintf("once:token:%s:%s", purpose, token)
+	err := rdb.redis.Set(rdb.context, key, value, expiration).Err()
+	if err != nil {
+		zlog.Error("保存一次性令牌失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ConsumeOnceToken 取出即删除，保证令牌只能使用一次
+func (rdb Redis) ConsumeOnceToken(purpose string, token string) (string, error) {
+	key := fmt.Sprintf("once:token:%s:%s", purpose, token)
+	data, err := rdb.redis.GetDel(rdb.context, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			zlog.Error("读取一次性令牌失败", zap.Error(err))
+			return "", err
+		}
+		return "", nil
+	}
+	return data, nil
+}
+
+func (rdb Redis) IncrLoginFail(target string, window time.Duration) (int64, error) {
+	key := "login:fail:" + target
+	count, err := rdb.redis.Incr(rdb.context, key).Result()
+	if err != nil {
+		zlog.Error("记录登录失败次数失败", zap.Error(err))
+		return 0, err
+	}
+	if count == 1 {
+		err = rdb.redis.Expire(rdb.context, key, window).Err()
+		if err != nil {
+			zlog.Error("设置登录失败计数过期失败", zap.Error(err))
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (rdb Redis) ClearLoginFail(target string) error {
+	err := rdb.redis.Del(rdb.context, "login:fail:"+target).Err()
+	if err != nil {
+		zlog.Error("清除登录失败次数失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) LockLogin(target string, expiration time.Duration) error {
+	err := rdb.redis.Set(rdb.context, "login:lock:"+target, "1", expiration).Err()
+	if err != nil {
+		zlog.Error("锁定登录失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) LoginLockTTL(target string) (time.Duration, error) {
+	ttl, err := rdb.redis.TTL(rdb.context, "login:lock:"+target).Result()
+	if err != nil {
+		zlog.Error("查询登录锁定失败", zap.Error(err))
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (rdb Redis) UnlockLogin(target string) error {
+	err := rdb.redis.Del(rdb.context, "login:lock:"+target, "login:fail:"+target).Err()
+	if err != nil {
+		zlog.Error("解除登录锁定失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) RevokeSession(sessionId uint, expiration time.Duration) error {
+	key := fmt.Sprintf("session:revoked:%d", sessionId)
+	err := rdb.redis.Set(rdb.context, key, "1", expiration).Err()
+	if err != nil {
+		zlog.Error("标记会话注销失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) IsSessionRevoked(sessionId uint) bool {
+	n, _ := rdb.redis.Exists(rdb.context, fmt.Sprintf("session:revoked:%d", sessionId)).Result()
+	return n > 0
+}
+
+func (rdb Redis) GetOnceToken(purpose string, token string) (string, error) {
+	key := fmt.Sprintf("once:token:%s:%s", purpose, token)
+	data, err := rdb.redis.Get(rdb.context, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			zlog.Error("读取一次性令牌失败", zap.Error(err))
+			return "", err
+		}
+		return "", nil
+	}
+	return data, nil
+}
+
+func (rdb Redis) SetRoleCache(userId uint, role int, version int) error {
+	key := fmt.Sprintf("user:role:%d", userId)
+	err := rdb.redis.Set(rdb.context, key, fmt.Sprintf("%d:%d", role, version), 30*time.Minute+utils.RandomDuration(5)).Err()
+	if err != nil {
+		zlog.Error("建立角色缓存失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetRoleCache(userId uint) (int, int, bool, error) {
+	key := fmt.Sprintf("user:role:%d", userId)
+	data, err := rdb.redis.Get(rdb.context, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			zlog.Error("获取角色缓存失败", zap.Error(err))
+			return 0, 0, false, err
+		}
+		return 0, 0, false, nil
+	}
+	roleStr, versionStr, _ := strings.Cut(data, ":")
+	role, err1 := strconv.Atoi(roleStr)
+	version, err2 := strconv.Atoi(versionStr)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false, nil
+	}
+	return role, version, true, nil
+}
+
+func (rdb Redis) DelRoleCache(userId uint) error {
+	key := fmt.Sprintf("user:role:%d", userId)
+	err := rdb.redis.Del(rdb.context, key).Err()
+	if err != nil {
+		zlog.Error("删除角色缓存失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+const creatorRankKey = "rank:creators"
+
+// SetCreatorRank 整个榜单一次性替换
+func (rdb Redis) SetCreatorRank(scores []redis.Z) error {
+	_, err := rdb.redis.TxPipelined(rdb.context, func(pipe redis.Pipeliner) error {
+		pipe.Del(rdb.context, creatorRankKey)
+		if len(scores) > 0 {
+			pipe.ZAdd(rdb.context, creatorRankKey, scores...)
+		}
+		return nil
+	})
+	if err != nil {
+		zlog.Error("更新热门作者榜失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (rdb Redis) GetCreatorRank(limit int) ([]redis.Z, error) {
+	results, err := rdb.redis.ZRevRangeWithScores(rdb.context, creatorRankKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		zlog.Error("提取热门作者榜失败", zap.Error(err))
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"commmunity/app/zlog"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewSender 根据配置选择发信方式，未配置smtp时使用日志发信，便于本地开发
+func NewSender() Sender {
+	if viper.GetString("mail.driver") == "smtp" {
+		return &SMTPSender{
+			Host:     viper.GetString("mail.host"),
+			Port:     viper.GetString("mail.port"),
+			Username: viper.GetString("mail.username"),
+			Password: viper.GetString("mail.password"),
+			From:     viper.GetString("mail.from"),
+		}
+	}
+	return NewLogSender()
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(to string, subject string, body string) error {
+	auth := smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	msg := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	err := smtp.SendMail(fmt.Sprintf("%s:%s", s.Host, s.Port), auth, s.From, []string{to}, []byte(msg))
+	if err != nil {
+		zlog.Error("邮件发送失败", zap.String("to", to), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// LogSender 只把邮件写进日志并保存在内存里，开发和测试时用来取验证链接
+type LogSender struct {
+	lock  sync.Mutex
+	Sent  []Mail
+	limit int
+}
+
+func NewLogSender() *LogSender {
+	return &LogSender{limit: 100}
+}
+
+func (s *LogSender) Send(to string, subject string, body string) error {
+	zlog.Info("模拟发送邮件", zap.String("to", to), zap.String("subject", subject), zap.String("body", body))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Sent = append(s.Sent, Mail{To: to, Subject: subject, Body: body})
+	if len(s.Sent) > s.limit {
+		s.Sent = s.Sent[len(s.Sent)-s.limit:]
+	}
+	return nil
+}
+
+func (s *LogSender) Last(to string) (Mail, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := len(s.Sent) - 1; i >= 0; i-- {
+		if s.Sent[i].To == to {
+			return s.Sent[i], true
+		}
+	}
+	return Mail{}, false
+}
@@ -1,6 +1,29 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NoticeLike    = 1 // 点赞
+	NoticeComment = 2 // 评论
+	NoticeSystem  = 3 // 系统
+)
+
+const (
+	TargetAll   = 1 // 全体用户
+	TargetVip   = 2 // 仅VIP
+	TargetUsers = 3 // 指定用户
+)
+
+const (
+	AnnouncementPending   = 0 // 待发布
+	AnnouncementSending   = 1 // 发布中
+	AnnouncementPublished = 2 // 已发布
+	AnnouncementCancelled = 3 // 已撤回
+)
 
 type Message struct {
 	gorm.Model
@@ -8,16 +31,32 @@ type Message struct {
 	ToUserID   uint   `gorm:"index" json:"to_user_id"`
 	Content    string `gorm:"type:longtext" json:"content"`
 	Type       int    `gorm:"type:tinyint;comment 类型 1: 文本,2: 图片" json:"type"`
+	Hidden     bool   `gorm:"default:false" json:"-"`
 }
 
 type Notice struct {
 	gorm.Model
-	UserID   uint   `gorm:"index" json:"user_id"`
-	Type     int    `gorm:"type:tinyint;comment 类型 1:点赞, 2:评论" json:"type"`
-	SenderID uint   `gorm:"index" json:"sender_id"`
-	PostID   uint   `gorm:"index" json:"post_id"`
-	Content  string `gorm:"type:longtext" json:"content"`
-	IsRead   bool   `gorm:"default:false" json:"is_read"`
+	UserID         uint       `gorm:"index" json:"user_id"`
+	Type           int        `gorm:"type:tinyint;comment 类型 1:点赞, 2:评论, 3:系统" json:"type"`
+	SenderID       uint       `gorm:"index" json:"sender_id"`
+	PostID         uint       `gorm:"index" json:"post_id"`
+	AnnouncementID uint       `gorm:"index" json:"announcement_id"`
+	Content        string     `gorm:"type:longtext" json:"content"`
+	IsRead         bool       `gorm:"default:false" json:"is_read"`
+	ExpireAt       *time.Time `json:"expire_at"`
+}
+
+type Announcement struct {
+	gorm.Model
+	SenderID  uint       `gorm:"index" json:"sender_id"`
+	Title     string     `gorm:"type:varchar(100);not null" json:"title"`
+	Content   string     `gorm:"type:longtext" json:"content"`
+	Target    int        `gorm:"type:tinyint;comment:目标 1:全体 2:VIP 3:指定用户" json:"target"`
+	UserIDs   string     `gorm:"type:text;comment:指定用户ID，逗号分隔" json:"user_ids"`
+	PublishAt time.Time  `gorm:"index" json:"publish_at"`
+	ExpireAt  *time.Time `json:"expire_at"`
+	Status    int        `gorm:"type:tinyint;default:0;index;comment:状态 0:待发布 1:发布中 2:已发布 3:已撤回" json:"status"`
+	LastUser  uint       `gorm:"default:0;comment:已投递到的用户ID，中断后从这里继续" json:"-"`
 }
 
 type MessageRequest struct {
@@ -25,3 +64,12 @@ type MessageRequest struct {
 	Content  string `json:"content"`
 	Type     int    `json:"type"`
 }
+
+type AnnouncementRequest struct {
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Target    int    `json:"target"`
+	UserIDs   []uint `json:"user_ids"`
+	PublishAt string `json:"publish_at"` // 2006-01-02 15:04:05，为空则立即发布
+	ExpireAt  string `json:"expire_at"`  // 为空则永不过期
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ExportPending = 0 // 排队中
+	ExportRunning = 1 // 打包中
+	ExportDone    = 2 // 已完成
+	ExportFailed  = 3 // 失败
+	ExportExpired = 4 // 文件已过期删除
+)
+
+type ExportJob struct {
+	gorm.Model
+	UserID   uint       `gorm:"index;not null" json:"user_id"`
+	Status   int        `gorm:"type:tinyint;default:0;index;comment:状态 0:排队 1:打包中 2:完成 3:失败 4:已过期" json:"status"`
+	FilePath string     `gorm:"type:varchar(255)" json:"-"`
+	ExpireAt *time.Time `gorm:"index" json:"expire_at"`
+	Error    string     `gorm:"type:varchar(255)" json:"error,omitempty"`
+}
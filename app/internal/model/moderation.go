@@ -0,0 +1,122 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SanctionMute    = 1 // 禁言，不能发帖、评论
+	SanctionPostBan = 2 // 禁止发帖
+	SanctionBan     = 3 // 封禁账号
+)
+
+const (
+	AppealNone     = 0 // 未申诉
+	AppealPending  = 1 // 申诉中
+	AppealAccepted = 2 // 申诉通过
+	AppealRejected = 3 // 申诉驳回
+)
+
+const (
+	ReportPost    = 1 // 帖子
+	ReportComment = 2 // 评论
+	ReportUser    = 3 // 用户
+	ReportMessage = 4 // 私信
+)
+
+const (
+	ReasonSpam    = 1 // 垃圾广告
+	ReasonAbuse   = 2 // 辱骂攻击
+	ReasonPorn    = 3 // 色情低俗
+	ReasonIllegal = 4 // 违法违规
+	ReasonOther   = 5 // 其他
+)
+
+const (
+	ReportPending   = 0 // 待处理
+	ReportDismissed = 1 // 已驳回
+	ReportResolved  = 2 // 已处理
+)
+
+const (
+	ReportActionDismiss  = "dismiss"  // 驳回举报
+	ReportActionDelete   = "delete"   // 删除内容
+	ReportActionSanction = "sanction" // 处罚作者
+)
+
+const (
+	WordBlock  = 1 // 直接拦截
+	WordMask   = 2 // 替换为*
+	WordReview = 3 // 放行但进入审核队列
+)
+
+type Sanction struct {
+	gorm.Model
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	Type         int        `gorm:"type:tinyint;comment:类型 1:禁言 2:禁止发帖 3:封禁" json:"type"`
+	Reason       string     `gorm:"type:varchar(255)" json:"reason"`
+	IssuerID     uint       `gorm:"index" json:"issuer_id"`
+	StartAt      time.Time  `json:"start_at"`
+	EndAt        *time.Time `gorm:"index;comment:为空表示永久" json:"end_at"`
+	LiftedAt     *time.Time `gorm:"index" json:"lifted_at"`
+	Appeal       string     `gorm:"type:varchar(500)" json:"appeal"`
+	AppealStatus int        `gorm:"type:tinyint;default:0;index;comment:申诉 0:无 1:申诉中 2:通过 3:驳回" json:"appeal_status"`
+}
+
+type SanctionRequest struct {
+	Type     int    `json:"type"`
+	Reason   string `json:"reason"`
+	Duration int    `json:"duration"` // 分钟，0表示永久
+	Appeal   string `json:"appeal"`
+	Accept   bool   `json:"accept"`
+}
+
+// Report 同一用户对同一内容只能举报一次
+type Report struct {
+	gorm.Model
+	ReporterID uint       `gorm:"uniqueIndex:idx_report_target;not null" json:"reporter_id"`
+	TargetType int        `gorm:"type:tinyint;uniqueIndex:idx_report_target;index:idx_report_queue;comment:类型 1:帖子 2:评论 3:用户 4:私信" json:"target_type"`
+	TargetID   uint       `gorm:"uniqueIndex:idx_report_target;index:idx_report_queue" json:"target_id"`
+	AuthorID   uint       `gorm:"index" json:"author_id"`
+	Reason     int        `gorm:"type:tinyint;comment:原因 1:广告 2:辱骂 3:色情 4:违法 5:其他" json:"reason"`
+	Detail     string     `gorm:"type:varchar(500)" json:"detail"`
+	Status     int        `gorm:"type:tinyint;default:0;index;comment:状态 0:待处理 1:驳回 2:已处理" json:"status"`
+	HandlerID  uint       `json:"handler_id"`
+	HandledAt  *time.Time `json:"handled_at"`
+}
+
+// ReportGroup 审核队列中按内容聚合后的一条
+type ReportGroup struct {
+	TargetType     int       `json:"target_type"`
+	TargetID       uint      `json:"target_id"`
+	AuthorID       uint      `json:"author_id"`
+	Count          int64     `json:"count"`
+	LastReportedAt time.Time `json:"last_reported_at"`
+}
+
+type ReportRequest struct {
+	TargetType int    `json:"target_type"`
+	TargetID   uint   `json:"target_id"`
+	Reason     int    `json:"reason"`
+	Detail     string `json:"detail"`
+}
+
+type ReportActionRequest struct {
+	Action   string `json:"action"` // dismiss / delete / sanction
+	Type     int    `json:"type"`   // 处罚类型，仅sanction时需要
+	Reason   string `json:"reason"`
+	Duration int    `json:"duration"` // 分钟，0表示永久
+}
+
+type SensitiveWord struct {
+	gorm.Model
+	Word   string `gorm:"type:varchar(64);uniqueIndex;not null" json:"word"`
+	Action int    `gorm:"type:tinyint;default:1;comment:处理方式 1:拦截 2:打码 3:审核" json:"action"`
+}
+
+type SensitiveWordRequest struct {
+	Word   string `json:"word"`
+	Action int    `json:"action"`
+}
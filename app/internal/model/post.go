@@ -1,10 +1,29 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PageQuery Cursor为true时按(created_at,id)游标翻页，CursorID为0表示第一页；否则按Offset翻页
+type PageQuery struct {
+	Offset     int
+	Limit      int
+	Cursor     bool
+	CursorTime time.Time
+	CursorID   uint
+}
+
+const (
+	PostPublished     = 0 // 已发布
+	PostPendingReview = 1 // 待审核
+	PostRejected      = 2 // 审核未通过
+)
 
 type Post struct {
 	gorm.Model
-	Title        string    `gorm:"type:varchar(100);not null" json:"title"`
+	Title        string    `gorm:"type:varchar(100);not null;index" json:"title"`
 	Content      string    `gorm:"type:longtext" json:"content"`
 	Paid         bool      `gorm:"default:false" json:"paid"`
 	UserID       uint      `gorm:"index;not null" json:"user_id"`
@@ -13,6 +32,8 @@ type Post struct {
 	ViewCount    uint      `gorm:"default:0" json:"view_count"`
 	LikeCount    uint      `gorm:"default:0" json:"like_count"`
 	CommentCount uint      `gorm:"default:0" json:"comment_count"`
+	Hidden       bool      `gorm:"default:false;index" json:"-"` // 被举报过多，等待审核
+	Status       int       `gorm:"type:tinyint;default:0;index;comment:状态 0:已发布 1:待审核 2:未通过" json:"status"`
 }
 
 type Comment struct {
@@ -21,6 +42,7 @@ type Comment struct {
 	PostID  uint   `gorm:"index;not null" json:"post_id"`
 	UserID  uint   `gorm:"index;not null" json:"user_id"`
 	User    User   `gorm:"foreignKey:UserID;not null" json:"user"`
+	Hidden  bool   `gorm:"default:false;index" json:"-"`
 }
 
 type PostRequest struct {
@@ -28,6 +50,20 @@ type PostRequest struct {
 	Content string
 }
 
+type PostReviewRequest struct {
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason"`
+}
+
 type CommentRequest struct {
 	Content string
 }
+
+// PostEmbedding 帖子向量，Hash是向量化文本的摘要，模型和内容都没变就不用重算
+type PostEmbedding struct {
+	PostID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Model     string `gorm:"type:varchar(100);not null"`
+	Hash      string `gorm:"type:char(40);not null"`
+	Vector    []byte `gorm:"type:mediumblob"`
+	UpdatedAt time.Time
+}
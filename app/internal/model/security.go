@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventLoginFailed  = "login_failed"
+	EventLoginLocked  = "login_locked"
+	EventLoginUnlock  = "login_unlock"
+	EventLoginSuccess = "login_success"
+	EventTokenReuse   = "refresh_token_reuse"
+)
+
+type SecurityLog struct {
+	gorm.Model
+	Account   string `gorm:"type:varchar(100);index" json:"account"`
+	IP        string `gorm:"type:varchar(64);index" json:"ip"`
+	UserAgent string `gorm:"type:varchar(255)" json:"user_agent"`
+	Event     string `gorm:"type:varchar(32);index" json:"event"`
+	Detail    string `gorm:"type:varchar(255)" json:"detail"`
+}
+
+type UnlockRequest struct {
+	Account string `json:"account"`
+	IP      string `json:"ip"`
+}
+
+type Session struct {
+	gorm.Model
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Device     string     `gorm:"type:varchar(100)" json:"device"`
+	IP         string     `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	CurrentJTI string     `gorm:"type:varchar(64);comment:当前有效的refresh token标识" json:"-"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at"`
+}
+
+type RecoveryCode struct {
+	gorm.Model
+	UserID uint       `gorm:"index;not null"`
+	Hash   string     `gorm:"not null"`
+	UsedAt *time.Time `gorm:"comment:使用时间"`
+}
+
+const (
+	AuditPostPaid          = "post.paid"
+	AuditPostDelete        = "post.delete"
+	AuditPostReview        = "post.review"
+	AuditCommentDelete     = "comment.delete"
+	AuditVipGrant          = "user.vip"
+	AuditUserMute          = "user.mute"
+	AuditLoginUnlock       = "login.unlock"
+	AuditSanctionIssue     = "sanction.issue"
+	AuditSanctionLift      = "sanction.lift"
+	AuditAppealReview      = "appeal.review"
+	AuditReportHandle      = "report.handle"
+	AuditWordAdd           = "word.add"
+	AuditWordUpdate        = "word.update"
+	AuditWordDelete        = "word.delete"
+	AuditRoleAssign        = "role.assign"
+	AuditRolePermissions   = "role.permissions"
+	AuditAnnouncementPost  = "announcement.create"
+	AuditAnnouncementClear = "announcement.cancel"
+)
+
+// AuditLog 管理员和版主的操作记录，只追加不修改
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	ActorID    uint      `gorm:"index" json:"actor_id"`
+	Action     string    `gorm:"type:varchar(64);index" json:"action"`
+	TargetType string    `gorm:"type:varchar(32)" json:"target_type"`
+	TargetID   uint      `json:"target_id"`
+	Before     string    `gorm:"type:text" json:"before"`
+	After      string    `gorm:"type:text" json:"after"`
+	IP         string    `gorm:"type:varchar(64)" json:"ip"`
+	RequestID  string    `gorm:"type:varchar(64);index" json:"request_id"`
+}
+
+type AuditQuery struct {
+	ActorID uint
+	Action  string
+	From    *time.Time
+	To      *time.Time
+}
+
+const (
+	ScopeRead    = "read"
+	ScopePost    = "post"
+	ScopeMessage = "message"
+	ScopeAdmin   = "admin"
+)
+
+var AllScopes = []string{ScopeRead, ScopePost, ScopeMessage, ScopeAdmin}
+
+// AccessToken 个人访问令牌，给脚本和机器人用，只保存sha256摘要
+type AccessToken struct {
+	gorm.Model
+	UserID     uint       `gorm:"index;not null" json:"-"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	Name       string     `gorm:"type:varchar(50);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);comment:明文前几位，方便用户辨认" json:"prefix"`
+	Hash       string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:varchar(100);comment:逗号分隔的权限范围" json:"scopes"`
+	ExpireAt   *time.Time `json:"expire_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at"`
+}
+
+type AccessTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpireDay int      `json:"expire_day"` // 0表示永不过期
+}
+
+// UserIdentity 第三方登录身份，同一个提供方下subject唯一
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null" json:"-"`
+	Provider string `gorm:"type:varchar(32);uniqueIndex:idx_provider_subject;not null" json:"provider"`
+	Subject  string `gorm:"type:varchar(255);uniqueIndex:idx_provider_subject;not null" json:"-"`
+	Email    string `gorm:"type:varchar(100)" json:"email"`
+}
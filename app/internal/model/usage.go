@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// 调用AI的功能，用量按功能分别统计
+const (
+	FeatureSummary = "summary"
+)
+
+// AIUsage 每次调用大模型记一条，失败的也记，方便排查
+type AIUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	UserID           uint      `gorm:"index" json:"user_id"`
+	Feature          string    `gorm:"type:varchar(32);index" json:"feature"`
+	Provider         string    `gorm:"type:varchar(32)" json:"provider"`
+	Model            string    `gorm:"type:varchar(64)" json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `gorm:"comment:用量是否为估算" json:"estimated"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Cost             float64   `gorm:"comment:估算费用（元）" json:"cost"`
+	Success          bool      `json:"success"`
+}
+
+const (
+	UsageByUser    = "user"
+	UsageByFeature = "feature"
+	UsageByDay     = "day"
+)
+
+type UsageQuery struct {
+	UserID  uint
+	Feature string
+	From    *time.Time
+	To      *time.Time
+	GroupBy string
+}
+
+// UsageStat Key是用户ID、功能名或日期，取决于GroupBy
+type UsageStat struct {
+	Key              string  `json:"key"`
+	Calls            int64   `json:"calls"`
+	Failed           int64   `json:"failed"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
@@ -1,33 +1,105 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 const (
-	RoleUser  = 0 // 普通用户
-	RoleAdmin = 1 // 管理员
+	RoleUser       = 0 // 普通用户
+	RoleAdmin      = 1 // 管理员
+	RoleModerator  = 2 // 版主
+	RoleSuperAdmin = 3 // 超级管理员
 )
 
+const (
+	PermPostDeleteAny    = "post.delete.any"
+	PermCommentDeleteAny = "comment.delete.any"
+	PermPostPaid         = "post.paid"
+	PermUserMute         = "user.mute"
+	PermUserBan          = "user.ban"
+	PermReportReview     = "report.review"
+	PermWordManage       = "word.manage"
+	PermAuditView        = "audit.view"
+	PermPostReview       = "post.review"
+	PermUserUnlock       = "user.unlock"
+	PermVipGrant         = "vip.grant"
+	PermAnnouncement     = "announcement.publish"
+	PermRoleAssign       = "role.assign"
+	PermAIUsage          = "ai.usage"
+	PermAIUnlimited      = "ai.unlimited" // AI额度按admin档位算
+)
+
+var AllPermissions = []string{PermPostDeleteAny, PermCommentDeleteAny, PermPostPaid, PermUserMute, PermUserBan,
+	PermReportReview, PermWordManage, PermAuditView, PermPostReview, PermUserUnlock, PermVipGrant, PermAnnouncement, PermRoleAssign, PermAIUsage, PermAIUnlimited}
+
+var RoleNames = map[int]string{
+	RoleUser:       "普通用户",
+	RoleAdmin:      "管理员",
+	RoleModerator:  "版主",
+	RoleSuperAdmin: "超级管理员",
+}
+
+// RoleRanks 角色高低，和角色ID的大小无关；处罚之类的操作只能对比自己低的角色做
+var RoleRanks = map[int]int{
+	RoleUser:       0,
+	RoleModerator:  1,
+	RoleAdmin:      2,
+	RoleSuperAdmin: 3,
+}
+
+// DefaultRolePermissions 每次启动都会把缺的默认权限补进数据库，额外加的权限以数据库为准；要收回默认权限得改这里
+var DefaultRolePermissions = map[int][]string{
+	RoleUser:      {},
+	RoleModerator: {PermPostDeleteAny, PermCommentDeleteAny, PermUserMute, PermReportReview, PermPostReview},
+	RoleAdmin: {PermPostDeleteAny, PermCommentDeleteAny, PermPostPaid, PermUserMute, PermUserBan,
+		PermReportReview, PermWordManage, PermAuditView, PermPostReview, PermUserUnlock, PermVipGrant, PermAnnouncement, PermAIUsage, PermAIUnlimited},
+	RoleSuperAdmin: {PermPostDeleteAny, PermCommentDeleteAny, PermPostPaid, PermUserMute, PermUserBan,
+		PermReportReview, PermWordManage, PermAuditView, PermPostReview, PermUserUnlock, PermVipGrant, PermAnnouncement, PermRoleAssign, PermAIUsage, PermAIUnlimited},
+}
+
 type User struct {
 	gorm.Model
-	Account     string      `gorm:"type:varchar(100);uniqueIndex;not null"`
-	Hash        string      `gorm:"not null"`
-	Role        int         `gorm:"type:tinyint;default:0;comment:角色 0:普通用户 1:管理员"`
-	Vip         bool        `gorm:"default:false;comment:是否为vip用户"`
-	Followings  []*User     `gorm:"many2many:user_relations;joinForeignKey:follower_id;joinReferences:followed_id"`
-	Followers   []*User     `gorm:"many2many:user_relations;joinForeignKey:followed_id;joinReferences:follower_id"`
-	UserProfile UserProfile `gorm:"foreignKey:UserID" json:"user_profile"`
-	Posts       []Post      `gorm:"foreignKey:UserID" json:"posts"`
+	Account       string      `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Hash          string      `gorm:"not null"`
+	Role          int         `gorm:"type:tinyint;default:0;comment:角色 0:普通用户 1:管理员 2:版主 3:超级管理员"`
+	RoleVersion   int         `gorm:"default:0;comment:角色变更版本号"`
+	Vip           bool        `gorm:"default:false;comment:是否为vip用户"`
+	Email         string      `gorm:"type:varchar(100);index;comment:邮箱"`
+	EmailVerified bool        `gorm:"default:false;comment:邮箱是否已验证"`
+	VerifiedEmail *string     `gorm:"type:varchar(100);uniqueIndex;comment:已验证的邮箱，未验证为NULL，保证一个邮箱只属于一个账号"`
+	TotpSecret    string      `gorm:"type:varchar(64);comment:两步验证密钥"`
+	TotpEnabled   bool        `gorm:"default:false;comment:是否开启两步验证"`
+	TotpLastStep  int64       `gorm:"default:0;comment:最近一次通过的验证码时间步，防止重放"`
+	DeletionAt    *time.Time  `gorm:"index;comment:计划注销时间"`
+	Anonymized    bool        `gorm:"default:false;comment:是否已注销并匿名化"`
+	Followings    []*User     `gorm:"many2many:user_relations;joinForeignKey:follower_id;joinReferences:followed_id"`
+	Followers     []*User     `gorm:"many2many:user_relations;joinForeignKey:followed_id;joinReferences:follower_id"`
+	UserProfile   UserProfile `gorm:"foreignKey:UserID" json:"user_profile"`
+	Posts         []Post      `gorm:"foreignKey:UserID" json:"posts"`
 }
 
 type UserProfile struct {
 	gorm.Model
 	UserID       uint   `gorm:"uniqueIndex;not null"`
-	Name         string `gorm:"type:varchar(50);not null"`
+	Name         string `gorm:"type:varchar(50);not null;index"`
 	Introduction string `gorm:"type:varchar(100);not null"`
 	Avatar       string `gorm:"type:varchar(255);default:'';comment:头像URL"`
 	IsMuted      bool   `gorm:"default:false;comment:是否禁言"`
 }
 
+type Role struct {
+	ID          int              `gorm:"primaryKey;autoIncrement:false"`
+	Name        string           `gorm:"type:varchar(50);not null"`
+	Permissions []RolePermission `gorm:"foreignKey:RoleID"`
+}
+
+type RolePermission struct {
+	RoleID     int    `gorm:"uniqueIndex:idx_role_permission"`
+	Permission string `gorm:"type:varchar(64);uniqueIndex:idx_role_permission"`
+}
+
 type UserRelation struct {
 	FollowerID uint `gorm:"uniqueIndex:idx_relation"`
 	FollowedID uint `gorm:"uniqueIndex:idx_relation"`
@@ -38,6 +110,19 @@ type UserRequest struct {
 	Account  string `json:"account"`
 	Password string `json:"password"`
 	Name     string `json:"name"`
+	Email    string `json:"email"`
+}
+
+// DeletionRequest 有密码的账号填密码；只用第三方登录的账号填两步验证码，没开两步验证就重新登录后再申请
+type DeletionRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type EmailRequest struct {
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 type UserPassword struct {
@@ -52,3 +137,22 @@ type UserInfoRequest struct {
 	Avatar       string `json:"avatar"`
 	IsMuted      bool   `json:"is_muted"`
 }
+
+type RoleRequest struct {
+	Role        int      `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+type TotpRequest struct {
+	Code     string `json:"code"`
+	MfaToken string `json:"mfa_token"`
+}
+
+// CreatorStat 作者近期数据，用来算热门作者榜
+type CreatorStat struct {
+	UserID    uint
+	Likes     uint
+	Comments  uint
+	Views     uint
+	Followers int64
+}
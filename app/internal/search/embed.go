@@ -0,0 +1,167 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	EmbedderHash = "hash"
+	EmbedderHTTP = "http"
+)
+
+const embedTextSize = 2000 // 送去向量化的文本最多取这么多字
+
+// Embedder 把文本转成向量，返回的向量和texts一一对应
+type Embedder interface {
+	Name() string // 换了模型或维度，已存的向量就要重算
+	Embed(texts []string) ([][]float32, error)
+}
+
+// NewEmbedder embedding.provider配置为http时调用外部模型，否则用本地的哈希词袋
+func NewEmbedder() Embedder {
+	if viper.GetString("embedding.provider") == EmbedderHTTP {
+		return &HTTPEmbedder{
+			URL:    viper.GetString("embedding.url"),
+			Key:    viper.GetString("embedding.key"),
+			Model:  viper.GetString("embedding.model"),
+			Client: &http.Client{Timeout: time.Duration(viper.GetInt("embedding.timeout")) * time.Second},
+		}
+	}
+	return HashEmbedder{Dim: viper.GetInt("embedding.dim")}
+}
+
+// EmbedText 帖子向量化用的文本：标题加去掉标签的正文
+func EmbedText(title string, content string) string {
+	text := []rune(title + "\n" + PlainText(content))
+	if len(text) > embedTextSize {
+		text = text[:embedTextSize]
+	}
+	return string(text)
+}
+
+// Normalize 归一化后余弦相似度就是点积
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// HashEmbedder 把分词结果哈希到固定维度的词袋里，不依赖外部服务，结果是确定的
+type HashEmbedder struct {
+	Dim int
+}
+
+func (e HashEmbedder) Name() string {
+	return "hash-" + strconv.Itoa(e.Dim)
+}
+
+func (e HashEmbedder) Embed(texts []string) ([][]float32, error) {
+	if e.Dim <= 0 {
+		return nil, errors.New("向量维度必须大于0")
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		tf := make(map[string]int)
+		for _, t := range Tokenize(text) {
+			tf[t]++
+		}
+		v := make([]float32, e.Dim)
+		for t, n := range tf {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(t))
+			sum := h.Sum32()
+			//最高位决定正负，减少不同词撞到同一维时互相叠加
+			w := float32(1 + math.Log(float64(n)))
+			if sum&(1<<31) != 0 {
+				w = -w
+			}
+			v[int(sum%uint32(e.Dim))] += w
+		}
+		vectors[i] = Normalize(v)
+	}
+	return vectors, nil
+}
+
+// HTTPEmbedder 调用OpenAI兼容的/embeddings接口
+type HTTPEmbedder struct {
+	URL    string
+	Key    string
+	Model  string
+	Client *http.Client
+}
+
+func (e *HTTPEmbedder) Name() string {
+	return "http-" + e.Model
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *HTTPEmbedder) Embed(texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(embeddingRequest{Model: e.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.Key)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("向量化接口返回%d", resp.StatusCode)
+	}
+	var result embeddingResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			continue
+		}
+		vectors[d.Index] = Normalize(d.Embedding)
+	}
+	for _, v := range vectors {
+		if v == nil {
+			return nil, errors.New("向量化接口返回的结果数量不对")
+		}
+	}
+	return vectors, nil
+}
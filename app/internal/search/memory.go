@@ -0,0 +1,189 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	titleBoost = 3 // 标题里的词按出现3次计
+	bm25K1     = 1.2
+	bm25B      = 0.75
+)
+
+type memoryDoc struct {
+	Document
+	length int
+	terms  map[string]int
+}
+
+// shard 每种文档单独一份倒排表，文档数和平均长度也分开算
+type shard struct {
+	docs     map[uint]*memoryDoc
+	postings map[string]map[uint]int
+	length   int
+}
+
+// MemoryIndex 进程内的倒排索引，BM25打分；启动时从数据库重建，之后随增删改增量更新
+type MemoryIndex struct {
+	lock   sync.RWMutex
+	shards map[string]*shard
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	m := &MemoryIndex{shards: make(map[string]*shard)}
+	for _, t := range []string{TypePost, TypeComment, TypeUser} {
+		m.shards[t] = &shard{docs: make(map[uint]*memoryDoc), postings: make(map[string]map[uint]int)}
+	}
+	return m
+}
+
+func (s *shard) remove(id uint) {
+	doc, ok := s.docs[id]
+	if !ok {
+		return
+	}
+	for t := range doc.terms {
+		delete(s.postings[t], id)
+		if len(s.postings[t]) == 0 {
+			delete(s.postings, t)
+		}
+	}
+	s.length -= doc.length
+	delete(s.docs, id)
+}
+
+func (m *MemoryIndex) IndexDocument(doc Document) error {
+	s, ok := m.shards[doc.Type]
+	if !ok {
+		return nil
+	}
+	terms := make(map[string]int)
+	length := 0
+	for _, t := range Tokenize(doc.Title) {
+		terms[t] += titleBoost
+		length++
+	}
+	for _, t := range Tokenize(PlainText(doc.Content)) {
+		terms[t]++
+		length++
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s.remove(doc.ID)
+	s.docs[doc.ID] = &memoryDoc{Document: doc, length: length, terms: terms}
+	s.length += length
+	for t, tf := range terms {
+		if s.postings[t] == nil {
+			s.postings[t] = make(map[uint]int)
+		}
+		s.postings[t][doc.ID] = tf
+	}
+	return nil
+}
+
+func (m *MemoryIndex) DeleteDocument(docType string, id uint) error {
+	s, ok := m.shards[docType]
+	if !ok {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s.remove(id)
+	return nil
+}
+
+func matches(doc *Document, query Query) bool {
+	if query.AuthorID != 0 && doc.AuthorID != query.AuthorID {
+		return false
+	}
+	if query.From != nil && doc.CreatedAt.Before(*query.From) {
+		return false
+	}
+	if query.To != nil && !doc.CreatedAt.Before(*query.To) {
+		return false
+	}
+	page := query.Page
+	if page.Cursor && page.CursorID > 0 {
+		if doc.CreatedAt.After(page.CursorTime) {
+			return false
+		}
+		if doc.CreatedAt.Equal(page.CursorTime) && doc.ID >= page.CursorID {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryIndex) Search(query Query) (Result, error) {
+	terms := Terms(query.Keyword)
+	s, ok := m.shards[query.Type]
+	if !ok || len(terms) == 0 {
+		return Result{Hits: []Hit{}}, nil
+	}
+	m.lock.RLock()
+	n := float64(len(s.docs))
+	if n == 0 {
+		m.lock.RUnlock()
+		return Result{Hits: []Hit{}}, nil
+	}
+	avg := float64(s.length) / n
+	scores := make(map[uint]float64)
+	matched := make(map[uint]int)
+	for _, t := range terms {
+		posting := s.postings[t]
+		df := float64(len(posting))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range posting {
+			doc := s.docs[id]
+			if !matches(&doc.Document, query) {
+				continue
+			}
+			f := float64(tf)
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avg))
+			matched[id]++
+		}
+	}
+	docs := make([]*memoryDoc, 0, len(scores))
+	for id := range scores {
+		//命中的查询词越多越靠前
+		scores[id] *= float64(matched[id]) / float64(len(terms))
+		docs = append(docs, s.docs[id])
+	}
+	m.lock.RUnlock()
+	if query.Page.Cursor {
+		sort.Slice(docs, func(i, j int) bool {
+			if !docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+				return docs[i].CreatedAt.After(docs[j].CreatedAt)
+			}
+			return docs[i].ID > docs[j].ID
+		})
+	} else {
+		sort.Slice(docs, func(i, j int) bool {
+			if scores[docs[i].ID] != scores[docs[j].ID] {
+				return scores[docs[i].ID] > scores[docs[j].ID]
+			}
+			return docs[i].ID > docs[j].ID
+		})
+	}
+	result := Result{Total: int64(len(docs)), Hits: []Hit{}}
+	start := 0
+	if !query.Page.Cursor {
+		start = query.Page.Offset
+	}
+	for i := start; i < len(docs) && i < start+query.Page.Limit; i++ {
+		doc := docs[i]
+		result.Hits = append(result.Hits, Hit{
+			Type:      doc.Type,
+			ID:        doc.ID,
+			PostID:    doc.PostID,
+			AuthorID:  doc.AuthorID,
+			Score:     scores[doc.ID],
+			Title:     Highlight(doc.Title, terms),
+			Snippet:   Snippet(Visible(doc.Content, doc.Paid), terms),
+			CreatedAt: doc.CreatedAt,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"commmunity/app/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postDoc(id uint, title string, content string) Document {
+	return Document{Type: TypePost, ID: id, AuthorID: id, Title: title, Content: content, CreatedAt: time.Unix(int64(id), 0)}
+}
+
+func searchIds(t *testing.T, m *MemoryIndex, keyword string) []uint {
+	t.Helper()
+	r, err := m.Search(Query{Keyword: keyword, Type: TypePost, Page: model.PageQuery{Limit: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint, len(r.Hits))
+	for i, h := range r.Hits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func TestMemoryRanking(t *testing.T) {
+	filler := strings.Repeat("other words here ", 20)
+	tests := []struct {
+		name    string
+		docs    []Document
+		keyword string
+		want    []uint
+	}{
+		{
+			name:    "标题命中比正文命中靠前",
+			docs:    []Document{postDoc(1, "notes", "golang tips"), postDoc(2, "golang", "some tips")},
+			keyword: "golang",
+			want:    []uint{2, 1},
+		},
+		{
+			name:    "同样的词频，短文档靠前",
+			docs:    []Document{postDoc(1, "a", "redis "+filler), postDoc(2, "b", "redis cache")},
+			keyword: "redis",
+			want:    []uint{2, 1},
+		},
+		{
+			name:    "命中的查询词越多越靠前",
+			docs:    []Document{postDoc(1, "a", "redis redis redis"), postDoc(2, "b", "redis mysql")},
+			keyword: "redis mysql",
+			want:    []uint{2, 1},
+		},
+		{
+			name:    "稀有词的权重更高",
+			docs:    []Document{postDoc(1, "a", "common rare"), postDoc(2, "b", "common common"), postDoc(3, "c", "common"), postDoc(4, "d", "common")},
+			keyword: "rare common",
+			want:    []uint{1, 2, 4, 3},
+		},
+		{
+			name:    "中文按两字一组匹配",
+			docs:    []Document{postDoc(1, "a", "今天学习数据库"), postDoc(2, "b", "数据结构")},
+			keyword: "数据库",
+			want:    []uint{1, 2},
+		},
+		{
+			name:    "没有命中",
+			docs:    []Document{postDoc(1, "a", "hello")},
+			keyword: "world",
+			want:    []uint{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryIndex()
+			for _, d := range tt.docs {
+				_ = m.IndexDocument(d)
+			}
+			if got := searchIds(t, m, tt.keyword); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	m := NewMemoryIndex()
+	_ = m.IndexDocument(postDoc(1, "golang", ""))
+	_ = m.IndexDocument(postDoc(2, "golang", ""))
+	_ = m.IndexDocument(postDoc(1, "rust", ""))
+	if got := searchIds(t, m, "golang"); !reflect.DeepEqual(got, []uint{2}) {
+		t.Errorf("重新索引后旧词还在: %v", got)
+	}
+	_ = m.DeleteDocument(TypePost, 2)
+	if got := searchIds(t, m, "golang"); len(got) != 0 {
+		t.Errorf("删除后还能搜到: %v", got)
+	}
+	if got := searchIds(t, m, "rust"); !reflect.DeepEqual(got, []uint{1}) {
+		t.Errorf("Search(rust) = %v", got)
+	}
+}
+
+func TestMemoryPaidSnippet(t *testing.T) {
+	m := NewMemoryIndex()
+	doc := postDoc(1, "guide", "free intro\nline2\nline3\nline4\nsecret answer")
+	doc.Paid = true
+	_ = m.IndexDocument(doc)
+	r, err := m.Search(Query{Keyword: "secret", Type: TypePost, Page: model.PageQuery{Limit: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Hits) != 1 {
+		t.Fatalf("付费帖子照样能被搜到，got %d hits", len(r.Hits))
+	}
+	if s := r.Hits[0].Snippet; strings.Contains(s, "secret") || !strings.Contains(s, "free intro") {
+		t.Errorf("摘要带出了付费内容: %q", s)
+	}
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"commmunity/app/internal/model"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 可以被搜索的文档类型
+const (
+	TypePost    = "post"
+	TypeComment = "comment"
+	TypeUser    = "user"
+)
+
+const (
+	EngineMysql  = "mysql"
+	EngineMemory = "memory"
+)
+
+// 搜索方式：关键词匹配或按向量相似度
+const (
+	ModeKeyword  = "keyword"
+	ModeSemantic = "semantic"
+)
+
+func ValidType(docType string) bool {
+	return docType == TypePost || docType == TypeComment || docType == TypeUser
+}
+
+// Document 用户文档的Title是昵称、Content是简介，AuthorID是用户自己
+type Document struct {
+	Type      string
+	ID        uint
+	PostID    uint // 评论所属的帖子
+	AuthorID  uint
+	Title     string
+	Content   string
+	Paid      bool // 付费帖子的摘要只能取公开的部分
+	CreatedAt time.Time
+}
+
+// Query Page是offset模式时按相关度排序，游标模式时按时间倒序
+type Query struct {
+	Keyword  string
+	Type     string
+	Mode     string
+	AuthorID uint
+	From     *time.Time
+	To       *time.Time
+	Page     model.PageQuery
+}
+
+// Hit Title和Snippet已经转义过，命中的词用<em>包起来
+type Hit struct {
+	Type      string
+	ID        uint
+	PostID    uint
+	AuthorID  uint
+	Score     float64
+	Title     string
+	Snippet   string
+	CreatedAt time.Time
+}
+
+type Result struct {
+	Total int64
+	Hits  []Hit
+}
+
+type Index interface {
+	IndexDocument(doc Document) error
+	DeleteDocument(docType string, id uint) error
+	Search(query Query) (Result, error)
+}
+
+// NewIndex search.engine配置为memory时用内置的倒排索引，否则沿用MySQL全文索引
+func NewIndex(mysql Index) Index {
+	if viper.GetString("search.engine") == EngineMemory {
+		return NewMemoryIndex()
+	}
+	return mysql
+}
+
+func Embedded() bool {
+	return viper.GetString("search.engine") == EngineMemory
+}
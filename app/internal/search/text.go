@@ -0,0 +1,162 @@
+package search
+
+import (
+	"commmunity/app/utils"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const snippetSize = 80
+
+var plainPolicy = bluemonday.StrictPolicy()
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// Tokenize 英文和数字按单词切分并转小写，中日韩文字两个字一组，和MySQL的ngram解析器保持一致
+func Tokenize(text string) []string {
+	var tokens []string
+	var word, cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// Terms 去重后的查询词
+func Terms(keyword string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range Tokenize(keyword) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// PlainText 去掉帖子内容里的HTML标签
+func PlainText(content string) string {
+	return html.UnescapeString(plainPolicy.Sanitize(content))
+}
+
+// mark 标出文本里命中查询词的位置，按字符逐个转小写，保证下标和原文一致
+func mark(text []rune, terms []string) []bool {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(text))
+	for _, t := range terms {
+		term := []rune(t)
+		for i := 0; i+len(term) <= len(lower); i++ {
+			match := true
+			for j, r := range term {
+				if lower[i+j] != r {
+					match = false
+					break
+				}
+			}
+			if match {
+				for j := range term {
+					marked[i+j] = true
+				}
+			}
+		}
+	}
+	return marked
+}
+
+func render(text []rune, marked []bool, start int, end int) string {
+	var b strings.Builder
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		chunk := html.EscapeString(string(text[i:j]))
+		if marked[i] {
+			b.WriteString("<em>" + chunk + "</em>")
+		} else {
+			b.WriteString(chunk)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// Highlight 整段高亮，用于标题和昵称
+func Highlight(text string, terms []string) string {
+	runes := []rune(text)
+	return render(runes, mark(runes, terms), 0, len(runes))
+}
+
+// Visible 付费帖子对非VIP只公开前4行、200字，和帖子详情一致；摘要只能从这一段里截，不然搜索结果会把付费内容带出来
+func Visible(content string, paid bool) string {
+	if !paid {
+		return content
+	}
+	return utils.TruncateContent(content, 4, 200)
+}
+
+// Snippet 从第一个命中的位置附近截一段正文
+func Snippet(content string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(PlainText(content)), " "))
+	marked := mark(runes, terms)
+	first := 0
+	for i, m := range marked {
+		if m {
+			first = i
+			break
+		}
+	}
+	start := first - snippetSize/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetSize
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := render(runes, marked, start, end)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		keyword string
+		want    string
+	}{
+		{name: "相邻命中合并成一段", text: "Go语言入门", keyword: "go 语言", want: "<em>Go语言</em>入门"},
+		{name: "不区分大小写，保留原文大小写", text: "Learn GOLANG", keyword: "golang", want: "Learn <em>GOLANG</em>"},
+		{name: "HTML要转义", text: "<b>go</b>", keyword: "go", want: "&lt;b&gt;<em>go</em>&lt;/b&gt;"},
+		{name: "多处命中", text: "redis和redis", keyword: "redis", want: "<em>redis</em>和<em>redis</em>"},
+		{name: "没有命中", text: "hello", keyword: "world", want: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, Terms(tt.keyword)); got != tt.want {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", tt.text, tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	pad := strings.Repeat("字", 100)
+	tests := []struct {
+		name    string
+		content string
+		keyword string
+		want    string
+	}{
+		{
+			name:    "从命中位置前面一点开始截，两头省略",
+			content: pad + "关键" + pad,
+			keyword: "关键",
+			want:    "…" + strings.Repeat("字", 20) + "<em>关键</em>" + strings.Repeat("字", 58) + "…",
+		},
+		{
+			name:    "命中在开头不加前省略号",
+			content: "关键" + pad,
+			keyword: "关键",
+			want:    "<em>关键</em>" + strings.Repeat("字", 78) + "…",
+		},
+		{
+			name:    "去掉标签、合并空白",
+			content: "<p>hello\n\n  <b>world</b></p>",
+			keyword: "world",
+			want:    "hello <em>world</em>",
+		},
+		{
+			name:    "没有命中就从头截",
+			content: "short text",
+			keyword: "none",
+			want:    "short text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Snippet(tt.content, Terms(tt.keyword)); got != tt.want {
+				t.Errorf("Snippet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisible(t *testing.T) {
+	content := "line1\nline2\nline3\nline4\nline5"
+	if got := Visible(content, false); got != content {
+		t.Errorf("免费帖子应原样返回，got %q", got)
+	}
+	got := Visible(content, true)
+	if strings.Contains(got, "line5") || !strings.HasPrefix(got, "line1\nline2\nline3\nline4\n") {
+		t.Errorf("付费帖子只能公开前4行，got %q", got)
+	}
+}
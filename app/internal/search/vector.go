@@ -0,0 +1,161 @@
+package search
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+)
+
+type vectorDoc struct {
+	Document
+	vector []float32
+}
+
+// Neighbor 相似度是余弦值，越接近1越相似
+type Neighbor struct {
+	ID    uint
+	Score float64
+}
+
+// VectorIndex 进程内的帖子向量，查询时逐个算相似度；帖子量在几十万以内足够快
+type VectorIndex struct {
+	lock sync.RWMutex
+	docs map[uint]*vectorDoc
+}
+
+func NewVectorIndex() *VectorIndex {
+	return &VectorIndex{docs: make(map[uint]*vectorDoc)}
+}
+
+func (v *VectorIndex) Upsert(doc Document, vector []float32) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.docs[doc.ID] = &vectorDoc{Document: doc, vector: vector}
+}
+
+func (v *VectorIndex) Delete(id uint) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.docs, id)
+}
+
+func (v *VectorIndex) Vector(id uint) ([]float32, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	doc, ok := v.docs[id]
+	if !ok {
+		return nil, false
+	}
+	return doc.vector, true
+}
+
+func (v *VectorIndex) Len() int {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return len(v.docs)
+}
+
+func dot(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// Nearest 最相似的k个，exclude一般是帖子自己
+func (v *VectorIndex) Nearest(vector []float32, k int, exclude uint, minScore float64) []Neighbor {
+	v.lock.RLock()
+	neighbors := make([]Neighbor, 0, k+1)
+	for id, doc := range v.docs {
+		if id == exclude {
+			continue
+		}
+		if s := dot(vector, doc.vector); s >= minScore {
+			neighbors = append(neighbors, Neighbor{ID: id, Score: s})
+		}
+	}
+	v.lock.RUnlock()
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Score != neighbors[j].Score {
+			return neighbors[i].Score > neighbors[j].Score
+		}
+		return neighbors[i].ID > neighbors[j].ID
+	})
+	if len(neighbors) > k {
+		neighbors = neighbors[:k]
+	}
+	return neighbors
+}
+
+// Search 语义搜索，相似度低于minScore的不算命中；筛选和翻页规则和关键词搜索一样
+func (v *VectorIndex) Search(vector []float32, query Query, minScore float64) Result {
+	terms := Terms(query.Keyword)
+	scores := make(map[uint]float64)
+	v.lock.RLock()
+	docs := make([]*vectorDoc, 0)
+	for id, doc := range v.docs {
+		if !matches(&doc.Document, query) {
+			continue
+		}
+		if s := dot(vector, doc.vector); s >= minScore {
+			scores[id] = s
+			docs = append(docs, doc)
+		}
+	}
+	v.lock.RUnlock()
+	if query.Page.Cursor {
+		sort.Slice(docs, func(i, j int) bool {
+			if !docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+				return docs[i].CreatedAt.After(docs[j].CreatedAt)
+			}
+			return docs[i].ID > docs[j].ID
+		})
+	} else {
+		sort.Slice(docs, func(i, j int) bool {
+			if scores[docs[i].ID] != scores[docs[j].ID] {
+				return scores[docs[i].ID] > scores[docs[j].ID]
+			}
+			return docs[i].ID > docs[j].ID
+		})
+	}
+	result := Result{Total: int64(len(docs)), Hits: []Hit{}}
+	start := 0
+	if !query.Page.Cursor {
+		start = query.Page.Offset
+	}
+	for i := start; i < len(docs) && i < start+query.Page.Limit; i++ {
+		doc := docs[i]
+		result.Hits = append(result.Hits, Hit{
+			Type:      doc.Type,
+			ID:        doc.ID,
+			AuthorID:  doc.AuthorID,
+			Score:     scores[doc.ID],
+			Title:     Highlight(doc.Title, terms),
+			Snippet:   Snippet(Visible(doc.Content, doc.Paid), terms),
+			CreatedAt: doc.CreatedAt,
+		})
+	}
+	return result
+}
+
+// EncodeVector 存数据库用，小端float32
+func EncodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func DecodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := HashEmbedder{Dim: 64}
+	texts := []string{"Go语言并发编程", "Go语言并发编程", "今天天气很好", ""}
+	a, err := e.Embed(texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := HashEmbedder{Dim: 64}.Embed(texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Error("同样的文本两次向量化结果不一样")
+	}
+	for i, v := range a[:3] {
+		if len(v) != 64 {
+			t.Fatalf("vector %d dim = %d, want 64", i, len(v))
+		}
+		if n := norm(v); math.Abs(n-1) > 1e-5 {
+			t.Errorf("vector %d norm = %v, want 1", i, n)
+		}
+	}
+	if norm(a[3]) != 0 {
+		t.Error("空文本应该是零向量")
+	}
+	if s := dot(a[0], a[1]); math.Abs(s-1) > 1e-5 {
+		t.Errorf("相同文本相似度 = %v, want 1", s)
+	}
+	if dot(a[0], a[2]) >= dot(a[0], a[1]) {
+		t.Error("不同文本的相似度应该低于相同文本")
+	}
+	if e.Name() != "hash-64" {
+		t.Errorf("Name() = %q", e.Name())
+	}
+	if _, err = (HashEmbedder{}).Embed(texts); err == nil {
+		t.Error("维度为0应该报错")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	v := Normalize([]float32{3, 4})
+	if math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 {
+		t.Errorf("Normalize([3 4]) = %v", v)
+	}
+	if z := Normalize([]float32{0, 0}); !reflect.DeepEqual(z, []float32{0, 0}) {
+		t.Errorf("零向量应原样返回，got %v", z)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	v := NewVectorIndex()
+	v.Upsert(Document{ID: 1}, Normalize([]float32{1, 0}))
+	v.Upsert(Document{ID: 2}, Normalize([]float32{1, 1}))
+	v.Upsert(Document{ID: 3}, Normalize([]float32{0, 1}))
+	v.Upsert(Document{ID: 4}, Normalize([]float32{-1, 0}))
+	v.Upsert(Document{ID: 5}, Normalize([]float32{1, 1}))
+	ids := func(ns []Neighbor) []uint {
+		out := make([]uint, len(ns))
+		for i, n := range ns {
+			out[i] = n.ID
+		}
+		return out
+	}
+	query := Normalize([]float32{1, 0.2})
+	if got := ids(v.Nearest(query, 10, 0, -1)); !reflect.DeepEqual(got, []uint{1, 5, 2, 3, 4}) {
+		t.Errorf("按相似度排序，同分ID大的在前: %v", got)
+	}
+	if got := ids(v.Nearest(query, 10, 1, -1)); !reflect.DeepEqual(got, []uint{5, 2, 3, 4}) {
+		t.Errorf("exclude没有排除自己: %v", got)
+	}
+	if got := ids(v.Nearest(query, 2, 0, -1)); !reflect.DeepEqual(got, []uint{1, 5}) {
+		t.Errorf("只取前k个: %v", got)
+	}
+	if got := ids(v.Nearest(query, 10, 0, 0.5)); !reflect.DeepEqual(got, []uint{1, 5, 2}) {
+		t.Errorf("低于minScore的不返回: %v", got)
+	}
+	v.Delete(1)
+	if _, ok := v.Vector(1); ok || v.Len() != 4 {
+		t.Error("删除后还在索引里")
+	}
+}
+
+func TestEncodeVector(t *testing.T) {
+	v := []float32{0, 1, -1.5, 3.1415926, float32(math.Inf(1)), math.SmallestNonzeroFloat32}
+	b := EncodeVector(v)
+	if len(b) != 4*len(v) {
+		t.Fatalf("len = %d, want %d", len(b), 4*len(v))
+	}
+	if got := DecodeVector(b); !reflect.DeepEqual(got, v) {
+		t.Errorf("DecodeVector(EncodeVector(v)) = %v, want %v", got, v)
+	}
+	if got := DecodeVector(nil); len(got) != 0 {
+		t.Errorf("DecodeVector(nil) = %v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/zlog"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Actor 操作人，由请求上下文得到
+type Actor struct {
+	UserID    uint
+	IP        string
+	RequestID string
+}
+
+func ActorOf(c *gin.Context) Actor {
+	return Actor{
+		UserID:    c.GetUint("userId"),
+		IP:        c.ClientIP(),
+		RequestID: c.GetString("requestId"),
+	}
+}
+
+func marshal(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		zlog.Warn("审计数据序列化失败", zap.Error(err))
+		return ""
+	}
+	return string(b)
+}
+
+// Record 所有管理操作都通过这里留痕，写入失败只记日志，不影响操作本身
+func Record(actor Actor, action string, targetType string, targetId uint, before interface{}, after interface{}) {
+	log := model.AuditLog{
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		Before:     marshal(before),
+		After:      marshal(after),
+		IP:         actor.IP,
+		RequestID:  actor.RequestID,
+	}
+	if err := global.Audit.SaveAuditLog(&log); err != nil {
+		zlog.Error("审计日志丢失", zap.Uint("actor", actor.UserID), zap.String("action", action),
+			zap.String("target", targetType), zap.Uint("id", targetId))
+	}
+}
+
+func GetLogs(role int, query model.AuditQuery, offset int, limit int) ([]model.AuditLog, bool, error) {
+	if !rbac.HasPermission(role, model.PermAuditView) {
+		return nil, false, nil
+	}
+	logs, err := global.Audit.GetAuditLogs(query, offset, limit)
+	if err != nil {
+		return nil, true, err
+	}
+	return logs, true, nil
+}
+
+func Export(role int, query model.AuditQuery, w io.Writer) (bool, error) {
+	if !rbac.HasPermission(role, model.PermAuditView) {
+		return false, nil
+	}
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "before", "after", "ip", "request_id"})
+	if err != nil {
+		return true, err
+	}
+	err = global.Audit.ExportAuditLogs(query, func(logs []model.AuditLog) error {
+		for _, l := range logs {
+			err := writer.Write([]string{
+				strconv.FormatUint(uint64(l.ID), 10),
+				l.CreatedAt.Format("2006-01-02 15:04:05"),
+				strconv.FormatUint(uint64(l.ActorID), 10),
+				l.Action,
+				l.TargetType,
+				strconv.FormatUint(uint64(l.TargetID), 10),
+				l.Before,
+				l.After,
+				l.IP,
+				l.RequestID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return true, err
+	}
+	writer.Flush()
+	return true, writer.Error()
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/ws"
+	"commmunity/app/zlog"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const announcementBatchSize = 1000
+
+// AnnouncementStaleAfter 发布中的公告超过这么久没有进度，认为投递它的进程已经挂了，由定时任务接着投
+const AnnouncementStaleAfter = 5 * time.Minute
+
+func CreateAnnouncement(role int, senderId uint, req model.AnnouncementRequest, publishAt time.Time, expireAt *time.Time) (error, bool, uint) { //bool判断是否有权限，返回的ID为0表示信息不完善
+	if !rbac.HasPermission(role, model.PermAnnouncement) {
+		return nil, false, 0
+	}
+	if req.Title == "" || req.Content == "" {
+		return nil, true, 0
+	}
+	if req.Target != model.TargetAll && req.Target != model.TargetVip && req.Target != model.TargetUsers {
+		return nil, true, 0
+	}
+	if req.Target == model.TargetUsers && len(req.UserIDs) == 0 {
+		return nil, true, 0
+	}
+	if expireAt != nil && !expireAt.After(publishAt) {
+		return nil, true, 0
+	}
+	ids := make([]string, 0, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		ids = append(ids, strconv.FormatUint(uint64(id), 10))
+	}
+	announcement := model.Announcement{
+		SenderID:  senderId,
+		Title:     req.Title,
+		Content:   req.Content,
+		Target:    req.Target,
+		UserIDs:   strings.Join(ids, ","),
+		PublishAt: publishAt,
+		ExpireAt:  expireAt,
+		Status:    model.AnnouncementPending,
+	}
+	if err := global.Message.CreateAnnouncement(&announcement); err != nil {
+		return err, true, 0
+	}
+	if !publishAt.After(time.Now()) {
+		go DispatchAnnouncement(announcement)
+	}
+	return nil, true, announcement.ID
+}
+
+// DispatchAnnouncement 在线用户直接推送，离线用户分批落库；按用户ID从小到大投递，每批记一次进度，中断后从进度处继续
+func DispatchAnnouncement(announcement model.Announcement) {
+	var ok bool
+	var err error
+	if announcement.Status == model.AnnouncementSending {
+		ok, err = global.Message.ReclaimAnnouncement(announcement.ID, time.Now().Add(-AnnouncementStaleAfter))
+	} else {
+		ok, err = global.Message.ClaimAnnouncement(announcement.ID, model.AnnouncementPending, model.AnnouncementSending)
+	}
+	if err != nil || !ok {
+		return
+	}
+	if announcement.ExpireAt != nil && announcement.ExpireAt.Before(time.Now()) {
+		zlog.Warn("公告已过期，不再投递", zap.Uint("announcementId", announcement.ID))
+		_ = global.Message.UpdateAnnouncementStatus(announcement.ID, model.AnnouncementPublished)
+		return
+	}
+	content := fmt.Sprintf("【%s】%s", announcement.Title, announcement.Content)
+	lastId := announcement.LastUser
+	next := func() ([]uint, error) {
+		return global.User.GetUserIds(lastId, announcement.Target == model.TargetVip, announcementBatchSize)
+	}
+	if announcement.Target == model.TargetUsers {
+		var ids []uint
+		for _, s := range strings.Split(announcement.UserIDs, ",") {
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, uint(id))
+		}
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+		next = func() ([]uint, error) {
+			start, _ := slices.BinarySearch(ids, lastId+1)
+			return ids[start:min(start+announcementBatchSize, len(ids))], nil
+		}
+	}
+	for {
+		ids, err := next()
+		if err != nil {
+			//回到待发布，下一轮定时任务从进度处继续
+			zlog.Error("公告投递中断", zap.Uint("announcementId", announcement.ID), zap.Error(err))
+			_, _ = global.Message.ClaimAnnouncement(announcement.ID, model.AnnouncementSending, model.AnnouncementPending)
+			return
+		}
+		if len(ids) == 0 {
+			break
+		}
+		deliverAnnouncement(announcement, content, ids)
+		lastId = ids[len(ids)-1]
+		ok, err = global.Message.SaveAnnouncementProgress(announcement.ID, lastId)
+		if err != nil {
+			_, _ = global.Message.ClaimAnnouncement(announcement.ID, model.AnnouncementSending, model.AnnouncementPending)
+			return
+		}
+		if !ok {
+			zlog.Info("公告已撤回，停止投递", zap.Uint("announcementId", announcement.ID))
+			return
+		}
+	}
+	_, err = global.Message.ClaimAnnouncement(announcement.ID, model.AnnouncementSending, model.AnnouncementPublished)
+	if err != nil {
+		return
+	}
+	zlog.Info("公告投递完成", zap.Uint("announcementId", announcement.ID))
+}
+
+func deliverAnnouncement(announcement model.Announcement, content string, userIds []uint) {
+	createdAt := time.Now().Format("2006-01-02 15:04:05")
+	offline := make([]model.Notice, 0, len(userIds))
+	for _, id := range userIds {
+		if ws.GlobalManager.IsOnline(id) {
+			ws.GlobalManager.SendToUser(id, ws.Response{
+				Code: ws.Notification,
+				Data: ws.NoticeData{
+					Type:      model.NoticeSystem,
+					SenderId:  announcement.SenderID,
+					Content:   content,
+					CreatedAt: createdAt,
+				},
+			})
+			continue
+		}
+		offline = append(offline, model.Notice{
+			UserID:         id,
+			Type:           model.NoticeSystem,
+			SenderID:       announcement.SenderID,
+			AnnouncementID: announcement.ID,
+			Content:        content,
+			ExpireAt:       announcement.ExpireAt,
+		})
+	}
+	if len(offline) == 0 {
+		return
+	}
+	if err := global.Message.SaveNotices(offline); err != nil {
+		zlog.Error("离线公告保存失败", zap.Uint("announcementId", announcement.ID), zap.Int("count", len(offline)))
+	}
+}
+
+// CancelAnnouncement 第一个bool判断是否有权限，第二个bool判断公告是否存在；发布中的公告在下一批投递前停下
+func CancelAnnouncement(role int, id uint) (model.Announcement, error, bool, bool) {
+	if !rbac.HasPermission(role, model.PermAnnouncement) {
+		return model.Announcement{}, nil, false, false
+	}
+	announcement, err := global.Message.GetAnnouncement(id)
+	if err != nil {
+		return model.Announcement{}, err, true, false
+	}
+	if announcement.ID == 0 {
+		return model.Announcement{}, nil, true, false
+	}
+	err = global.Message.UpdateAnnouncementStatus(id, model.AnnouncementCancelled)
+	if err != nil {
+		return announcement, err, true, true
+	}
+	return announcement, global.Message.ExpireAnnouncementNotices(id, time.Now()), true, true
+}
+
+type AnnouncementDTO struct {
+	ID        uint   `json:"id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	PublishAt string `json:"publish_at"`
+	ExpireAt  string `json:"expire_at"`
+}
+
+func GetActiveAnnouncements(account string) ([]AnnouncementDTO, error) {
+	user, err := global.User.GetUserId(account)
+	if err != nil {
+		return nil, err
+	}
+	announcements, err := global.Message.GetActiveAnnouncements(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]AnnouncementDTO, 0, len(announcements))
+	for _, a := range announcements {
+		if a.Target == model.TargetVip && !user.Vip {
+			continue
+		}
+		if a.Target == model.TargetUsers && !containsId(a.UserIDs, user.ID) {
+			continue
+		}
+		dto := AnnouncementDTO{
+			ID:        a.ID,
+			Title:     a.Title,
+			Content:   a.Content,
+			PublishAt: a.PublishAt.Format("2006-01-02 15:04:05"),
+		}
+		if a.ExpireAt != nil {
+			dto.ExpireAt = a.ExpireAt.Format("2006-01-02 15:04:05")
+		}
+		results = append(results, dto)
+	}
+	return results, nil
+}
+
+func containsId(ids string, userId uint) bool {
+	target := strconv.FormatUint(uint64(userId), 10)
+	for _, s := range strings.Split(ids, ",") {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,18 @@
 package controller
 
 import (
-	"commmunity/app/internal/ai"
 	"commmunity/app/internal/db/global"
 	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/audit"
+	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/service/recommend"
+	"commmunity/app/internal/service/sanction"
 	"commmunity/app/internal/ws"
 	"commmunity/app/utils"
-	"commmunity/app/zlog"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -14,21 +20,75 @@ import (
 	"time"
 
 	"github.com/microcosm-cc/bluemonday"
-	"go.uber.org/zap"
+	"github.com/spf13/viper"
 	"golang.org/x/sync/singleflight"
 )
 
 var requestGroup singleflight.Group
 
-func CreatePost(account string, title string, content string) (error, bool) {
+// needsReview 注册不满N天或已发布帖子少于M篇的账号，发帖需先审核
+func needsReview(user model.User) (bool, error) {
+	if rbac.HasPermission(user.Role, model.PermPostReview) {
+		return false, nil
+	}
+	days := viper.GetInt("moderation.newAccountDays")
+	if days > 0 && time.Since(user.CreatedAt) < time.Duration(days)*24*time.Hour {
+		return true, nil
+	}
+	minPosts := viper.GetInt64("moderation.minApprovedPosts")
+	if minPosts <= 0 {
+		return false, nil
+	}
+	count, err := global.Post.CountPublishedPosts(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return count < minPosts, nil
+}
+
+func CreatePost(account string, title string, content string) (error, bool, bool) { //第一个bool判断是否允许发帖，第二个bool判断是否进入审核
 	user, err := global.User.GetUserId(account)
 	if err != nil {
-		return err, false
+		return err, false, false
 	}
 	if user.UserProfile.IsMuted {
-		return nil, false
+		return nil, false, false
+	}
+	postBanned, err := sanction.IsPostBanned(user.ID)
+	if err != nil {
+		return err, false, false
+	}
+	if postBanned {
+		return nil, false, false
 	}
-	return global.Post.CreatePost(user.ID, title, content), true
+	title, titleHits, err := filter.Filter(title)
+	if err != nil {
+		return err, false, false
+	}
+	content, contentHits, err := filter.Filter(content)
+	if err != nil {
+		return err, false, false
+	}
+	pending, err := needsReview(user)
+	if err != nil {
+		return err, false, false
+	}
+	status := model.PostPublished
+	if pending {
+		status = model.PostPendingReview
+	}
+	postId, err := global.Post.CreatePost(user.ID, title, content, status)
+	if err != nil {
+		return err, false, false
+	}
+	filter.Flag(model.ReportPost, postId, user.ID, append(titleHits, contentHits...))
+	if !pending {
+		hot.Track(postId, time.Now())
+		feed.Publish(user.ID, postId)
+		indexer.Post(postId)
+		_ = global.PostRedis.DelPostListCache()
+	}
+	return nil, true, pending
 }
 
 type PostsDTO struct {
@@ -42,63 +102,88 @@ type PostsDTO struct {
 	CommentCount uint   `json:"comment_count"`
 }
 
-func GetPostList(offset int, pageSize int) ([]PostsDTO, error) {
-	pc, err := global.PostRedis.GetPostListCache(offset, pageSize)
-	if err != nil {
-		return nil, err
+func newPostsDTO(p model.Post) PostsDTO {
+	return PostsDTO{
+		Name:         p.User.UserProfile.Name,
+		Avatar:       p.User.UserProfile.Avatar,
+		PostID:       p.ID,
+		Title:        p.Title,
+		Paid:         p.Paid,
+		ViewCount:    p.ViewCount,
+		LikeCount:    p.LikeCount,
+		CommentCount: p.CommentCount,
+	}
+}
+
+// pageKey 缓存key里区分页的部分，和red里列表缓存的约定一致
+func pageKey(page model.PageQuery) string {
+	if !page.Cursor {
+		return strconv.Itoa(page.Offset)
 	}
-	if pc == "[]" {
-		return []PostsDTO{}, nil
+	if page.CursorID == 0 {
+		return "c"
+	}
+	return "c" + utils.EncodeCursor(page.CursorTime, page.CursorID)
+}
+
+// nextCursor 游标模式下取满一页才有下一页，返回空串表示到底了
+func nextCursor(page model.PageQuery, count int, createdAt time.Time, id uint) string {
+	if !page.Cursor || count < page.Limit {
+		return ""
+	}
+	return utils.EncodeCursor(createdAt, id)
+}
+
+type postListPage struct {
+	Posts []PostsDTO `json:"posts"`
+	Next  string     `json:"next"`
+}
+
+// GetPostList 第二个返回值是下一页的游标，offset模式下始终为空
+func GetPostList(page model.PageQuery) ([]PostsDTO, string, error) {
+	key := pageKey(page)
+	pc, err := global.PostRedis.GetPostListCache(key, page.Limit)
+	if err != nil {
+		return nil, "", err
 	}
 	if pc != "" {
-		var cachedPosts []PostsDTO
-		if err = json.Unmarshal([]byte(pc), &cachedPosts); err == nil {
-			return cachedPosts, nil
-		} else {
-			return nil, err
+		var cached postListPage
+		//旧格式的缓存解析不了就当没命中，等过期
+		if err = json.Unmarshal([]byte(pc), &cached); err == nil {
+			return cached.Posts, cached.Next, nil
 		}
 	}
-	val, err, _ := requestGroup.Do(fmt.Sprintf("post:list:%d:%d", offset, pageSize), func() (interface{}, error) {
-		ps, err := global.Post.GetPostList(offset, pageSize)
+	val, err, _ := requestGroup.Do(fmt.Sprintf("post:list:%s:%d", key, page.Limit), func() (interface{}, error) {
+		ps, err := global.Post.GetPostList(page)
 		if err != nil {
 			return nil, err
 		}
-		posts := make([]PostsDTO, len(ps))
+		result := postListPage{Posts: make([]PostsDTO, len(ps))}
 		for i, p := range ps {
-			posts[i] = PostsDTO{
-				Name:         p.User.UserProfile.Name,
-				Avatar:       p.User.UserProfile.Avatar,
-				PostID:       p.ID,
-				Title:        p.Title,
-				Paid:         p.Paid,
-				ViewCount:    p.ViewCount,
-				LikeCount:    p.LikeCount,
-				CommentCount: p.CommentCount,
-			}
+			result.Posts[i] = newPostsDTO(p)
 		}
-		if len(posts) == 0 {
-			err = global.PostRedis.SetPostListCache(offset, pageSize, []PostsDTO{})
-			if err != nil {
-				return nil, err
-			}
-			return []PostsDTO{}, nil
+		if len(ps) > 0 {
+			last := ps[len(ps)-1]
+			result.Next = nextCursor(page, len(ps), last.CreatedAt, last.ID)
 		}
-		err = global.PostRedis.SetPostListCache(offset, pageSize, posts)
+		err = global.PostRedis.SetPostListCache(key, page.Limit, result)
 		if err != nil {
 			return nil, err
 		}
-		return posts, nil
+		return result, nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return val.([]PostsDTO), nil
+	result := val.(postListPage)
+	return result.Posts, result.Next, nil
 }
 
 type PostDTO struct {
 	PostsDTO
 	Content   string       `json:"content"`
 	UserId    uint         `json:"user_id"`
+	Status    int          `json:"status"`
 	Comment   []CommentDTO `json:"comment"`
 	AiSummary string       `json:"ai_summary"`
 }
@@ -134,6 +219,7 @@ func GetPostDetail(account string, postId uint) (PostDTO, error) {
 				if err != nil {
 					return PostDTO{}, err
 				}
+				hot.View(postId)
 			}
 			viewCount, err := global.PostRedis.ViewCount(key)
 			if err != nil {
@@ -157,7 +243,7 @@ func GetPostDetail(account string, postId uint) (PostDTO, error) {
 		if err != nil {
 			return PostDTO{}, err
 		}
-		if p.ID == 0 {
+		if p.ID == 0 || p.Hidden {
 			_ = global.PostRedis.SetPostCache(postId, map[string]interface{}{})
 			return PostDTO{}, nil
 		}
@@ -185,11 +271,15 @@ func GetPostDetail(account string, postId uint) (PostDTO, error) {
 			},
 			Content: p.Content,
 			UserId:  p.User.ID,
+			Status:  p.Status,
 			Comment: commentDTOs,
 		}
-		err = global.PostRedis.SetPostCache(postId, postCache)
-		if err != nil {
-			return PostDTO{}, err
+		//未发布的帖子只有作者和审核人员能看，不进缓存
+		if p.Status == model.PostPublished {
+			err = global.PostRedis.SetPostCache(postId, postCache)
+			if err != nil {
+				return PostDTO{}, err
+			}
 		}
 		if !p.Paid || user.Vip {
 			post := postCache
@@ -204,6 +294,16 @@ func GetPostDetail(account string, postId uint) (PostDTO, error) {
 		return PostDTO{}, err
 	}
 	post := val.(PostDTO)
+	if post.Status != model.PostPublished {
+		viewer, err := global.User.GetUserId(account)
+		if err != nil {
+			return PostDTO{}, err
+		}
+		if viewer.ID != post.UserId && !rbac.HasPermission(viewer.Role, model.PermPostReview) {
+			return PostDTO{}, nil
+		}
+		return post, nil
+	}
 	key := fmt.Sprintf("post:view:%d", postId)
 	limitKey := fmt.Sprintf("post:view:limit:%s:%d", account, postId)
 	flag, err := global.PostRedis.LimitView(limitKey)
@@ -215,43 +315,11 @@ func GetPostDetail(account string, postId uint) (PostDTO, error) {
 		if err != nil {
 			return PostDTO{}, err
 		}
+		hot.View(postId)
 	}
 	return post, nil
 }
 
-func AiSummary(account string, postId uint) (string, error) {
-	summary, err := global.PostRedis.GetSummaryCache(postId)
-	if err != nil {
-		return "", err
-	}
-	if summary != "" {
-		return summary, nil
-	}
-	val, err, _ := requestGroup.Do(fmt.Sprintf("post:%d", postId), func() (interface{}, error) {
-		user, err := global.User.GetUserId(account)
-		p, err := global.Post.GetPostDetail(postId)
-		if err != nil {
-			return "", err
-		}
-		if user.Vip {
-			content, err := ai.AutoSummary(p.Content)
-			if err != nil {
-				return "", err
-			}
-			err = global.PostRedis.SetSummaryCache(postId, content)
-			if err != nil {
-				return "", err
-			}
-			return content, nil
-		}
-		return "", nil
-	})
-	if err != nil {
-		return "", err
-	}
-	return val.(string), nil
-}
-
 func CreateComment(account string, postID uint, content string) (error, bool) {
 	user, err := global.User.GetUserId(account)
 	if err != nil {
@@ -260,14 +328,27 @@ func CreateComment(account string, postID uint, content string) (error, bool) {
 	if user.UserProfile.IsMuted {
 		return nil, false
 	}
-	posterId, err := global.Post.GetPoster(postID)
+	//和看帖子的规则一致：被隐藏、没发布的帖子只有作者和审核人员能评论
+	p, err := global.Post.GetPost(postID)
 	if err != nil {
 		return err, false
 	}
+	if p.ID == 0 || (p.Hidden || p.Status != model.PostPublished) && user.ID != p.UserID && !rbac.HasPermission(user.Role, model.PermPostReview) {
+		return ErrPostNotFound, false
+	}
+	posterId := p.UserID
 	cleanContent := bluemonday.UGCPolicy().Sanitize(content) //防xss
-	if err = global.Post.CreateComment(user.ID, postID, cleanContent); err != nil {
+	cleanContent, hits, err := filter.Filter(cleanContent)
+	if err != nil {
+		return err, false
+	}
+	commentId, err := global.Post.CreateComment(user.ID, postID, cleanContent)
+	if err != nil {
 		return err, false
 	}
+	filter.Flag(model.ReportComment, commentId, user.ID, hits)
+	hot.Comment(postID, 1)
+	indexer.Comment(commentId)
 	ws.SendNotice(posterId, 2, user.ID, postID, cleanContent)
 	return global.PostRedis.DelPostCache(postID), true
 }
@@ -348,25 +429,37 @@ func GetUserProfile(id uint) (UserProfileDTO, error) {
 	return val.(UserProfileDTO), nil
 }
 
-func DeletePost(account string, postID uint, role int) (error, bool) {
+func DeletePost(account string, postID uint, role int, actor audit.Actor) (error, bool) {
 	//先判断是否为管理员，是否为作者文章
 	user, err := global.Post.GetPostDetail(postID)
 	if err != nil {
 		return err, false
 	}
 	userAccount := user.User.Account
-	if userAccount == account || role == model.RoleAdmin {
+	if userAccount == account || rbac.HasPermission(role, model.PermPostDeleteAny) {
 		err = global.Post.DeletePost(postID)
 		if err != nil {
 			return err, false
 		}
 		err = global.PostRedis.DelPostCache(postID)
+		hot.Remove(postID)
+		feed.Unpublish(user.UserID, postID)
+		commentIds := make([]uint, len(user.Comments))
+		for i, c := range user.Comments {
+			commentIds[i] = c.ID
+		}
+		indexer.RemovePost(postID, commentIds)
+		_ = global.PostRedis.DelPostListCache()
+		if userAccount != account {
+			audit.Record(actor, model.AuditPostDelete, "post", postID,
+				map[string]interface{}{"user_id": user.UserID, "title": user.Title, "content": user.Content}, nil)
+		}
 		return nil, true
 	}
 	return nil, false
 }
 
-func DeleteComment(account string, commentID uint, role int) (error, bool) {
+func DeleteComment(account string, commentID uint, role int, actor audit.Actor) (error, bool) {
 	comment, err := global.Post.GetCommentDetail(commentID)
 	if err != nil {
 		return err, false
@@ -377,7 +470,7 @@ func DeleteComment(account string, commentID uint, role int) (error, bool) {
 		return err, false
 	}
 	posterAccount := post.User.Account
-	if commentAccount == account || posterAccount == account || role == model.RoleAdmin {
+	if commentAccount == account || posterAccount == account || rbac.HasPermission(role, model.PermCommentDeleteAny) {
 		err = global.Post.DeleteComment(commentID)
 		if err != nil {
 			return err, false
@@ -386,6 +479,12 @@ func DeleteComment(account string, commentID uint, role int) (error, bool) {
 		if err != nil {
 			return err, false
 		}
+		hot.Comment(comment.PostID, -1)
+		indexer.RemoveComment(commentID)
+		if commentAccount != account {
+			audit.Record(actor, model.AuditCommentDelete, "comment", commentID,
+				map[string]interface{}{"user_id": comment.UserID, "post_id": comment.PostID, "content": comment.Content}, nil)
+		}
 		return nil, true
 	}
 	return nil, false
@@ -403,12 +502,16 @@ func ToggleLike(postId uint, account string, userId uint) (bool, int, error) {
 			return false, 0, err
 		}
 		isLike = false
+		hot.Like(postId, -1)
+		recommend.Like(account, postId, false)
 	} else {
 		err = global.PostRedis.Like(key, account)
 		if err != nil {
 			return false, 0, err
 		}
 		isLike = true
+		hot.Like(postId, 1)
+		recommend.Like(account, postId, true)
 		poster, err := global.Post.GetPoster(postId)
 		if err != nil {
 			return false, 0, err
@@ -440,79 +543,81 @@ func RateLimiting(ctx context.Context, key string, limitDuration time.Duration,
 	return true, nil
 }
 
-func GetHotRank() ([]PostsDTO, map[uint]float64, error) {
-	var postIds []uint
-	score := make(map[uint]float64)
-	postsZ, err := global.PostRedis.GetHotRank()
+type HotPostDTO struct {
+	Post  PostsDTO `json:"post"`
+	Score float64  `json:"score"`
+}
+
+// GetHotRank 按榜单顺序返回，数据库里已经不存在或被隐藏的帖子直接跳过
+func GetHotRank(window string) ([]HotPostDTO, error) {
+	entries, err := hot.Top(window, 10)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	for _, z := range postsZ {
-		idStr := z.Member.(string)
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			zlog.Error("解析字符串失败", zap.Error(err))
-			return nil, nil, err
-		}
-		postId := uint(id)
-		postIds = append(postIds, postId)
-		score[postId] = z.Score
+	postIds := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		postIds = append(postIds, e.PostID)
 	}
-	val, err, _ := requestGroup.Do("post:hotList", func() (interface{}, error) {
+	if len(postIds) == 0 {
+		return []HotPostDTO{}, nil
+	}
+	val, err, _ := requestGroup.Do("post:hotList:"+window, func() (interface{}, error) {
 		ps, err := global.Post.HotPosts(postIds)
 		if err != nil {
 			return nil, err
 		}
-		posts := make([]PostsDTO, len(ps))
-		for i, p := range ps {
-			posts[i] = PostsDTO{
-				Name:         p.User.UserProfile.Name,
-				Avatar:       p.User.UserProfile.Avatar,
-				PostID:       p.ID,
-				Title:        p.Title,
-				ViewCount:    p.ViewCount,
-				LikeCount:    p.LikeCount,
-				CommentCount: p.CommentCount,
-			}
+		posts := make(map[uint]PostsDTO, len(ps))
+		for _, p := range ps {
+			posts[p.ID] = newPostsDTO(p)
 		}
 		return posts, nil
 	})
-	return val.([]PostsDTO), score, nil
+	if err != nil {
+		return nil, err
+	}
+	posts := val.(map[uint]PostsDTO)
+	result := make([]HotPostDTO, 0, len(entries))
+	for _, e := range entries {
+		if p, ok := posts[e.PostID]; ok {
+			result = append(result, HotPostDTO{Post: p, Score: e.Score})
+		}
+	}
+	return result, nil
 }
 
-func SearchPosts(keyword string, offset int, pageSize int) ([]PostsDTO, error) {
-	posts, err := global.Post.SearchPosts(keyword, offset, pageSize)
+// PostPaid 审计用，取帖子当前是否付费
+func PostPaid(postId uint) (bool, error) {
+	post, err := global.Post.GetPostDetail(postId)
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+	return post.Paid, nil
+}
+
+// IsVip 审计用，取用户当前是否是vip
+func IsVip(userId uint) (bool, error) {
+	user, err := global.User.GetUserById(userId)
+	if err != nil || user == nil {
+		return false, err
 	}
-	var results []PostsDTO
-	for _, p := range posts {
-		results = append(results, PostsDTO{
-			Name:         p.User.UserProfile.Name,
-			Avatar:       p.User.UserProfile.Avatar,
-			PostID:       p.ID,
-			Title:        p.Title,
-			ViewCount:    p.ViewCount,
-			LikeCount:    p.LikeCount,
-			CommentCount: p.CommentCount,
-		})
-	}
-	return results, nil
+	return user.Vip, nil
 }
 
 func SetPostPaid(role int, postId uint) (bool, error) {
-	if role == model.RoleAdmin {
+	if rbac.HasPermission(role, model.PermPostPaid) {
 		err := global.Post.SetPostPaid(postId, true)
 		if err != nil {
 			return false, err
 		}
+		//搜索摘要要改成只取公开部分
+		indexer.Post(postId)
 		return true, global.PostRedis.DelPostCache(postId)
 	}
 	return false, nil
 }
 
 func PayVip(role int, userId uint) (bool, error) {
-	if role == model.RoleAdmin {
+	if rbac.HasPermission(role, model.PermVipGrant) {
 		return true, global.User.SetVip(userId, true)
 	}
 	return false, nil
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/model"
+	"errors"
+	"testing"
+)
+
+var errCommentSaved = errors.New("comment saved")
+
+// fakeCommentPosts 写评论时直接返回errCommentSaved，后面的通知、热度、索引都不会走到
+type fakeCommentPosts struct {
+	msq.PostData
+	post model.Post
+}
+
+func (f *fakeCommentPosts) GetPost(postId uint) (model.Post, error) {
+	if f.post.ID != postId {
+		return model.Post{}, nil
+	}
+	return f.post, nil
+}
+
+func (f *fakeCommentPosts) CreateComment(userID uint, postID uint, content string) (uint, error) {
+	return 0, errCommentSaved
+}
+
+// fakeWords 空词库，敏感词过滤原样放行
+type fakeWords struct {
+	msq.ModerationData
+}
+
+func (fakeWords) GetAllWords() ([]model.SensitiveWord, error) { return nil, nil }
+
+func TestCreateCommentVisibility(t *testing.T) {
+	author := model.User{Role: model.RoleUser}
+	author.ID = 1
+	other := model.User{Role: model.RoleUser}
+	other.ID = 2
+	moderator := model.User{Role: model.RoleModerator}
+	moderator.ID = 3
+	oldUser, oldPost, oldModeration := global.User, global.Post, global.Moderation
+	global.User = &fakeSummaryUsers{users: map[string]model.User{"author": author, "other": other, "mod": moderator}}
+	global.Moderation = fakeWords{}
+	t.Cleanup(func() { global.User, global.Post, global.Moderation = oldUser, oldPost, oldModeration })
+
+	cases := []struct {
+		name    string
+		hidden  bool
+		status  int
+		account string
+		postId  uint
+		want    error
+	}{
+		{"published", false, model.PostPublished, "other", 7, errCommentSaved},
+		{"missing", false, model.PostPublished, "other", 8, ErrPostNotFound},
+		{"pending by other", false, model.PostPendingReview, "other", 7, ErrPostNotFound},
+		{"pending by author", false, model.PostPendingReview, "author", 7, errCommentSaved},
+		{"hidden by other", true, model.PostPublished, "other", 7, ErrPostNotFound},
+		{"hidden by moderator", true, model.PostPublished, "mod", 7, errCommentSaved},
+	}
+	for _, c := range cases {
+		p := model.Post{UserID: author.ID, Hidden: c.hidden, Status: c.status}
+		p.ID = 7
+		global.Post = &fakeCommentPosts{post: p}
+		err, flag := CreateComment(c.account, c.postId, "评论")
+		if !errors.Is(err, c.want) || flag {
+			t.Errorf("%s: got %v, %v, want %v", c.name, err, flag, c.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
 	"encoding/json"
 	"fmt"
 )
@@ -17,24 +18,25 @@ type MessageDTO struct {
 	Type           int    `json:"type"`
 }
 
-func GetHistoryMessage(forUserId uint, toUserId uint, offset int, pageSize int) ([]MessageDTO, error) {
-	mc, err := global.MessageRedis.GetMessageCache(forUserId, toUserId, offset, pageSize)
+type messagePage struct {
+	Messages []MessageDTO `json:"messages"`
+	Next     string       `json:"next"`
+}
+
+func GetHistoryMessage(forUserId uint, toUserId uint, page model.PageQuery) ([]MessageDTO, string, error) {
+	key := pageKey(page)
+	mc, err := global.MessageRedis.GetMessageCache(forUserId, toUserId, key, page.Limit)
 	if err != nil {
-		return nil, err
-	}
-	if mc == "[]" {
-		return []MessageDTO{}, nil
+		return nil, "", err
 	}
 	if mc != "" {
-		var cachedPosts []MessageDTO
-		if err = json.Unmarshal([]byte(mc), &cachedPosts); err == nil {
-			return cachedPosts, nil
-		} else {
-			return nil, err
+		var cached messagePage
+		if err = json.Unmarshal([]byte(mc), &cached); err == nil {
+			return cached.Messages, cached.Next, nil
 		}
 	}
-	val, err, _ := requestGroup.Do(fmt.Sprintf("HistoryMessage:%d:%d:%d;%d", forUserId, toUserId, offset, pageSize), func() (interface{}, error) {
-		ms, err := global.Message.GetHistoryMessage(forUserId, toUserId, offset, pageSize)
+	val, err, _ := requestGroup.Do(fmt.Sprintf("HistoryMessage:%d:%d:%s;%d", forUserId, toUserId, key, page.Limit), func() (interface{}, error) {
+		ms, err := global.Message.GetHistoryMessage(forUserId, toUserId, page)
 		if err != nil {
 			return nil, err
 		}
@@ -75,23 +77,22 @@ func GetHistoryMessage(forUserId uint, toUserId uint, offset int, pageSize int)
 				Type:           m.Type,
 			}
 		}
-		if len(messages) == 0 {
-			err = global.MessageRedis.SetMessageCache(forUserId, toUserId, []MessageDTO{}, offset, pageSize)
-			if err != nil {
-				return nil, err
-			}
-			return []MessageDTO{}, nil
+		result := messagePage{Messages: messages}
+		if len(ms) > 0 {
+			last := ms[len(ms)-1]
+			result.Next = nextCursor(page, len(ms), last.CreatedAt, last.ID)
 		}
-		err = global.MessageRedis.SetMessageCache(forUserId, toUserId, messages, offset, pageSize)
+		err = global.MessageRedis.SetMessageCache(forUserId, toUserId, result, key, page.Limit)
 		if err != nil {
 			return nil, err
 		}
-		return messages, nil
+		return result, nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return val.([]MessageDTO), nil
+	result := val.(messagePage)
+	return result.Messages, result.Next, nil
 }
 
 type NoticeDTO struct {
@@ -104,14 +105,28 @@ type NoticeDTO struct {
 	IsRead    bool   `json:"is_read"`
 }
 
-func GetUnreadNotice(userId uint, offset int, limit int) ([]NoticeDTO, error) {
-	notices, err := global.Message.GetUnreadNotices(userId, offset, limit)
+// GetUnreadNotice 旧的页码模式读完一页就全部标记已读；游标模式只标记返回的这一页
+func GetUnreadNotice(userId uint, page model.PageQuery) ([]NoticeDTO, string, error) {
+	notices, err := global.Message.GetUnreadNotices(userId, page)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	ids := make([]uint, len(notices))
+	for i, n := range notices {
+		ids[i] = n.ID
+	}
+	if page.Cursor {
+		err = global.Message.ReadNotices(userId, ids)
+	} else {
+		err = global.Message.ReadAllNotices(userId)
 	}
-	err = global.Message.ReadAllNotices(userId)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	next := ""
+	if len(notices) > 0 {
+		last := notices[len(notices)-1]
+		next = nextCursor(page, len(notices), last.CreatedAt, last.ID)
 	}
 	noticeDTOs := make([]NoticeDTO, len(notices))
 	for i, n := range notices {
@@ -125,5 +140,5 @@ func GetUnreadNotice(userId uint, offset int, limit int) ([]NoticeDTO, error) {
 			IsRead:    n.IsRead,
 		}
 	}
-	return noticeDTOs, nil
+	return noticeDTOs, next, nil
 }
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/indexer"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+type SearchPostDTO struct {
+	PostsDTO
+	Highlight string  `json:"highlight"` // 高亮后的标题
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+}
+
+type RelatedPostDTO struct {
+	PostsDTO
+	Score float64 `json:"score"` // 和当前帖子的相似度
+}
+
+type SearchCommentDTO struct {
+	CommentID uint    `json:"comment_id"`
+	PostID    uint    `json:"post_id"`
+	Name      string  `json:"name"`
+	Avatar    string  `json:"avatar"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type SearchUserDTO struct {
+	feed.UserCardDTO
+	Highlight string  `json:"highlight"` // 高亮后的昵称
+	Snippet   string  `json:"snippet"`   // 高亮后的简介
+	Score     float64 `json:"score"`
+}
+
+// lastCursor 下一页游标按引擎返回的结果算，回表时被过滤掉的不影响翻页
+func lastCursor(query search.Query, result search.Result) string {
+	if len(result.Hits) == 0 {
+		return ""
+	}
+	last := result.Hits[len(result.Hits)-1]
+	return nextCursor(query.Page, len(result.Hits), last.CreatedAt, last.ID)
+}
+
+// searchPostHits mode=semantic时把关键词向量化后按相似度找，否则走全文索引
+func searchPostHits(query search.Query) (search.Result, error) {
+	if query.Mode != search.ModeSemantic {
+		return global.Search.Search(query)
+	}
+	vector, err := indexer.Embed(query.Keyword)
+	if err != nil {
+		return search.Result{}, err
+	}
+	return global.Vectors.Search(vector, query, viper.GetFloat64("embedding.minScore")), nil
+}
+
+// visiblePosts 按ID回表，被隐藏、删除或未发布的帖子不在结果里
+func visiblePosts(ids []uint) (map[uint]PostsDTO, error) {
+	ps, err := global.Post.HotPosts(ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[uint]PostsDTO, len(ps))
+	for _, p := range ps {
+		byId[p.ID] = newPostsDTO(p)
+	}
+	return byId, nil
+}
+
+// SearchPosts 返回结果、命中总数和下一页游标
+func SearchPosts(query search.Query) ([]SearchPostDTO, int64, string, error) {
+	query.Type = search.TypePost
+	result, err := searchPostHits(query)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	ids := make([]uint, len(result.Hits))
+	for i, h := range result.Hits {
+		ids[i] = h.ID
+	}
+	byId, err := visiblePosts(ids)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	posts := make([]SearchPostDTO, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		if p, ok := byId[h.ID]; ok {
+			posts = append(posts, SearchPostDTO{PostsDTO: p, Highlight: h.Title, Snippet: h.Snippet, Score: h.Score})
+		}
+	}
+	return posts, result.Total, lastCursor(query, result), nil
+}
+
+// GetRelatedPosts 按向量相似度找相关帖子，帖子不存在或不公开时第二个返回值为false
+func GetRelatedPosts(postId uint, limit int) ([]RelatedPostDTO, bool, error) {
+	vector, ok := global.Vectors.Vector(postId)
+	if !ok {
+		//刚发的帖子可能还在后台向量化，先临时算一次
+		p, err := global.Post.GetPostDetail(postId)
+		if err != nil {
+			return nil, false, err
+		}
+		if p.ID == 0 || p.Hidden || p.Status != model.PostPublished {
+			return nil, false, nil
+		}
+		vector, err = indexer.Embed(search.EmbedText(p.Title, p.Content))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	neighbors := global.Vectors.Nearest(vector, limit, postId, viper.GetFloat64("embedding.minScore"))
+	ids := make([]uint, len(neighbors))
+	for i, n := range neighbors {
+		ids[i] = n.ID
+	}
+	related := make([]RelatedPostDTO, 0, len(neighbors))
+	if len(ids) == 0 {
+		return related, true, nil
+	}
+	byId, err := visiblePosts(ids)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, n := range neighbors {
+		if p, ok := byId[n.ID]; ok {
+			related = append(related, RelatedPostDTO{PostsDTO: p, Score: n.Score})
+		}
+	}
+	return related, true, nil
+}
+
+func SearchComments(query search.Query) ([]SearchCommentDTO, int64, string, error) {
+	query.Type = search.TypeComment
+	result, err := global.Search.Search(query)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	ids := make([]uint, len(result.Hits))
+	for i, h := range result.Hits {
+		ids[i] = h.ID
+	}
+	cs, err := global.Post.GetCommentsByIds(ids)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	byId := make(map[uint]SearchCommentDTO, len(cs))
+	for _, c := range cs {
+		byId[c.ID] = SearchCommentDTO{
+			CommentID: c.ID,
+			PostID:    c.PostID,
+			Name:      c.User.UserProfile.Name,
+			Avatar:    c.User.UserProfile.Avatar,
+			CreatedAt: c.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	comments := make([]SearchCommentDTO, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		if c, ok := byId[h.ID]; ok {
+			c.Snippet = h.Snippet
+			c.Score = h.Score
+			comments = append(comments, c)
+		}
+	}
+	return comments, result.Total, lastCursor(query, result), nil
+}
+
+// SearchUsers viewerId用来判断是否已关注，未登录传0
+func SearchUsers(viewerId uint, query search.Query) ([]SearchUserDTO, int64, string, error) {
+	query.Type = search.TypeUser
+	result, err := global.Search.Search(query)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	ids := make([]uint, len(result.Hits))
+	for i, h := range result.Hits {
+		ids[i] = h.ID
+	}
+	us, err := global.User.GetUsersByIds(ids)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	cards, err := feed.UserCards(viewerId, us)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	byId := make(map[uint]feed.UserCardDTO, len(cards))
+	for _, c := range cards {
+		byId[c.UserId] = c
+	}
+	users := make([]SearchUserDTO, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		if c, ok := byId[h.ID]; ok {
+			users = append(users, SearchUserDTO{UserCardDTO: c, Highlight: h.Title, Snippet: h.Snippet, Score: h.Score})
+		}
+	}
+	return users, result.Total, lastCursor(query, result), nil
+}
+
+type CreatorDTO struct {
+	feed.UserCardDTO
+	Score float64 `json:"score"`
+}
+
+// GetPopularCreators 热门作者榜由定时任务刷新，这里只读榜单再补上用户信息
+func GetPopularCreators(viewerId uint, limit int) ([]CreatorDTO, error) {
+	entries, err := hot.TopCreators(limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.UserID
+	}
+	us, err := global.User.GetUsersByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := feed.UserCards(viewerId, us)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[uint]feed.UserCardDTO, len(cards))
+	for _, c := range cards {
+		byId[c.UserId] = c
+	}
+	creators := make([]CreatorDTO, 0, len(entries))
+	for _, e := range entries {
+		if c, ok := byId[e.UserID]; ok {
+			creators = append(creators, CreatorDTO{UserCardDTO: c, Score: e.Score})
+		}
+	}
+	return creators, nil
+}
+
+const (
+	maxQueryLength = 50
+	suggestLimit   = 5
+	hotSearchLimit = 10
+	hotSearchSize  = 1000
+)
+
+// NormalizeQuery 热搜和历史按规范化后的词统计：去掉多余空白、转小写、过长截断
+func NormalizeQuery(keyword string) string {
+	q := strings.ToLower(strings.Join(strings.Fields(keyword), " "))
+	if utf8.RuneCountInString(q) > maxQueryLength {
+		q = string([]rune(q)[:maxQueryLength])
+	}
+	return q
+}
+
+// RecordSearch 只统计第一页，翻页不重复计数；命中敏感词的只进自己的历史，不进热搜
+func RecordSearch(userId uint, query search.Query) {
+	if query.Page.Offset > 0 || query.Page.CursorID > 0 {
+		return
+	}
+	q := NormalizeQuery(query.Keyword)
+	if q == "" {
+		return
+	}
+	if !filter.Sensitive(q) {
+		_ = global.SearchRedis.RecordHotSearch(userId, q)
+	}
+	_ = global.SearchRedis.AddSearchHistory(userId, q)
+}
+
+type SuggestionDTO struct {
+	Type   string `json:"type"` // query热搜词、post帖子标题、user用户昵称
+	Text   string `json:"text"`
+	ID     uint   `json:"id,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// Suggest 前缀补全：先热搜词，再帖子标题和用户昵称
+func Suggest(prefix string) ([]SuggestionDTO, error) {
+	q := NormalizeQuery(prefix)
+	suggestions := make([]SuggestionDTO, 0, suggestLimit*3)
+	if q == "" {
+		return suggestions, nil
+	}
+	hotSearches, err := global.SearchRedis.GetHotSearch(hotSearchSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, z := range hotSearches {
+		text := z.Member.(string)
+		if strings.HasPrefix(text, q) && !filter.Sensitive(text) {
+			suggestions = append(suggestions, SuggestionDTO{Type: "query", Text: text})
+			if len(suggestions) == suggestLimit {
+				break
+			}
+		}
+	}
+	posts, err := global.Post.SuggestPosts(q, suggestLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		suggestions = append(suggestions, SuggestionDTO{Type: search.TypePost, Text: p.Title, ID: p.ID})
+	}
+	users, err := global.Post.SuggestUsers(q, suggestLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		suggestions = append(suggestions, SuggestionDTO{Type: search.TypeUser, Text: u.Name, ID: u.UserID, Avatar: u.Avatar})
+	}
+	return suggestions, nil
+}
+
+type HotSearchDTO struct {
+	Query string  `json:"query"`
+	Score float64 `json:"score"`
+}
+
+// GetHotSearches 敏感词可能是上榜之后才加进词库的，展示时再滤一遍，所以多取一些
+func GetHotSearches() ([]HotSearchDTO, error) {
+	zs, err := global.SearchRedis.GetHotSearch(hotSearchSize)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]HotSearchDTO, 0, hotSearchLimit)
+	for _, z := range zs {
+		text := z.Member.(string)
+		if filter.Sensitive(text) {
+			continue
+		}
+		result = append(result, HotSearchDTO{Query: text, Score: z.Score})
+		if len(result) == hotSearchLimit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// DecayHotSearches 定时把热搜分数按比例衰减，老的热词慢慢沉下去
+func DecayHotSearches(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+	_ = global.SearchRedis.DecayHotSearch(viper.GetFloat64("search.hotDecay"), 0.1, hotSearchSize)
+}
+
+func GetSearchHistory(userId uint) ([]string, error) {
+	return global.SearchRedis.GetSearchHistory(userId)
+}
+
+// ClearSearchHistory query为空时清空全部，否则只删这一条
+func ClearSearchHistory(userId uint, query string) error {
+	if query != "" {
+		query = NormalizeQuery(query)
+	}
+	return global.SearchRedis.DelSearchHistory(userId, query)
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"commmunity/app/internal/ai"
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/meter"
+	"commmunity/app/internal/service/rbac"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrPostNotFound = errors.New("未找到该文章")
+	ErrVipRequired  = errors.New("付费文章仅VIP可以总结")
+)
+
+// canSummarize 和看帖子的规则一致：被隐藏、没发布的只有作者和审核人员能看；付费帖子的全文只有VIP能看，作者自己除外
+func canSummarize(user model.User, p model.Post) error {
+	if p.ID == 0 {
+		return ErrPostNotFound
+	}
+	if (p.Hidden || p.Status != model.PostPublished) && user.ID != p.UserID && !rbac.HasPermission(user.Role, model.PermPostReview) {
+		return ErrPostNotFound
+	}
+	if p.Paid && !user.Vip && user.ID != p.UserID {
+		return ErrVipRequired
+	}
+	return nil
+}
+
+// summaryStream 一篇帖子正在生成的总结，同一篇帖子的后续请求都挂在这上面，不会重复调用AI
+type summaryStream struct {
+	lock    sync.Mutex
+	chunks  []string
+	done    bool
+	err     error
+	changed chan struct{} // 有新内容或结束时关闭，然后换一个新的
+}
+
+func newSummaryStream() *summaryStream {
+	return &summaryStream{changed: make(chan struct{})}
+}
+
+func (s *summaryStream) push(delta string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.chunks = append(s.chunks, delta)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *summaryStream) finish(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done = true
+	s.err = err
+	close(s.changed)
+}
+
+// since from之后的片段；还没结束时返回的changed会在下一次变化时关闭
+func (s *summaryStream) since(from int) ([]string, <-chan struct{}, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var chunks []string
+	if from < len(s.chunks) {
+		chunks = s.chunks[from:]
+	}
+	return chunks, s.changed, s.done, s.err
+}
+
+var summaryStreams = struct {
+	lock    sync.Mutex
+	streams map[uint]*summaryStream
+}{streams: make(map[uint]*summaryStream)}
+
+func runningSummary(postId uint) *summaryStream {
+	summaryStreams.lock.Lock()
+	defer summaryStreams.lock.Unlock()
+	return summaryStreams.streams[postId]
+}
+
+// startSummary 已经有人在生成就直接返回那一个，第二个返回值为false；用量记在发起人userId名下
+func startSummary(postId uint, content string, userId uint) (*summaryStream, bool) {
+	summaryStreams.lock.Lock()
+	if s, ok := summaryStreams.streams[postId]; ok {
+		summaryStreams.lock.Unlock()
+		return s, false
+	}
+	s := newSummaryStream()
+	summaryStreams.streams[postId] = s
+	summaryStreams.lock.Unlock()
+	//不跟某个请求的ctx绑定，第一个人断开了其他人还能收到；总时长由ai.timeout限制
+	go func() {
+		resp, err := ai.AutoSummary(context.Background(), global.LLM, content, s.push)
+		meter.Record(userId, model.FeatureSummary, global.LLM.Name(), resp, err)
+		if err != nil {
+			meter.Refund(userId)
+		} else {
+			err = global.PostRedis.SetSummaryCache(postId, resp.Content)
+		}
+		//先写缓存再摘掉，之后来的请求能直接命中缓存
+		summaryStreams.lock.Lock()
+		delete(summaryStreams.streams, postId)
+		summaryStreams.lock.Unlock()
+		s.finish(err)
+	}()
+	return s, true
+}
+
+// SummaryWatcher 逐段读取总结，多个请求可以各自读同一个生成过程
+type SummaryWatcher struct {
+	stream *summaryStream
+	next   int
+}
+
+// Next 阻塞到有新片段、生成结束或ctx取消；done为true时err是生成的结果
+func (w *SummaryWatcher) Next(ctx context.Context) ([]string, bool, error) {
+	for {
+		chunks, changed, done, err := w.stream.since(w.next)
+		w.next += len(chunks)
+		if len(chunks) > 0 || done {
+			return chunks, done, err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+}
+
+// WatchSummary 有缓存时直接返回一段完整的总结，不占额度；只有真正发起调用的人扣一次，接到别人正在生成的总结上不扣。
+// 先检查能不能看这篇帖子，再决定给缓存、接到正在生成的总结上还是重新生成
+func WatchSummary(account string, postId uint) (*SummaryWatcher, meter.Quota, error) {
+	user, err := global.User.GetUserId(account)
+	if err != nil {
+		return nil, meter.Quota{}, err
+	}
+	p, err := global.Post.GetPostDetail(postId)
+	if err != nil {
+		return nil, meter.Quota{}, err
+	}
+	if err = canSummarize(user, p); err != nil {
+		return nil, meter.Quota{}, err
+	}
+	summary, err := global.PostRedis.GetSummaryCache(postId)
+	if err != nil {
+		return nil, meter.Quota{}, err
+	}
+	if summary != "" {
+		quota, err := meter.Remaining(user)
+		if err != nil {
+			return nil, meter.Quota{}, err
+		}
+		s := newSummaryStream()
+		s.push(summary)
+		s.finish(nil)
+		return &SummaryWatcher{stream: s}, quota, nil
+	}
+	if s := runningSummary(postId); s != nil {
+		quota, err := meter.Remaining(user)
+		if err != nil {
+			return nil, meter.Quota{}, err
+		}
+		if quota.Exhausted() {
+			return nil, quota, meter.ErrQuotaExceeded
+		}
+		return &SummaryWatcher{stream: s}, quota, nil
+	}
+	quota, err := meter.Reserve(user)
+	if err != nil {
+		return nil, quota, err
+	}
+	s, started := startSummary(postId, p.Content, user.ID)
+	if !started {
+		meter.Refund(user.ID)
+		quota, err = meter.Remaining(user)
+		if err != nil {
+			return nil, meter.Quota{}, err
+		}
+	}
+	return &SummaryWatcher{stream: s}, quota, nil
+}
+
+// AiSummary 等总结全部生成完再返回
+func AiSummary(ctx context.Context, account string, postId uint) (string, meter.Quota, error) {
+	w, quota, err := WatchSummary(account, postId)
+	if err != nil {
+		return "", quota, err
+	}
+	var summary strings.Builder
+	for {
+		chunks, done, err := w.Next(ctx)
+		for _, c := range chunks {
+			summary.WriteString(c)
+		}
+		if done {
+			return summary.String(), quota, err
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"commmunity/app/internal/ai"
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/db/red"
+	"commmunity/app/internal/model"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	old := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, old) })
+}
+
+// readAll 读到结束，返回拼起来的内容
+func readAll(ctx context.Context, w *SummaryWatcher) (string, error) {
+	var b strings.Builder
+	for {
+		chunks, done, err := w.Next(ctx)
+		for _, c := range chunks {
+			b.WriteString(c)
+		}
+		if done {
+			return b.String(), err
+		}
+	}
+}
+
+func TestSummaryStreamFanout(t *testing.T) {
+	s := newSummaryStream()
+	results := make([]string, 3)
+	errs := make([]error, 3)
+	var wg sync.WaitGroup
+	watch := func(i int) {
+		defer wg.Done()
+		results[i], errs[i] = readAll(context.Background(), &SummaryWatcher{stream: s})
+	}
+	wg.Add(2)
+	go watch(0)
+	go watch(1)
+	s.push("第一段")
+	time.Sleep(10 * time.Millisecond)
+	s.push("，第二段")
+	//中途才接上的也要从头收到
+	wg.Add(1)
+	go watch(2)
+	time.Sleep(10 * time.Millisecond)
+	s.push("，完")
+	s.finish(nil)
+	wg.Wait()
+	for i := range results {
+		if errs[i] != nil || results[i] != "第一段，第二段，完" {
+			t.Errorf("watcher %d got %q, %v", i, results[i], errs[i])
+		}
+	}
+
+	//结束后再来的直接拿到全部内容
+	if got, err := readAll(context.Background(), &SummaryWatcher{stream: s}); err != nil || got != "第一段，第二段，完" {
+		t.Errorf("late watcher got %q, %v", got, err)
+	}
+}
+
+func TestSummaryStreamError(t *testing.T) {
+	s := newSummaryStream()
+	s.push("半")
+	boom := errors.New("boom")
+	s.finish(boom)
+	got, err := readAll(context.Background(), &SummaryWatcher{stream: s})
+	if got != "半" || !errors.Is(err, boom) {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = readAll(ctx, &SummaryWatcher{stream: newSummaryStream()}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("一直没有内容时应该随ctx结束，got %v", err)
+	}
+}
+
+type fakeSummaryUsers struct {
+	msq.UserData
+	users map[string]model.User
+}
+
+func (f *fakeSummaryUsers) GetUserId(account string) (model.User, error) {
+	return f.users[account], nil
+}
+
+// GetRoles 读不到权限矩阵时rbac按默认权限判断
+func (f *fakeSummaryUsers) GetRoles() ([]model.Role, error) {
+	return nil, errors.New("no roles in tests")
+}
+
+type fakeSummaryPosts struct {
+	msq.PostData
+	post model.Post
+}
+
+func (f *fakeSummaryPosts) GetPostDetail(postId uint) (model.Post, error) {
+	if f.post.ID != postId {
+		return model.Post{}, nil
+	}
+	return f.post, nil
+}
+
+type fakeSummaryCache struct {
+	red.PostRedis
+	lock    sync.Mutex
+	summary map[uint]string
+}
+
+func (f *fakeSummaryCache) GetSummaryCache(postId uint) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.summary[postId], nil
+}
+
+func (f *fakeSummaryCache) SetSummaryCache(postId uint, summary string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.summary[postId] = summary
+	return nil
+}
+
+type fakeQuota struct {
+	red.QuotaRedis
+	lock sync.Mutex
+	used map[uint]int64
+}
+
+func (f *fakeQuota) ReserveQuota(userId uint, now time.Time, dailyLimit int, monthlyLimit int) (int64, int64, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if dailyLimit >= 0 && f.used[userId] >= int64(dailyLimit) {
+		return f.used[userId], f.used[userId], false, nil
+	}
+	f.used[userId]++
+	return f.used[userId], f.used[userId], true, nil
+}
+
+func (f *fakeQuota) RefundQuota(userId uint, now time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.used[userId]--
+	return nil
+}
+
+func (f *fakeQuota) GetQuotaUsed(userId uint, now time.Time) (int64, int64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.used[userId], f.used[userId], nil
+}
+
+type fakeUsage struct {
+	msq.UsageData
+}
+
+func (f *fakeUsage) SaveUsage(usage *model.AIUsage) error {
+	return nil
+}
+
+// gateProvider 收到release之前不输出，保证后来的请求能接到同一个生成过程上
+type gateProvider struct {
+	ai.FakeProvider
+	release chan struct{}
+}
+
+func (p *gateProvider) Stream(ctx context.Context, req ai.Request, onDelta func(delta string)) (ai.Response, error) {
+	<-p.release
+	return p.FakeProvider.Stream(ctx, req, onDelta)
+}
+
+type summaryFakes struct {
+	posts *fakeSummaryPosts
+	cache *fakeSummaryCache
+	quota *fakeQuota
+	llm   *gateProvider
+}
+
+func useSummaryFakes(t *testing.T, post model.Post, users ...model.User) *summaryFakes {
+	t.Helper()
+	setConfig(t, "ai.quota.trial.daily", 3)
+	setConfig(t, "ai.quota.trial.monthly", 3)
+	setConfig(t, "ai.quota.vip.daily", -1)
+	setConfig(t, "ai.quota.vip.monthly", -1)
+	setConfig(t, "ai.timeout", 5)
+	byAccount := make(map[string]model.User)
+	for _, u := range users {
+		byAccount[u.Account] = u
+	}
+	f := &summaryFakes{
+		posts: &fakeSummaryPosts{post: post},
+		cache: &fakeSummaryCache{summary: make(map[uint]string)},
+		quota: &fakeQuota{used: make(map[uint]int64)},
+		llm:   &gateProvider{FakeProvider: ai.FakeProvider{Reply: "这是总结"}, release: make(chan struct{})},
+	}
+	oldUser, oldPost, oldCache, oldQuota, oldUsage, oldLLM := global.User, global.Post, global.PostRedis, global.Quota, global.Usage, global.LLM
+	global.User = &fakeSummaryUsers{users: byAccount}
+	global.Post, global.PostRedis, global.Quota, global.Usage, global.LLM = f.posts, f.cache, f.quota, &fakeUsage{}, f.llm
+	t.Cleanup(func() {
+		global.User, global.Post, global.PostRedis, global.Quota, global.Usage, global.LLM = oldUser, oldPost, oldCache, oldQuota, oldUsage, oldLLM
+	})
+	return f
+}
+
+func publishedPost(id uint, authorId uint) model.Post {
+	p := model.Post{UserID: authorId, Title: "标题", Content: "正文", Status: model.PostPublished}
+	p.ID = id
+	return p
+}
+
+func testUser(id uint, account string) model.User {
+	u := model.User{Account: account}
+	u.ID = id
+	return u
+}
+
+// 同一篇帖子同时请求只调用一次AI，额度只扣发起人的
+func TestWatchSummaryFanout(t *testing.T) {
+	f := useSummaryFakes(t, publishedPost(1, 9), testUser(2, "a"), testUser(3, "b"))
+	w1, _, err := WatchSummary("a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, _, err := WatchSummary("b", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(f.llm.release)
+	for _, w := range []*SummaryWatcher{w1, w2} {
+		if got, err := readAll(context.Background(), w); err != nil || got != "这是总结" {
+			t.Errorf("got %q, %v", got, err)
+		}
+	}
+	if n := len(f.llm.Calls()); n != 1 {
+		t.Errorf("LLM called %d times, want 1", n)
+	}
+	if f.quota.used[2] != 1 || f.quota.used[3] != 0 {
+		t.Errorf("quota used = %v, want only the first caller charged", f.quota.used)
+	}
+	if f.cache.summary[1] != "这是总结" {
+		t.Errorf("summary cache = %q", f.cache.summary[1])
+	}
+}
+
+func TestWatchSummaryRejectsInvisiblePosts(t *testing.T) {
+	hidden := publishedPost(1, 9)
+	hidden.Hidden = true
+	pending := publishedPost(1, 9)
+	pending.Status = model.PostPendingReview
+	for name, post := range map[string]model.Post{"不存在": {}, "被隐藏": hidden, "未发布": pending} {
+		t.Run(name, func(t *testing.T) {
+			f := useSummaryFakes(t, post, testUser(2, "a"))
+			f.cache.summary[1] = "旧的总结"
+			if _, _, err := WatchSummary("a", 1); !errors.Is(err, ErrPostNotFound) {
+				t.Errorf("err = %v, want ErrPostNotFound", err)
+			}
+			if len(f.llm.Calls()) != 0 || f.quota.used[2] != 0 {
+				t.Error("不可见的帖子不应该调用AI或扣额度")
+			}
+		})
+	}
+}
+
+func TestCanSummarize(t *testing.T) {
+	useSummaryFakes(t, model.Post{})
+	author := testUser(9, "author")
+	stranger := testUser(2, "a")
+	vip := testUser(3, "vip")
+	vip.Vip = true
+	moderator := testUser(4, "mod")
+	moderator.Role = model.RoleModerator
+	hidden := publishedPost(1, 9)
+	hidden.Hidden = true
+	pending := publishedPost(1, 9)
+	pending.Status = model.PostPendingReview
+	paid := publishedPost(1, 9)
+	paid.Paid = true
+	hiddenPaid := paid
+	hiddenPaid.Hidden = true
+	tests := []struct {
+		name string
+		user model.User
+		post model.Post
+		want error
+	}{
+		{name: "公开帖子谁都能总结", user: stranger, post: publishedPost(1, 9)},
+		{name: "帖子不存在", user: stranger, post: model.Post{}, want: ErrPostNotFound},
+		{name: "被隐藏的帖子别人看不到", user: stranger, post: hidden, want: ErrPostNotFound},
+		{name: "被隐藏的帖子作者能看", user: author, post: hidden},
+		{name: "被隐藏的帖子审核人员能看", user: moderator, post: hidden},
+		{name: "待审核的帖子别人看不到", user: vip, post: pending, want: ErrPostNotFound},
+		{name: "待审核的帖子作者能看", user: author, post: pending},
+		{name: "待审核的帖子审核人员能看", user: moderator, post: pending},
+		{name: "付费帖子普通用户不能总结", user: stranger, post: paid, want: ErrVipRequired},
+		{name: "付费帖子VIP能总结", user: vip, post: paid},
+		{name: "付费帖子作者能总结", user: author, post: paid},
+		{name: "审核人员看隐藏的付费帖子也要VIP", user: moderator, post: hiddenPaid, want: ErrVipRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := canSummarize(tt.user, tt.post); !errors.Is(err, tt.want) {
+				t.Errorf("canSummarize = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// 权限检查在缓存和正在生成的总结之前，这两条路都不能绕过
+func TestWatchSummaryChecksBeforeSharing(t *testing.T) {
+	paid := publishedPost(1, 9)
+	paid.Paid = true
+	vip := testUser(3, "vip")
+	vip.Vip = true
+	f := useSummaryFakes(t, paid, testUser(2, "a"), vip)
+
+	w, _, err := WatchSummary("vip", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = WatchSummary("a", 1); !errors.Is(err, ErrVipRequired) {
+		t.Errorf("attach to running stream: err = %v, want ErrVipRequired", err)
+	}
+	close(f.llm.release)
+	if got, err := readAll(context.Background(), w); err != nil || got != "这是总结" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, _, err = WatchSummary("a", 1); !errors.Is(err, ErrVipRequired) {
+		t.Errorf("cached summary: err = %v, want ErrVipRequired", err)
+	}
+	if f.quota.used[2] != 0 {
+		t.Error("被拒绝的请求不应该扣额度")
+	}
+	if n := len(f.llm.Calls()); n != 1 {
+		t.Errorf("LLM called %d times, want 1", n)
+	}
+}
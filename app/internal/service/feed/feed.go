@@ -2,6 +2,7 @@ package feed
 
 import (
 	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
 	"encoding/json"
 )
 
@@ -23,12 +24,14 @@ func Follow(account string, followerId uint, followedId uint) (error, bool) {
 		if err != nil {
 			return err, false
 		}
+		backfill(followerId, followedId, false)
 		return nil, false
 	} else {
 		err = global.User.Follow(followedId, followerId)
 		if err != nil {
 			return err, false
 		}
+		backfill(followerId, followedId, true)
 		return nil, true
 	}
 }
@@ -126,6 +129,49 @@ func GetFollowings(account string, userId uint) ([]FollowsDTO, error) {
 	return followingsDTO, nil
 }
 
+// UserCardDTO 搜索用户、热门作者里展示的用户卡片
+type UserCardDTO struct {
+	FollowsDTO
+	FollowerCount int64 `json:"follower_count"`
+	IsFollowing   bool  `json:"is_following"` // 当前登录用户是否已关注
+}
+
+// UserCards 按users的顺序补上粉丝数和关注状态，viewerId为0时都是未关注
+func UserCards(viewerId uint, users []model.User) ([]UserCardDTO, error) {
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	counts, err := global.User.CountFollowersByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	following := make(map[uint]bool)
+	if viewerId != 0 {
+		followed, err := global.User.FollowingAmong(viewerId, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range followed {
+			following[id] = true
+		}
+	}
+	cards := make([]UserCardDTO, len(users))
+	for i, u := range users {
+		cards[i] = UserCardDTO{
+			FollowsDTO: FollowsDTO{
+				UserId:       u.ID,
+				Avatar:       u.UserProfile.Avatar,
+				Name:         u.UserProfile.Name,
+				Introduction: u.UserProfile.Introduction,
+			},
+			FollowerCount: counts[u.ID],
+			IsFollowing:   following[u.ID],
+		}
+	}
+	return cards, nil
+}
+
 type PostsDTO struct {
 	Name         string `json:"name"`
 	Avatar       string `json:"avatar"`
@@ -136,27 +182,41 @@ type PostsDTO struct {
 	CommentCount uint   `json:"comment_count"`
 }
 
-func GetFollowingPosts(account string, userId uint, offset int, pageSize int) ([]PostsDTO, error) {
-	fpc, err := global.PostRedis.GetFollowingPostsCache(account, offset, pageSize)
+// GetFollowingPosts 游标是上一页最后一条帖子的ID，兼容旧的页码时从头跳过offset条
+func GetFollowingPosts(userId uint, beforeId uint, offset int, pageSize int) ([]PostsDTO, uint, error) {
+	followings, err := global.User.GetFollowingIds(userId)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	if fpc == "[]" {
-		return []PostsDTO{}, nil
+	if len(followings) == 0 {
+		return []PostsDTO{}, 0, nil
 	}
-	if fpc != "" {
-		var cached []PostsDTO
-		if err = json.Unmarshal([]byte(fpc), &cached); err == nil {
-			return cached, nil
-		}
+	ids, err := timelineIds(userId, followings, beforeId, offset+pageSize)
+	if err != nil {
+		return nil, 0, err
 	}
-	ps, err := global.Post.GetFollowingPosts(userId, offset, pageSize)
+	if offset >= len(ids) {
+		return []PostsDTO{}, 0, nil
+	}
+	ids = ids[offset:]
+	next := uint(0)
+	if len(ids) == pageSize {
+		next = ids[len(ids)-1]
+	}
+	ps, err := global.Post.HotPosts(ids)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	followed := make(map[uint]bool, len(followings))
+	for _, id := range followings {
+		followed[id] = true
 	}
-	posts := make([]PostsDTO, len(ps))
-	for i, p := range ps {
-		posts[i] = PostsDTO{
+	byId := make(map[uint]PostsDTO, len(ps))
+	for _, p := range ps {
+		if !followed[p.UserID] { // 取关后没清干净的旧帖子
+			continue
+		}
+		byId[p.ID] = PostsDTO{
 			Name:         p.User.UserProfile.Name,
 			Avatar:       p.User.UserProfile.Avatar,
 			PostID:       p.ID,
@@ -166,16 +226,11 @@ func GetFollowingPosts(account string, userId uint, offset int, pageSize int) ([
 			CommentCount: p.CommentCount,
 		}
 	}
-	if len(posts) == 0 {
-		err = global.PostRedis.SetFollowingPostsCache(account, offset, pageSize, []PostsDTO{})
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		err = global.PostRedis.SetFollowingPostsCache(account, offset, pageSize, posts)
-		if err != nil {
-			return nil, err
+	posts := make([]PostsDTO, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := byId[id]; ok {
+			posts = append(posts, p)
 		}
 	}
-	return posts, nil
+	return posts, next, nil
 }
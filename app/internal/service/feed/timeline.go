@@ -0,0 +1,194 @@
+package feed
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/zlog"
+	"sort"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	timelineSize = 800 // 每个人的时间线只保留最近800条
+	outboxSize   = 200
+	fanoutBatch  = 500
+	backfillSize = 50
+)
+
+type fanoutJob struct {
+	AuthorID uint
+	PostIDs  []uint
+}
+
+var fanoutJobs = make(chan fanoutJob, 1024)
+
+// StartFanout 后台分发协程，和ws.GlobalManager一样在启动时拉起
+func StartFanout() {
+	for job := range fanoutJobs {
+		fanout(job)
+	}
+}
+
+func fanout(job fanoutJob) {
+	lastId := uint(0)
+	for {
+		ids, err := global.User.GetFollowerIds(job.AuthorID, lastId, fanoutBatch)
+		if err != nil {
+			zlog.Error("分发时间线中断", zap.Uints("postIds", job.PostIDs), zap.Error(err))
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+		_ = global.Feed.FanoutTimeline(ids, job.PostIDs, timelineSize)
+		if len(ids) < fanoutBatch {
+			return
+		}
+		lastId = ids[len(ids)-1]
+	}
+}
+
+// isBigV 粉丝数超过阈值的作者不推送，由粉丝读取时拉取；第二个返回值表示名单有没有变化
+func isBigV(userId uint) (bool, bool, error) {
+	count, err := global.User.CountFollowers(userId)
+	if err != nil {
+		return false, false, err
+	}
+	bigV := count >= viper.GetInt64("feed.bigVFollowers")
+	changed, err := global.Feed.SetBigV(userId, bigV)
+	return bigV, changed, err
+}
+
+// outbox 作者最近的帖子，redis里没有就从数据库补
+func outbox(authorId uint, beforeId uint, limit int) ([]uint, error) {
+	exists, err := global.Feed.OutboxExists(authorId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		ids, err := global.Post.GetPostIdsByUsers([]uint{authorId}, outboxSize)
+		if err != nil {
+			return nil, err
+		}
+		if err = global.Feed.AddOutbox(authorId, ids, outboxSize); err != nil {
+			return nil, err
+		}
+	}
+	return global.Feed.GetOutbox(authorId, beforeId, limit)
+}
+
+// Publish 帖子对外可见后调用：写作者发件箱，普通作者再推给粉丝
+func Publish(authorId uint, postId uint) {
+	if _, err := outbox(authorId, 0, 1); err != nil {
+		return
+	}
+	if err := global.Feed.AddOutbox(authorId, []uint{postId}, outboxSize); err != nil {
+		return
+	}
+	bigV, changed, err := isBigV(authorId)
+	if err != nil || bigV {
+		return
+	}
+	postIds := []uint{postId}
+	if changed {
+		// 刚从大V降回普通作者，当大V期间的帖子粉丝时间线里都没有，连同发件箱一起补推
+		if postIds, err = outbox(authorId, 0, outboxSize); err != nil {
+			return
+		}
+	}
+	job := fanoutJob{AuthorID: authorId, PostIDs: postIds}
+	select {
+	case fanoutJobs <- job:
+	default:
+		zlog.Warn("时间线分发队列已满，直接分发", zap.Uint("postId", postId))
+		go fanout(job)
+	}
+}
+
+// Unpublish 删除的帖子只从发件箱移除，粉丝时间线里的ID在读取时被过滤
+func Unpublish(authorId uint, postId uint) {
+	_ = global.Feed.RemoveOutbox(authorId, postId)
+}
+
+// backfill 关注后把对方最近的帖子补进自己的时间线，取关时清掉
+func backfill(followerId uint, followedId uint, follow bool) {
+	exists, err := global.Feed.TimelineExists(followerId)
+	if err != nil || !exists {
+		return
+	}
+	limit := backfillSize
+	if !follow {
+		limit = outboxSize
+	}
+	ids, err := outbox(followedId, 0, limit)
+	if err != nil {
+		return
+	}
+	if follow {
+		_ = global.Feed.AddTimeline(followerId, ids, timelineSize)
+	} else {
+		_ = global.Feed.RemoveTimeline(followerId, ids)
+	}
+}
+
+// rebuildTimeline 时间线过期或第一次使用时，按关注的普通作者从数据库重建
+func rebuildTimeline(userId uint, authors []uint) error {
+	ids, err := global.Post.GetPostIdsByUsers(authors, timelineSize)
+	if err != nil {
+		return err
+	}
+	return global.Feed.AddTimeline(userId, ids, timelineSize)
+}
+
+// timelineIds 推拉结合：自己的时间线加上关注的大V发件箱，合并后按ID倒序
+func timelineIds(userId uint, followings []uint, beforeId uint, limit int) ([]uint, error) {
+	bigVs, err := global.Feed.GetBigVs()
+	if err != nil {
+		return nil, err
+	}
+	bigVSet := make(map[uint]bool, len(bigVs))
+	for _, id := range bigVs {
+		bigVSet[id] = true
+	}
+	var pull, push []uint
+	for _, id := range followings {
+		if bigVSet[id] {
+			pull = append(pull, id)
+		} else {
+			push = append(push, id)
+		}
+	}
+	exists, err := global.Feed.TimelineExists(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = rebuildTimeline(userId, push); err != nil {
+			return nil, err
+		}
+	}
+	ids, err := global.Feed.GetTimeline(userId, beforeId, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, author := range pull {
+		pulled, err := outbox(author, beforeId, limit)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, pulled...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	merged := make([]uint, 0, limit)
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		merged = append(merged, id)
+		if len(merged) == limit {
+			break
+		}
+	}
+	return merged, nil
+}
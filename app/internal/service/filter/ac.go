@@ -0,0 +1,89 @@
+package filter
+
+import "unicode"
+
+type node struct {
+	children map[rune]*node
+	fail     *node
+	outputs  []int // 以该节点结尾的词下标，包含fail链上的
+}
+
+// Automaton Aho-Corasick自动机，构建后只读，可并发匹配
+type Automaton struct {
+	root    *node
+	lengths []int
+}
+
+type Match struct {
+	Start int // rune下标
+	End   int
+	Index int // 命中词在构建时的下标
+}
+
+func newNode() *node {
+	return &node{children: make(map[rune]*node)}
+}
+
+// Build 构建自动机，匹配不区分大小写
+func Build(words []string) *Automaton {
+	a := &Automaton{root: newNode(), lengths: make([]int, len(words))}
+	for i, w := range words {
+		cur := a.root
+		runes := []rune(w)
+		for _, r := range runes {
+			r = unicode.ToLower(r)
+			next, ok := cur.children[r]
+			if !ok {
+				next = newNode()
+				cur.children[r] = next
+			}
+			cur = next
+		}
+		if len(runes) > 0 {
+			cur.outputs = append(cur.outputs, i)
+		}
+		a.lengths[i] = len(runes)
+	}
+	//广度优先补fail指针
+	queue := make([]*node, 0, len(a.root.children))
+	for _, child := range a.root.children {
+		child.fail = a.root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range cur.children {
+			f := cur.fail
+			for f != nil && f.children[r] == nil {
+				f = f.fail
+			}
+			if f == nil {
+				child.fail = a.root
+			} else {
+				child.fail = f.children[r]
+			}
+			child.outputs = append(child.outputs, child.fail.outputs...)
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+func (a *Automaton) Match(text []rune) []Match {
+	var matches []Match
+	cur := a.root
+	for i, r := range text {
+		r = unicode.ToLower(r)
+		for cur != a.root && cur.children[r] == nil {
+			cur = cur.fail
+		}
+		if next, ok := cur.children[r]; ok {
+			cur = next
+		}
+		for _, idx := range cur.outputs {
+			matches = append(matches, Match{Start: i + 1 - a.lengths[idx], End: i + 1, Index: idx})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,194 @@
+package filter
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/model"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		text  string
+		want  []Match
+	}{
+		{
+			name:  "经典he/she/hers，重叠和fail链上的输出都要报出来",
+			words: []string{"he", "she", "his", "hers"},
+			text:  "ushers",
+			want:  []Match{{Start: 1, End: 4, Index: 1}, {Start: 2, End: 4, Index: 0}, {Start: 2, End: 6, Index: 3}},
+		},
+		{
+			name:  "失配后沿fail链回退继续匹配",
+			words: []string{"he", "she", "his", "hers"},
+			text:  "shis",
+			want:  []Match{{Start: 1, End: 4, Index: 2}},
+		},
+		{
+			name:  "中文前缀和后缀重叠",
+			words: []string{"中国", "中国人", "国人"},
+			text:  "我是中国人",
+			want:  []Match{{Start: 2, End: 4, Index: 0}, {Start: 2, End: 5, Index: 1}, {Start: 3, End: 5, Index: 2}},
+		},
+		{
+			name:  "同一个词连续出现",
+			words: []string{"aa"},
+			text:  "aaaa",
+			want:  []Match{{Start: 0, End: 2, Index: 0}, {Start: 1, End: 3, Index: 0}, {Start: 2, End: 4, Index: 0}},
+		},
+		{
+			name:  "不区分大小写",
+			words: []string{"Spam"},
+			text:  "no SPAM here",
+			want:  []Match{{Start: 3, End: 7, Index: 0}},
+		},
+		{
+			name:  "空词不会命中",
+			words: []string{"", "x"},
+			text:  "xyz",
+			want:  []Match{{Start: 0, End: 1, Index: 1}},
+		},
+		{
+			name:  "没有命中",
+			words: []string{"he", "she"},
+			text:  "abc",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Build(tt.words).Match([]rune(tt.text))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeModeration struct {
+	msq.ModerationData
+	words   []model.SensitiveWord
+	reports []model.Report
+}
+
+func (f *fakeModeration) GetAllWords() ([]model.SensitiveWord, error) {
+	return f.words, nil
+}
+
+func (f *fakeModeration) CreateReport(report *model.Report) (bool, error) {
+	f.reports = append(f.reports, *report)
+	return true, nil
+}
+
+// useWords 换上假的词库，并清掉上一个测试构建好的自动机
+func useWords(t *testing.T, ws ...model.SensitiveWord) *fakeModeration {
+	t.Helper()
+	fake := &fakeModeration{words: ws}
+	old := global.Moderation
+	global.Moderation = fake
+	lock.Lock()
+	automaton = nil
+	lock.Unlock()
+	t.Cleanup(func() {
+		global.Moderation = old
+		lock.Lock()
+		automaton = nil
+		lock.Unlock()
+	})
+	return fake
+}
+
+func TestFilter(t *testing.T) {
+	useWords(t,
+		model.SensitiveWord{Word: "违禁", Action: model.WordBlock},
+		model.SensitiveWord{Word: "傻瓜", Action: model.WordMask},
+		model.SensitiveWord{Word: "代购", Action: model.WordReview},
+	)
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		review []string
+		err    error
+	}{
+		{name: "干净文本原样返回", text: "今天天气不错", want: "今天天气不错"},
+		{name: "打码词替换成星号", text: "你这个傻瓜", want: "你这个**"},
+		{name: "多处打码", text: "傻瓜和傻瓜", want: "**和**"},
+		{name: "审核词放行并返回命中词", text: "找我代购", want: "找我代购", review: []string{"代购"}},
+		{name: "打码和审核同时命中", text: "傻瓜代购", want: "**代购", review: []string{"代购"}},
+		{name: "拦截词直接拒绝", text: "这是违禁内容", want: "", err: ErrBlocked},
+		{name: "空文本", text: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, review, err := Filter(tt.text)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Filter(%q) err = %v, want %v", tt.text, err, tt.err)
+			}
+			if got != tt.want || !reflect.DeepEqual(review, tt.review) {
+				t.Errorf("Filter(%q) = %q, %v, want %q, %v", tt.text, got, review, tt.want, tt.review)
+			}
+		})
+	}
+}
+
+func TestFlag(t *testing.T) {
+	fake := useWords(t)
+	Flag(model.ReportPost, 7, 3, nil)
+	Flag(model.ReportPost, 0, 3, []string{"代购"})
+	if len(fake.reports) != 0 {
+		t.Fatalf("没有命中词或没有目标时不应送审，got %v", fake.reports)
+	}
+	Flag(model.ReportComment, 7, 3, []string{"代购", "加微信"})
+	if len(fake.reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(fake.reports))
+	}
+	r := fake.reports[0]
+	if r.ReporterID != 0 || r.TargetType != model.ReportComment || r.TargetID != 7 || r.AuthorID != 3 || r.Reason != model.ReasonOther {
+		t.Errorf("report = %+v", r)
+	}
+	if r.Detail != "命中敏感词：代购,加微信" {
+		t.Errorf("detail = %q", r.Detail)
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	useWords(t,
+		model.SensitiveWord{Word: "违禁", Action: model.WordBlock},
+		model.SensitiveWord{Word: "傻瓜", Action: model.WordMask},
+		model.SensitiveWord{Word: "代购", Action: model.WordReview},
+	)
+	for text, want := range map[string]bool{"违禁品": true, "傻瓜相机": true, "海外代购": true, "golang": false, "": false} {
+		if got := Sensitive(text); got != want {
+			t.Errorf("Sensitive(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abcdefghijklmnopqrstuvwxyz中文敏感词过滤测试")
+	word := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			sb.WriteRune(letters[rng.Intn(len(letters))])
+		}
+		return sb.String()
+	}
+	words := make([]string, 10000)
+	for i := range words {
+		words[i] = word(2 + rng.Intn(6))
+	}
+	a := Build(words)
+	text := []rune(word(10000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Match(text)
+	}
+}
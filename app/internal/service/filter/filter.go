@@ -0,0 +1,180 @@
+package filter
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/zlog"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const reloadInterval = time.Minute
+
+var ErrBlocked = errors.New("内容包含违禁词")
+
+var (
+	lock      sync.RWMutex
+	automaton *Automaton
+	words     []model.SensitiveWord
+	loadedAt  time.Time
+)
+
+// 词库放在内存里，每分钟从数据库重新构建一次，管理员修改后立即重建
+func load() error {
+	ws, err := global.Moderation.GetAllWords()
+	if err != nil {
+		return err
+	}
+	patterns := make([]string, len(ws))
+	for i, w := range ws {
+		patterns[i] = w.Word
+	}
+	a := Build(patterns)
+	lock.Lock()
+	automaton = a
+	words = ws
+	loadedAt = time.Now()
+	lock.Unlock()
+	zlog.Info("敏感词库加载完成", zap.Int("count", len(ws)))
+	return nil
+}
+
+func current() (*Automaton, []model.SensitiveWord) {
+	lock.RLock()
+	stale := automaton == nil || time.Since(loadedAt) > reloadInterval
+	lock.RUnlock()
+	if stale {
+		if err := load(); err != nil {
+			zlog.Error("加载敏感词库失败", zap.Error(err))
+		}
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	return automaton, words
+}
+
+// Filter 返回打码后的文本和需要审核的命中词，命中拦截词时返回ErrBlocked
+func Filter(text string) (string, []string, error) {
+	a, ws := current()
+	if a == nil || text == "" {
+		return text, nil, nil
+	}
+	runes := []rune(text)
+	matches := a.Match(runes)
+	if len(matches) == 0 {
+		return text, nil, nil
+	}
+	var review []string
+	masked := false
+	for _, m := range matches {
+		switch ws[m.Index].Action {
+		case model.WordBlock:
+			return "", nil, ErrBlocked
+		case model.WordMask:
+			for i := m.Start; i < m.End; i++ {
+				runes[i] = '*'
+			}
+			masked = true
+		case model.WordReview:
+			review = append(review, ws[m.Index].Word)
+		}
+	}
+	if masked {
+		text = string(runes)
+	}
+	return text, review, nil
+}
+
+// Sensitive 命中词库里任何一个词都算，不管是拦截、打码还是审核，用于热搜这种不该出现敏感词的地方
+func Sensitive(text string) bool {
+	a, _ := current()
+	if a == nil || text == "" {
+		return false
+	}
+	return len(a.Match([]rune(text))) > 0
+}
+
+// Flag 把命中审核词的内容以系统身份送进举报队列
+func Flag(targetType int, targetId uint, authorId uint, hits []string) {
+	if len(hits) == 0 || targetId == 0 {
+		return
+	}
+	report := model.Report{
+		TargetType: targetType,
+		TargetID:   targetId,
+		AuthorID:   authorId,
+		Reason:     model.ReasonOther,
+		Detail:     fmt.Sprintf("命中敏感词：%s", strings.Join(hits, ",")),
+	}
+	if _, err := global.Moderation.CreateReport(&report); err != nil {
+		zlog.Error("敏感词送审失败", zap.Int("type", targetType), zap.Uint("id", targetId), zap.Error(err))
+	}
+}
+
+func validWord(word string, action int) bool {
+	n := utf8.RuneCountInString(word)
+	return n > 0 && n <= 64 && action >= model.WordBlock && action <= model.WordReview
+}
+
+func GetWords(role int, offset int, limit int) ([]model.SensitiveWord, bool, error) {
+	if !rbac.HasPermission(role, model.PermWordManage) {
+		return nil, false, nil
+	}
+	ws, err := global.Moderation.GetWords(offset, limit)
+	if err != nil {
+		return nil, true, err
+	}
+	return ws, true, nil
+}
+
+// GetWord 审计用，取修改前的敏感词，不存在时ID为0
+func GetWord(wordId uint) (model.SensitiveWord, error) {
+	return global.Moderation.GetWord(wordId)
+}
+
+func AddWord(role int, word string, action int) (model.SensitiveWord, bool, bool, error) { //第一个bool判断是否有权限，第二个bool判断是否添加成功
+	w := model.SensitiveWord{Word: strings.ToLower(strings.TrimSpace(word)), Action: action}
+	if !rbac.HasPermission(role, model.PermWordManage) {
+		return w, false, false, nil
+	}
+	if !validWord(w.Word, action) {
+		return w, true, false, nil
+	}
+	ok, err := global.Moderation.CreateWord(&w)
+	if err != nil || !ok {
+		return w, true, false, err
+	}
+	return w, true, true, load()
+}
+
+func UpdateWord(role int, wordId uint, action int) (bool, bool, error) {
+	if !rbac.HasPermission(role, model.PermWordManage) {
+		return false, false, nil
+	}
+	if !validWord("-", action) {
+		return true, false, nil
+	}
+	ok, err := global.Moderation.UpdateWord(wordId, action)
+	if err != nil || !ok {
+		return true, false, err
+	}
+	return true, true, load()
+}
+
+func DeleteWord(role int, wordId uint) (bool, bool, error) {
+	if !rbac.HasPermission(role, model.PermWordManage) {
+		return false, false, nil
+	}
+	ok, err := global.Moderation.DeleteWord(wordId)
+	if err != nil || !ok {
+		return true, false, err
+	}
+	return true, true, load()
+}
@@ -0,0 +1,80 @@
+package hot
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/zlog"
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// RefreshCreators 热门作者 = 最近一周发帖的热度 + 粉丝数 * creator.followerWeight
+func RefreshCreators(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		zlog.Info("热门作者任务被取消")
+		return
+	default:
+	}
+	size := viper.GetInt("creator.size")
+	stats, err := global.User.CreatorStats(time.Now().Add(-windowSpan(WindowWeek)), size)
+	if err != nil {
+		return
+	}
+	weight := viper.GetFloat64("creator.followerWeight")
+	scores := make(map[uint]float64, len(stats))
+	for _, s := range stats {
+		score := Points(s.Likes, s.Comments, s.Views) + float64(s.Followers)*weight
+		if score > 0 {
+			scores[s.UserID] = score
+		}
+	}
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return scores[ids[i]] > scores[ids[j]] })
+	if len(ids) > size {
+		ids = ids[:size]
+	}
+	//GetUsersByIds会过滤掉已注销的用户
+	users, err := global.User.GetUsersByIds(ids)
+	if err != nil {
+		return
+	}
+	members := make([]redis.Z, 0, len(users))
+	for _, u := range users {
+		members = append(members, redis.Z{Score: scores[u.ID], Member: u.ID})
+	}
+	if err = global.UserRedis.SetCreatorRank(members); err != nil {
+		return
+	}
+	zlog.Info("热门作者榜已刷新", zap.Int("count", len(members)))
+}
+
+type CreatorEntry struct {
+	UserID uint
+	Score  float64
+}
+
+func TopCreators(limit int) ([]CreatorEntry, error) {
+	zs, err := global.UserRedis.GetCreatorRank(limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]CreatorEntry, 0, len(zs))
+	for _, z := range zs {
+		id, err := strconv.ParseUint(z.Member.(string), 10, 64)
+		if err != nil {
+			zlog.Error("解析字符串失败", zap.Error(err))
+			continue
+		}
+		entries = append(entries, CreatorEntry{UserID: uint(id), Score: z.Score})
+	}
+	return entries, nil
+}
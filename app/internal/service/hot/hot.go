@@ -0,0 +1,158 @@
+package hot
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/zlog"
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+)
+
+var windowDays = map[string]int{WindowDay: 1, WindowWeek: 7, WindowMonth: 30}
+
+var Windows = []string{WindowDay, WindowWeek, WindowMonth}
+
+func ValidWindow(window string) bool {
+	_, ok := windowDays[window]
+	return ok
+}
+
+func windowSpan(window string) time.Duration {
+	return time.Duration(windowDays[window]) * 24 * time.Hour
+}
+
+// Points 原始热度，权重可以在配置里调
+func Points(likes uint, comments uint, views uint) float64 {
+	return float64(likes)*viper.GetFloat64("hot.likeWeight") +
+		float64(comments)*viper.GetFloat64("hot.commentWeight") +
+		float64(views)*viper.GetFloat64("hot.viewWeight")
+}
+
+// Score 参考Hacker News：热度 / (发布小时数+2)^gravity，越新的帖子衰减越慢
+func Score(points float64, created time.Time, now time.Time) float64 {
+	if points <= 0 {
+		return 0
+	}
+	hours := now.Sub(created).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	return points / math.Pow(hours+2, viper.GetFloat64("hot.gravity"))
+}
+
+// scores 帖子当前所在的各个榜单和对应分数
+func scores(points float64, created time.Time, now time.Time) map[string]float64 {
+	s := Score(points, created, now)
+	result := make(map[string]float64, len(Windows))
+	for _, w := range Windows {
+		if now.Sub(created) < windowSpan(w) {
+			result[w] = s
+		}
+	}
+	return result
+}
+
+// Refresh 定时从数据库全量重算，衰减和清理过期、已删除的帖子都靠这一步
+func Refresh(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		zlog.Info("热度榜任务被取消")
+		return
+	default:
+	}
+	now := time.Now()
+	posts, err := global.Post.RecentPosts(now.Add(-windowSpan(WindowMonth)))
+	if err != nil {
+		return
+	}
+	points := make(map[uint]float64, len(posts))
+	created := make(map[uint]int64, len(posts))
+	ranks := make(map[string][]redis.Z, len(Windows))
+	for _, w := range Windows {
+		ranks[w] = nil
+	}
+	for _, p := range posts {
+		pts := Points(p.LikeCount, p.CommentCount, p.ViewCount)
+		points[p.ID] = pts
+		created[p.ID] = p.CreatedAt.Unix()
+		for w, s := range scores(pts, p.CreatedAt, now) {
+			ranks[w] = append(ranks[w], redis.Z{Score: s, Member: p.ID})
+		}
+	}
+	if err = global.PostRedis.RebuildHotRank(points, created, ranks, viper.GetInt("hot.size"), now.Unix()); err != nil {
+		return
+	}
+	zlog.Info("热度榜已刷新", zap.Int("count", len(posts)))
+}
+
+// Track 帖子发布（或审核通过）后开始参与排名
+func Track(postId uint, created time.Time) {
+	_ = global.PostRedis.TrackHot(postId, created.Unix())
+}
+
+func Remove(postId uint) {
+	_ = global.PostRedis.RemoveHot(postId, Windows)
+}
+
+// bump 点赞、评论、浏览时增量更新，失败只影响排名，不影响操作本身。
+// 分数按上次全量重算的时间来算，和榜单上其他帖子用同一个时间基准，
+// 否则刚被点过赞的旧帖子会因为用了更晚的时间而衰减得比别人多
+func bump(postId uint, delta float64) {
+	if delta == 0 {
+		return
+	}
+	points, created, ref, err := global.PostRedis.BumpHot(postId, delta)
+	if err != nil || created == 0 {
+		return
+	}
+	now := time.Now()
+	if ref != 0 {
+		now = time.Unix(ref, 0)
+	}
+	_ = global.PostRedis.SetHotScores(postId, scores(points, time.Unix(created, 0), now))
+}
+
+func Like(postId uint, n int) {
+	bump(postId, float64(n)*viper.GetFloat64("hot.likeWeight"))
+}
+
+func Comment(postId uint, n int) {
+	bump(postId, float64(n)*viper.GetFloat64("hot.commentWeight"))
+}
+
+func View(postId uint) {
+	bump(postId, viper.GetFloat64("hot.viewWeight"))
+}
+
+type Entry struct {
+	PostID uint
+	Score  float64
+}
+
+func Top(window string, limit int) ([]Entry, error) {
+	zs, err := global.PostRedis.GetHotRank(window, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(zs))
+	for _, z := range zs {
+		id, err := strconv.ParseUint(z.Member.(string), 10, 64)
+		if err != nil {
+			zlog.Error("解析字符串失败", zap.Error(err))
+			continue
+		}
+		entries = append(entries, Entry{PostID: uint(id), Score: z.Score})
+	}
+	return entries, nil
+}
@@ -0,0 +1,130 @@
+package hot
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/red"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	old := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, old) })
+}
+
+func windowsOf(m map[string]float64) []string {
+	ws := make([]string, 0, len(m))
+	for w := range m {
+		ws = append(ws, w)
+	}
+	sort.Strings(ws)
+	return ws
+}
+
+func TestScores(t *testing.T) {
+	setConfig(t, "hot.gravity", 1.8)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		points  float64
+		created time.Time
+		windows []string
+	}{
+		{name: "两小时前发布，进所有榜", points: 10, created: now.Add(-2 * time.Hour), windows: []string{WindowDay, WindowMonth, WindowWeek}},
+		{name: "三天前发布，不进日榜", points: 10, created: now.Add(-72 * time.Hour), windows: []string{WindowMonth, WindowWeek}},
+		{name: "十天前发布，只进月榜", points: 10, created: now.Add(-240 * time.Hour), windows: []string{WindowMonth}},
+		{name: "超过一个月，不进任何榜", points: 10, created: now.Add(-31 * 24 * time.Hour), windows: []string{}},
+		{name: "发布时间晚于基准时间也算新帖", points: 10, created: now.Add(time.Hour), windows: []string{WindowDay, WindowMonth, WindowWeek}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scores(tt.points, tt.created, now)
+			if ws := windowsOf(got); !reflect.DeepEqual(ws, tt.windows) {
+				t.Fatalf("windows = %v, want %v", ws, tt.windows)
+			}
+			want := Score(tt.points, tt.created, now)
+			for w, s := range got {
+				if s != want {
+					t.Errorf("%s score = %v, want %v", w, s, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	setConfig(t, "hot.gravity", 1.8)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	if s := Score(0, now, now); s != 0 {
+		t.Errorf("no points should score 0, got %v", s)
+	}
+	if s, want := Score(10, now.Add(time.Hour), now), 10/math.Pow(2, 1.8); math.Abs(s-want) > 1e-9 {
+		t.Errorf("future post score = %v, want %v (age clamped to 0)", s, want)
+	}
+	if Score(10, now.Add(-time.Hour), now) <= Score(10, now.Add(-5*time.Hour), now) {
+		t.Error("newer post should score higher with equal points")
+	}
+	if Score(20, now.Add(-time.Hour), now) <= Score(10, now.Add(-time.Hour), now) {
+		t.Error("more points should score higher at equal age")
+	}
+}
+
+type fakeHot struct {
+	red.PostRedis
+	points  map[uint]float64
+	created map[uint]int64
+	ref     int64
+	scores  map[uint]map[string]float64
+}
+
+func (f *fakeHot) BumpHot(postId uint, delta float64) (float64, int64, int64, error) {
+	created, ok := f.created[postId]
+	if !ok {
+		return 0, 0, 0, nil
+	}
+	f.points[postId] += delta
+	return f.points[postId], created, f.ref, nil
+}
+
+func (f *fakeHot) SetHotScores(postId uint, scores map[string]float64) error {
+	f.scores[postId] = scores
+	return nil
+}
+
+// 增量更新要用上次重算的时间，同样热度、同时发布的帖子不管什么时候被点赞，分数都一样
+func TestBumpUsesRefreshTime(t *testing.T) {
+	setConfig(t, "hot.gravity", 1.8)
+	setConfig(t, "hot.likeWeight", 1.0)
+	ref := time.Now().Add(-3 * time.Hour)
+	created := ref.Add(-5 * time.Hour).Unix()
+	fake := &fakeHot{
+		points:  map[uint]float64{1: 4, 2: 4},
+		created: map[uint]int64{1: created, 2: created},
+		ref:     ref.Unix(),
+		scores:  make(map[uint]map[string]float64),
+	}
+	old := global.PostRedis
+	global.PostRedis = fake
+	t.Cleanup(func() { global.PostRedis = old })
+
+	Like(1, 1)
+	Like(2, 1)
+	want := scores(5, time.Unix(created, 0), time.Unix(ref.Unix(), 0))
+	for _, id := range []uint{1, 2} {
+		if !reflect.DeepEqual(fake.scores[id], want) {
+			t.Errorf("post %d scores = %v, want %v", id, fake.scores[id], want)
+		}
+	}
+
+	Like(3, 1)
+	if _, ok := fake.scores[3]; ok {
+		t.Error("post outside the hot set should not get a score")
+	}
+}
@@ -0,0 +1,162 @@
+package indexer
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"commmunity/app/zlog"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+const batchSize = 500
+
+// 索引更新失败只影响搜索结果，不影响发帖、评论本身，所以这里都不返回错误
+
+func postDocument(p model.Post) search.Document {
+	return search.Document{Type: search.TypePost, ID: p.ID, AuthorID: p.UserID, Title: p.Title, Content: p.Content, Paid: p.Paid, CreatedAt: p.CreatedAt}
+}
+
+func commentDocument(c model.Comment) search.Document {
+	return search.Document{Type: search.TypeComment, ID: c.ID, PostID: c.PostID, AuthorID: c.UserID, Content: c.Content, CreatedAt: c.CreatedAt}
+}
+
+func userDocument(u model.User) search.Document {
+	return search.Document{Type: search.TypeUser, ID: u.ID, AuthorID: u.ID, Title: u.UserProfile.Name,
+		Content: u.UserProfile.Introduction, CreatedAt: u.CreatedAt}
+}
+
+// Post 发帖、编辑、审核通过、隐藏、恢复隐藏后调用，不公开的帖子连同评论从索引里删掉，恢复时评论一起加回来；
+// 向量化可能要调外部接口，放到后台做
+func Post(postId uint) {
+	p, err := global.Post.GetPostDetail(postId)
+	if err != nil {
+		return
+	}
+	if p.ID == 0 || p.Hidden || p.Status != model.PostPublished {
+		_ = global.Search.DeleteDocument(search.TypePost, postId)
+		global.Vectors.Delete(postId)
+		for _, c := range p.Comments {
+			_ = global.Search.DeleteDocument(search.TypeComment, c.ID)
+		}
+		return
+	}
+	_ = global.Search.IndexDocument(postDocument(p))
+	for _, c := range p.Comments {
+		_ = global.Search.IndexDocument(commentDocument(c))
+	}
+	go embedPosts([]model.Post{p})
+}
+
+// RemovePost 帖子下的评论一起删
+func RemovePost(postId uint, commentIds []uint) {
+	_ = global.Search.DeleteDocument(search.TypePost, postId)
+	global.Vectors.Delete(postId)
+	_ = global.Post.DeleteEmbedding(postId)
+	for _, id := range commentIds {
+		_ = global.Search.DeleteDocument(search.TypeComment, id)
+	}
+}
+
+// Comment 帖子不公开时评论也不进索引，等帖子恢复后由Post补回来
+func Comment(commentId uint) {
+	c, err := global.Post.GetCommentDetail(commentId)
+	if err != nil {
+		return
+	}
+	visible := c.ID != 0 && !c.Hidden
+	if visible {
+		ids, err := global.Post.VisiblePostIds([]uint{c.PostID})
+		if err != nil {
+			return
+		}
+		visible = len(ids) == 1
+	}
+	if !visible {
+		_ = global.Search.DeleteDocument(search.TypeComment, commentId)
+		return
+	}
+	_ = global.Search.IndexDocument(commentDocument(c))
+}
+
+func RemoveComment(commentId uint) {
+	_ = global.Search.DeleteDocument(search.TypeComment, commentId)
+}
+
+// User 注册和修改昵称、简介后调用
+func User(userId uint) {
+	users, err := global.User.GetUsersByIds([]uint{userId})
+	if err != nil {
+		return
+	}
+	if len(users) == 0 { // 已注销
+		RemoveUser(userId)
+		return
+	}
+	_ = global.Search.IndexDocument(userDocument(users[0]))
+}
+
+func RemoveUser(userId uint) {
+	_ = global.Search.DeleteDocument(search.TypeUser, userId)
+}
+
+// Rebuild 内置索引只在内存里，启动时从数据库全量加载一次；用MySQL全文索引时什么都不做
+func Rebuild(ctx context.Context) {
+	if !search.Embedded() {
+		return
+	}
+	posts, comments, users := 0, 0, 0
+	for lastId := uint(0); ; {
+		if ctx.Err() != nil {
+			return
+		}
+		ps, err := global.Post.ScanPosts(lastId, batchSize)
+		if err != nil {
+			return
+		}
+		for _, p := range ps {
+			_ = global.Search.IndexDocument(postDocument(p))
+		}
+		posts += len(ps)
+		if len(ps) < batchSize {
+			break
+		}
+		lastId = ps[len(ps)-1].ID
+	}
+	for lastId := uint(0); ; {
+		if ctx.Err() != nil {
+			return
+		}
+		cs, err := global.Post.ScanComments(lastId, batchSize)
+		if err != nil {
+			return
+		}
+		for _, c := range cs {
+			_ = global.Search.IndexDocument(commentDocument(c))
+		}
+		comments += len(cs)
+		if len(cs) < batchSize {
+			break
+		}
+		lastId = cs[len(cs)-1].ID
+	}
+	for lastId := uint(0); ; {
+		if ctx.Err() != nil {
+			return
+		}
+		us, err := global.User.ScanUsers(lastId, batchSize)
+		if err != nil {
+			return
+		}
+		for _, u := range us {
+			_ = global.Search.IndexDocument(userDocument(u))
+		}
+		users += len(us)
+		if len(us) < batchSize {
+			break
+		}
+		lastId = us[len(us)-1].ID
+	}
+	zlog.Info("搜索索引重建完成", zap.Int("posts", posts), zap.Int("comments", comments), zap.Int("users", users))
+}
@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"testing"
+	"time"
+)
+
+type fakeCommentPosts struct {
+	fakePosts
+	post     model.Post
+	comments map[uint]model.Comment
+}
+
+func (f *fakeCommentPosts) GetPostDetail(postId uint) (model.Post, error) {
+	if f.post.ID != postId {
+		return model.Post{}, nil
+	}
+	return f.post, nil
+}
+
+func (f *fakeCommentPosts) GetCommentDetail(commentId uint) (model.Comment, error) {
+	return f.comments[commentId], nil
+}
+
+func commentHits(t *testing.T) int {
+	t.Helper()
+	result, err := global.Search.Search(search.Query{Keyword: "评论内容", Type: search.TypeComment, Page: model.PageQuery{Limit: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(result.Hits)
+}
+
+// 帖子不公开时，它下面的评论不能被搜到，恢复后再加回来
+func TestCommentFollowsPostVisibility(t *testing.T) {
+	c := model.Comment{PostID: 1, UserID: 2, Content: "一条评论内容"}
+	c.ID = 10
+	p := model.Post{UserID: 2, Title: "标题", Content: "正文", Hidden: true, Comments: []model.Comment{c}}
+	p.ID = 1
+	posts := &fakeCommentPosts{
+		fakePosts: fakePosts{visible: map[uint]bool{}},
+		post:      p,
+		comments:  map[uint]model.Comment{10: c},
+	}
+	oldPost, oldSearch, oldEmbedder, oldVectors := global.Post, global.Search, global.Embedder, global.Vectors
+	global.Post, global.Search = posts, search.NewMemoryIndex()
+	global.Embedder, global.Vectors = search.HashEmbedder{Dim: 16}, search.NewVectorIndex()
+	t.Cleanup(func() {
+		global.Post, global.Search, global.Embedder, global.Vectors = oldPost, oldSearch, oldEmbedder, oldVectors
+	})
+
+	Comment(10)
+	if n := commentHits(t); n != 0 {
+		t.Fatalf("comment under hidden post indexed, %d hits", n)
+	}
+
+	posts.post.Hidden = false
+	posts.visible[1] = true
+	Post(1)
+	if n := commentHits(t); n != 1 {
+		t.Fatalf("comment should come back with its post, %d hits", n)
+	}
+	//等后台向量化写完，免得和后面的修改抢着读帖子状态
+	for i := 0; ; i++ {
+		if _, ok := global.Vectors.Vector(1); ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("post was not embedded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	posts.post.Hidden = true
+	posts.visible[1] = false
+	Post(1)
+	if n := commentHits(t); n != 0 {
+		t.Fatalf("comment should leave with its post, %d hits", n)
+	}
+}
@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"commmunity/app/zlog"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+const embedBatchSize = 32
+
+func embedHash(text string) string {
+	sum := sha1.Sum([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// embedPosts 向量化并存库，同时更新内存里的向量索引。
+// 调外部接口可能要好几秒，这期间帖子可能被删除、隐藏或撤回审核，写入前要再查一次
+func embedPosts(posts []model.Post) {
+	if len(posts) == 0 {
+		return
+	}
+	texts := make([]string, len(posts))
+	for i, p := range posts {
+		texts[i] = search.EmbedText(p.Title, p.Content)
+	}
+	vectors, err := global.Embedder.Embed(texts)
+	if err != nil {
+		zlog.Error("帖子向量化失败", zap.Int("count", len(posts)), zap.Error(err))
+		return
+	}
+	ids := make([]uint, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	visibleIds, err := global.Post.VisiblePostIds(ids)
+	if err != nil {
+		return
+	}
+	visible := make(map[uint]bool, len(visibleIds))
+	for _, id := range visibleIds {
+		visible[id] = true
+	}
+	for i, p := range posts {
+		if !visible[p.ID] {
+			continue
+		}
+		_ = global.Post.SaveEmbedding(&model.PostEmbedding{
+			PostID: p.ID,
+			Model:  global.Embedder.Name(),
+			Hash:   embedHash(texts[i]),
+			Vector: search.EncodeVector(vectors[i]),
+		})
+		global.Vectors.Upsert(postDocument(p), vectors[i])
+	}
+}
+
+// Embed 查询词或没来得及向量化的帖子临时算一次，不存库
+func Embed(text string) ([]float32, error) {
+	vectors, err := global.Embedder.Embed([]string{text})
+	if err != nil {
+		zlog.Error("向量化失败", zap.Error(err))
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// RebuildVectors 启动时加载已存的向量，模型或内容变了的、还没有向量的重新计算
+func RebuildVectors(ctx context.Context) {
+	name := global.Embedder.Name()
+	stored := make(map[uint]model.PostEmbedding)
+	for lastId := uint(0); ; {
+		if ctx.Err() != nil {
+			return
+		}
+		es, err := global.Post.ScanEmbeddings(lastId, batchSize)
+		if err != nil {
+			return
+		}
+		for _, e := range es {
+			if e.Model == name {
+				stored[e.PostID] = e
+			}
+		}
+		if len(es) < batchSize {
+			break
+		}
+		lastId = es[len(es)-1].PostID
+	}
+	loaded, embedded := 0, 0
+	for lastId := uint(0); ; {
+		if ctx.Err() != nil {
+			return
+		}
+		ps, err := global.Post.ScanPosts(lastId, batchSize)
+		if err != nil {
+			return
+		}
+		var stale []model.Post
+		for _, p := range ps {
+			e, ok := stored[p.ID]
+			if ok && e.Hash == embedHash(search.EmbedText(p.Title, p.Content)) {
+				global.Vectors.Upsert(postDocument(p), search.DecodeVector(e.Vector))
+				loaded++
+				continue
+			}
+			stale = append(stale, p)
+		}
+		for i := 0; i < len(stale); i += embedBatchSize {
+			end := min(i+embedBatchSize, len(stale))
+			embedPosts(stale[i:end])
+			embedded += end - i
+		}
+		if len(ps) < batchSize {
+			break
+		}
+		lastId = ps[len(ps)-1].ID
+	}
+	zlog.Info("帖子向量加载完成", zap.Int("loaded", loaded), zap.Int("embedded", embedded))
+}
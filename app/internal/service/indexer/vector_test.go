@@ -0,0 +1,54 @@
+package indexer
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"testing"
+)
+
+type fakePosts struct {
+	msq.PostData
+	visible map[uint]bool
+	saved   []uint
+}
+
+func (f *fakePosts) VisiblePostIds(postIds []uint) ([]uint, error) {
+	var ids []uint
+	for _, id := range postIds {
+		if f.visible[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakePosts) SaveEmbedding(e *model.PostEmbedding) error {
+	f.saved = append(f.saved, e.PostID)
+	return nil
+}
+
+// 向量化期间被删除或隐藏的帖子不能再写回索引
+func TestEmbedPostsSkipsHidden(t *testing.T) {
+	posts := &fakePosts{visible: map[uint]bool{1: true}}
+	oldPost, oldEmbedder, oldVectors := global.Post, global.Embedder, global.Vectors
+	global.Post, global.Embedder, global.Vectors = posts, search.HashEmbedder{Dim: 16}, search.NewVectorIndex()
+	t.Cleanup(func() { global.Post, global.Embedder, global.Vectors = oldPost, oldEmbedder, oldVectors })
+
+	ps := make([]model.Post, 3)
+	for i := range ps {
+		ps[i].ID = uint(i + 1)
+		ps[i].Title = "title"
+	}
+	embedPosts(ps)
+	if len(posts.saved) != 1 || posts.saved[0] != 1 {
+		t.Errorf("saved = %v, want [1]", posts.saved)
+	}
+	if global.Vectors.Len() != 1 {
+		t.Errorf("index has %d vectors, want 1", global.Vectors.Len())
+	}
+	if _, ok := global.Vectors.Vector(1); !ok {
+		t.Error("visible post missing from index")
+	}
+}
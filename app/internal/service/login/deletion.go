@@ -0,0 +1,194 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/internal/ws"
+	"commmunity/app/zlog"
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	deletionGrace = 14 * 24 * time.Hour
+	reauthWindow  = 10 * time.Minute
+)
+
+// reauthenticate 敏感操作前再确认一次身份。只用第三方登录的账号没有密码，
+// 开了两步验证就用验证码，否则要求当前会话是最近10分钟内重新登录得到的
+func reauthenticate(user *model.User, password string, code string, sessionId uint) (bool, error) {
+	if user.Hash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(password)) == nil, nil
+	}
+	if user.TotpEnabled {
+		return checkSecondFactor(user.ID, user.TotpSecret, code)
+	}
+	session, err := global.User.GetSession(sessionId)
+	if err != nil {
+		return false, err
+	}
+	if session.ID == 0 || session.UserID != user.ID || session.RevokedAt != nil {
+		return false, nil
+	}
+	return time.Since(session.CreatedAt) <= reauthWindow, nil
+}
+
+// RequestDeletion 申请注销，14天内可撤销，期间账号照常使用
+func RequestDeletion(account string, password string, code string, sessionId uint) (*time.Time, error, bool) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return nil, err, false
+	}
+	ok, err := reauthenticate(user, password, code, sessionId)
+	if err != nil || !ok {
+		return nil, err, false
+	}
+	if user.DeletionAt != nil {
+		return user.DeletionAt, nil, true
+	}
+	at := time.Now().Add(deletionGrace)
+	if err = global.User.ScheduleDeletion(user.ID, &at); err != nil {
+		return nil, err, false
+	}
+	content := fmt.Sprintf("你已申请注销账号，将于%s正式注销，在此之前可随时撤销", at.Format("2006-01-02 15:04:05"))
+	ws.SendNotice(user.ID, model.NoticeSystem, 0, 0, content)
+	if user.EmailVerified {
+		if err = global.Mail.Send(user.Email, "账号注销申请", content); err != nil {
+			zlog.Warn("注销提醒邮件发送失败", zap.String("account", account))
+		}
+	}
+	return &at, nil, true
+}
+
+func CancelDeletion(account string) (error, bool) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return err, false
+	}
+	if user.DeletionAt == nil {
+		return nil, false
+	}
+	if err = global.User.ScheduleDeletion(user.ID, nil); err != nil {
+		return err, false
+	}
+	ws.SendNotice(user.ID, model.NoticeSystem, 0, 0, "你已撤销账号注销申请")
+	return nil, true
+}
+
+func GetDeletion(account string) (*time.Time, error) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return nil, err
+	}
+	return user.DeletionAt, nil
+}
+
+// PurgeDeletedAccounts 由定时任务调用，冷静期结束后清理账号
+func PurgeDeletedAccounts(ctx context.Context) {
+	users, err := global.User.GetDueDeletions(time.Now(), 50)
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		select {
+		case <-ctx.Done():
+			zlog.Info("账号注销任务被取消")
+			return
+		default:
+		}
+		if err = purge(user); err != nil {
+			zlog.Error("注销账号失败，下次重试", zap.Uint("userId", user.ID), zap.Error(err))
+			continue
+		}
+		zlog.Info("账号已注销", zap.Uint("userId", user.ID))
+	}
+}
+
+func purge(user model.User) error {
+	if err := LogoutEverywhere(user.ID); err != nil {
+		return err
+	}
+	followers, err := global.User.GetFollowers(user.ID)
+	if err != nil {
+		return err
+	}
+	followings, err := global.User.GetFollowings(user.ID)
+	if err != nil {
+		return err
+	}
+	partners, err := global.Message.GetMessagePartners(user.ID)
+	if err != nil {
+		return err
+	}
+	if err = removeLikes(user.Account); err != nil {
+		return err
+	}
+	postIds, err := global.User.AnonymizeUser(user.ID)
+	if err != nil {
+		return err
+	}
+	indexer.RemoveUser(user.ID)
+	//缓存按账号存放，关系两端都要清
+	_ = global.UserRedis.DelUserCache(user.ID)
+	_ = global.UserRedis.DelRoleCache(user.ID)
+	_ = global.UserRedis.DelFollowersCache(user.Account)
+	_ = global.UserRedis.DelFollowingsCache(user.Account)
+	for _, u := range followers {
+		_ = global.UserRedis.DelFollowingsCache(u.Account)
+		_ = global.UserRedis.DelUserCache(u.ID)
+	}
+	for _, u := range followings {
+		_ = global.UserRedis.DelFollowersCache(u.Account)
+		_ = global.UserRedis.DelUserCache(u.ID)
+	}
+	//帖子列表和私信历史里都带着昵称和头像
+	for _, id := range postIds {
+		_ = global.PostRedis.DelPostCache(id)
+	}
+	_ = global.PostRedis.DelPostListCache()
+	for _, id := range partners {
+		_ = global.MessageRedis.DelMessageCache(user.ID, id)
+	}
+	return nil
+}
+
+// removeLikes 点赞集合里存的是账号，点赞数由定时任务同步回数据库；反向索引完整时按索引删，否则扫描
+func removeLikes(account string) error {
+	ready, err := global.Recommend.LikedIndexReady()
+	if err != nil {
+		return err
+	}
+	if ready {
+		ids, err := global.Recommend.GetAllLiked(account)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err = global.PostRedis.Unlike(fmt.Sprintf("post:likes:%d", id), account); err != nil {
+				return err
+			}
+		}
+		return global.Recommend.DelLiked(account)
+	}
+	cursor := uint64(0)
+	for {
+		next, keys, err := global.PostRedis.ScanRedis("post:likes:*", cursor)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = global.PostRedis.Unlike(key, account); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return global.Recommend.DelLiked(account)
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,129 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/utils"
+	"commmunity/app/zlog"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verifyEmailPurpose   = "verify-email"
+	resetPasswordPurpose = "reset-password"
+)
+
+func isEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func sendVerifyEmail(userId uint, email string) error {
+	token, err := utils.MakeOnceToken(verifyEmailPurpose)
+	if err != nil {
+		return err
+	}
+	err = global.UserRedis.SetOnceToken(verifyEmailPurpose, token, fmt.Sprintf("%d:%s", userId, email), 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/account/verify-email?token=%s", viper.GetString("mail.linkBase"), token)
+	body := fmt.Sprintf("你好，请在24小时内点击下面的链接完成邮箱验证：\n%s\n如果不是你本人操作，请忽略这封邮件。", link)
+	return global.Mail.Send(email, "邮箱验证", body)
+}
+
+func BindEmail(userId uint, email string) (error, bool) {
+	if !isEmail(email) {
+		return nil, false
+	}
+	user, err := global.User.GetUserByEmail(email)
+	if err != nil {
+		return err, false
+	}
+	if user != nil && user.ID != userId {
+		zlog.Warn("邮箱已被使用", zap.String("email", email))
+		return nil, false
+	}
+	if err = global.User.SetEmail(userId, email); err != nil {
+		return err, false
+	}
+	return sendVerifyEmail(userId, email), true
+}
+
+func VerifyEmail(token string) (error, bool) {
+	if !utils.VerifyOnceToken(verifyEmailPurpose, token) {
+		return nil, false
+	}
+	value, err := global.UserRedis.ConsumeOnceToken(verifyEmailPurpose, token)
+	if err != nil {
+		return err, false
+	}
+	idStr, email, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	flag, err := global.User.VerifyEmail(uint(id), email)
+	if err != nil {
+		return err, false
+	}
+	return global.UserRedis.DelUserCache(uint(id)), flag
+}
+
+// RequestPasswordReset 邮箱不存在或未验证时也返回成功，避免被用来探测注册邮箱
+func RequestPasswordReset(email string) error {
+	if !isEmail(email) {
+		return nil
+	}
+	user, err := global.User.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.EmailVerified {
+		return nil
+	}
+	token, err := utils.MakeOnceToken(resetPasswordPurpose)
+	if err != nil {
+		return err
+	}
+	err = global.UserRedis.SetOnceToken(resetPasswordPurpose, token, strconv.FormatUint(uint64(user.ID), 10), 30*time.Minute)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset-password?token=%s", viper.GetString("mail.linkBase"), token)
+	body := fmt.Sprintf("你好，请在30分钟内点击下面的链接重置密码：\n%s\n如果不是你本人操作，请忽略这封邮件，你的密码不会被修改。", link)
+	return global.Mail.Send(email, "重置密码", body)
+}
+
+func ResetPassword(token string, password string) (error, bool) {
+	if password == "" || !utils.VerifyOnceToken(resetPasswordPurpose, token) {
+		return nil, false
+	}
+	value, err := global.UserRedis.ConsumeOnceToken(resetPasswordPurpose, token)
+	if err != nil {
+		return err, false
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		zlog.Error("重置密码哈希失败", zap.Error(err))
+		return err, false
+	}
+	if err = global.User.ResetPassword(uint(id), string(hash)); err != nil {
+		return err, false
+	}
+	return LogoutEverywhere(uint(id)), true
+}
@@ -0,0 +1,117 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/zlog"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	accountFailLimit = 5  // 同一账号连续失败5次后开始锁定
+	ipFailLimit      = 20 // 同一IP失败20次后开始锁定
+	failWindow       = 24 * time.Hour
+	baseLockTime     = 1 * time.Minute
+	maxLockTime      = 1 * time.Hour
+)
+
+func accountTarget(account string) string {
+	return "account:" + account
+}
+
+func ipTarget(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginLockTTL 返回账号或IP剩余的锁定时间，0表示未锁定
+func LoginLockTTL(account string, ip string) (time.Duration, error) {
+	accountTTL, err := global.UserRedis.LoginLockTTL(accountTarget(account))
+	if err != nil {
+		return 0, err
+	}
+	ipTTL, err := global.UserRedis.LoginLockTTL(ipTarget(ip))
+	if err != nil {
+		return 0, err
+	}
+	return max(accountTTL, ipTTL), nil
+}
+
+// 超过阈值后每多失败一次锁定时间翻倍，最多锁1小时
+func lockDuration(count int64, limit int64) time.Duration {
+	d := baseLockTime
+	for i := limit; i < count && d < maxLockTime; i++ {
+		d *= 2
+	}
+	return min(d, maxLockTime)
+}
+
+func recordLoginFail(account string, ip string, userAgent string) {
+	global.User.SaveSecurityLog(model.SecurityLog{
+		Account:   account,
+		IP:        ip,
+		UserAgent: userAgent,
+		Event:     model.EventLoginFailed,
+	})
+	targets := []struct {
+		target string
+		limit  int64
+	}{
+		{accountTarget(account), accountFailLimit},
+		{ipTarget(ip), ipFailLimit},
+	}
+	for _, t := range targets {
+		count, err := global.UserRedis.IncrLoginFail(t.target, failWindow)
+		if err != nil || count < t.limit {
+			continue
+		}
+		d := lockDuration(count, t.limit)
+		if err = global.UserRedis.LockLogin(t.target, d); err != nil {
+			continue
+		}
+		zlog.Warn("登录失败次数过多，已锁定", zap.String("target", t.target), zap.Int64("count", count), zap.Duration("lock", d))
+		global.User.SaveSecurityLog(model.SecurityLog{
+			Account:   account,
+			IP:        ip,
+			UserAgent: userAgent,
+			Event:     model.EventLoginLocked,
+			Detail:    fmt.Sprintf("%s 连续失败%d次，锁定%s", t.target, count, d),
+		})
+	}
+}
+
+func recordLoginSuccess(account string, ip string, userAgent string) {
+	_ = global.UserRedis.ClearLoginFail(accountTarget(account))
+	global.User.SaveSecurityLog(model.SecurityLog{
+		Account:   account,
+		IP:        ip,
+		UserAgent: userAgent,
+		Event:     model.EventLoginSuccess,
+	})
+}
+
+func UnlockLogin(role int, operator string, account string, ip string) (error, bool) {
+	if !rbac.HasPermission(role, model.PermUserUnlock) {
+		return nil, false
+	}
+	if account != "" {
+		if err := global.UserRedis.UnlockLogin(accountTarget(account)); err != nil {
+			return err, false
+		}
+	}
+	if ip != "" {
+		if err := global.UserRedis.UnlockLogin(ipTarget(ip)); err != nil {
+			return err, false
+		}
+	}
+	global.User.SaveSecurityLog(model.SecurityLog{
+		Account: account,
+		IP:      ip,
+		Event:   model.EventLoginUnlock,
+		Detail:  "由管理员 " + operator + " 解锁",
+	})
+	return nil, true
+}
@@ -3,6 +3,8 @@ package login
 import (
 	"commmunity/app/internal/db/global"
 	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/indexer"
 	"commmunity/app/utils"
 	"commmunity/app/zlog"
 	"time"
@@ -11,8 +13,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Register(account string, password string, name string) (error, bool, bool) { //第一个bool判断信息是否完善，第二个bool判断用户是否可使用该账户
-	if account == "" || password == "" || name == "" {
+func Register(account string, password string, name string, email string) (error, bool, bool) { //第一个bool判断信息是否完善，第二个bool判断用户是否可使用该账户；邮箱可以不填，填了就要合法
+	if account == "" || password == "" || name == "" || (email != "" && !isEmail(email)) {
 		return nil, false, false
 	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -25,17 +27,36 @@ func Register(account string, password string, name string) (error, bool, bool)
 		zlog.Warn("用户已存在", zap.String("account", account))
 		return nil, true, false
 	}
-	err = global.User.CreateUser(account, string(hash), name)
+	if email != "" {
+		users, err = global.User.GetUserByEmail(email)
+		if users != nil || err != nil {
+			zlog.Warn("邮箱已被使用", zap.String("email", email))
+			return nil, true, false
+		}
+	}
+	name, hits, err := filter.Filter(name)
+	if err != nil {
+		return err, false, false
+	}
+	userId, err := global.User.CreateUser(account, string(hash), name, email)
 	if err != nil {
 		zlog.Error("用户创建失败", zap.String("account", account), zap.String("name", name), zap.Error(err))
 		return err, false, false
 	}
+	filter.Flag(model.ReportUser, userId, userId, hits)
+	indexer.User(userId)
+	if email == "" {
+		return nil, true, true
+	}
+	if err = sendVerifyEmail(userId, email); err != nil {
+		zlog.Warn("验证邮件发送失败，可稍后重新发送", zap.String("account", account))
+	}
 	return nil, true, true
 }
 
-// 密码最多输入5次
+// 密码连续输错5次后锁定账号，锁定时间逐次翻倍
 
-func Login(account string, password string) (error, bool, bool) { //第一个bool判断传入信息是否合格，第二个bool判断账户和密码是否对
+func Login(account string, password string, ip string, userAgent string) (error, bool, bool) { //第一个bool判断传入信息是否合格，第二个bool判断账户和密码是否对
 	if account == "" || password == "" {
 		return nil, false, false
 	}
@@ -44,25 +65,32 @@ func Login(account string, password string) (error, bool, bool) { //第一个boo
 		return err, false, false
 	}
 	if user == nil {
+		recordLoginFail(account, ip, userAgent)
 		return nil, true, false
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(password))
 	if err != nil {
-		zlog.Warn("密码错误", zap.String("password", password))
+		zlog.Warn("密码错误", zap.String("account", account), zap.String("ip", ip))
+		recordLoginFail(account, ip, userAgent)
 		return nil, true, false
 	}
+	if !user.TotpEnabled { // 开启两步验证的账号要等验证码通过才算登录成功
+		recordLoginSuccess(account, ip, userAgent)
+	}
 	return nil, true, true
 }
 
 type UserProfileDTO struct {
-	Account      string        `json:"account"`
-	Name         string        `json:"name"`
-	Introduction string        `json:"introduction"`
-	Avatar       string        `json:"avatar"`
-	Role         int           `json:"role"`
-	Vip          bool          `json:"vip"`
-	IsMuted      bool          `json:"isMuted"`
-	Posts        []UserPostDTO `json:"posts"`
+	Account       string        `json:"account"`
+	Name          string        `json:"name"`
+	Introduction  string        `json:"introduction"`
+	Avatar        string        `json:"avatar"`
+	Role          int           `json:"role"`
+	Vip           bool          `json:"vip"`
+	Email         string        `json:"email"`
+	EmailVerified bool          `json:"emailVerified"`
+	IsMuted       bool          `json:"isMuted"`
+	Posts         []UserPostDTO `json:"posts"`
 }
 type UserPostDTO struct {
 	PostID       uint   `json:"post_id"`
@@ -88,14 +116,16 @@ func GetProfile(account string) (UserProfileDTO, error) {
 		})
 	}
 	userProfile := UserProfileDTO{
-		Account:      user.Account,
-		Name:         user.UserProfile.Name,
-		Introduction: user.UserProfile.Introduction,
-		Avatar:       user.UserProfile.Avatar,
-		Role:         user.Role,
-		Vip:          user.Vip,
-		IsMuted:      user.UserProfile.IsMuted,
-		Posts:        userPostDTO,
+		Account:       user.Account,
+		Name:          user.UserProfile.Name,
+		Introduction:  user.UserProfile.Introduction,
+		Avatar:        user.UserProfile.Avatar,
+		Role:          user.Role,
+		Vip:           user.Vip,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		IsMuted:       user.UserProfile.IsMuted,
+		Posts:         userPostDTO,
 	}
 	return userProfile, nil
 }
@@ -127,21 +157,15 @@ func Logout(token string, refreshToken string) error {
 		zlog.Error("refreshToken拉入黑名单失败", zap.String("refreshToken", refreshToken))
 		return err
 	}
-	return nil
-}
-
-func DeleteUser(account string) error {
-	err := global.User.DeleteUser(account)
-	if err != nil {
-		zlog.Error("用户删除失败", zap.String("account", account))
-		return err
+	if claim.SessionId != 0 {
+		return revokeSession(claim.SessionId)
 	}
-	return global.User.DeleteUser(account)
+	return nil
 }
 
 // 短时间内应只修改一次，旧密码验证,改密踢人
 
-func ChangePassword(account string, firstPassword string, secondPassword string) (error, bool, bool) { //第一个bool检查传入信息是否合格，第二个检查两次密码是否相同
+func ChangePassword(account string, userId uint, firstPassword string, secondPassword string) (error, bool, bool) { //第一个bool检查传入信息是否合格，第二个检查两次密码是否相同
 	if firstPassword == "" || secondPassword == "" {
 		return nil, false, false
 	}
@@ -157,6 +181,10 @@ func ChangePassword(account string, firstPassword string, secondPassword string)
 	if err != nil {
 		return err, false, false
 	}
+	err = LogoutEverywhere(userId)
+	if err != nil {
+		return err, false, false
+	}
 	return nil, true, true
 }
 
@@ -167,10 +195,16 @@ func ChangeName(account string, newName string, userId uint) (error, bool) {
 		zlog.Warn("修改用户名不能为空")
 		return nil, false
 	}
-	err := global.User.ChangeUserName(account, newName)
+	newName, hits, err := filter.Filter(newName)
 	if err != nil {
 		return err, false
 	}
+	err = global.User.ChangeUserName(account, newName)
+	if err != nil {
+		return err, false
+	}
+	filter.Flag(model.ReportUser, userId, userId, hits)
+	indexer.User(userId)
 	return global.UserRedis.DelUserCache(userId), true
 }
 
@@ -183,10 +217,16 @@ func ChangeAvatar(account string, avatar string, userId uint) error {
 }
 
 func ChangeIntroduction(account string, introduction string, userId uint) error {
-	err := global.User.ChangeIntroduction(account, introduction)
+	introduction, hits, err := filter.Filter(introduction)
 	if err != nil {
 		return err
 	}
+	err = global.User.ChangeIntroduction(account, introduction)
+	if err != nil {
+		return err
+	}
+	filter.Flag(model.ReportUser, userId, userId, hits)
+	indexer.User(userId)
 	return global.UserRedis.DelUserCache(userId)
 }
 
@@ -206,14 +246,3 @@ func IsTokenValid(tokenStr string) bool {
 	}
 	return true
 }
-
-func Muted(userId uint, role int, isMuted bool) (error, bool) {
-	if role == model.RoleAdmin {
-		err := global.User.Muted(userId, isMuted)
-		if err != nil {
-			return err, false
-		}
-		return global.UserRedis.DelUserCache(userId), true
-	}
-	return nil, false
-}
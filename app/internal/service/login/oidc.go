@@ -0,0 +1,447 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/filter"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/utils"
+	"commmunity/app/zlog"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	oidcPurpose  = "oidc"
+	oidcStateTTL = 10 * time.Minute
+)
+
+// httpClient 对外请求都走这里，本地用mock的OIDC服务联调时只需要改issuer
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// OidcProvider 对应配置里oidc.providers下的一项
+type OidcProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type oidcKeys struct {
+	keys     map[string]*rsa.PublicKey
+	loadedAt time.Time
+}
+
+type oidcState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	UserID   uint   `json:"user_id"` // 不为0表示是已登录用户在绑定
+}
+
+// OidcResult 第三方回调的结果，绑定、需要两步验证、登录成功三选一
+type OidcResult struct {
+	Linked       bool
+	MfaToken     string
+	Token        string
+	RefreshToken string
+}
+
+var (
+	oidcLock       sync.Mutex
+	oidcDiscovered = make(map[string]oidcDiscovery)
+	oidcKeySets    = make(map[string]*oidcKeys)
+)
+
+func GetOidcProvider(name string) (OidcProvider, bool) {
+	name = strings.ToLower(name)
+	key := "oidc.providers." + name
+	if name == "" || !viper.IsSet(key+".issuer") {
+		return OidcProvider{}, false
+	}
+	p := OidcProvider{
+		Name:         name,
+		Issuer:       strings.TrimRight(viper.GetString(key+".issuer"), "/"),
+		ClientID:     viper.GetString(key + ".clientId"),
+		ClientSecret: viper.GetString(key + ".clientSecret"),
+		Scopes:       viper.GetStringSlice(key + ".scopes"),
+		RedirectURL:  viper.GetString(key + ".redirectUrl"),
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "email", "profile"}
+	}
+	if p.RedirectURL == "" {
+		p.RedirectURL = fmt.Sprintf("%s/account/oidc/%s/callback", viper.GetString("mail.linkBase"), name)
+	}
+	return p, p.Issuer != "" && p.ClientID != ""
+}
+
+func OidcProviders() []string {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("oidc.providers") {
+		if _, ok := GetOidcProvider(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getJSON(u string, v interface{}) error {
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求%s失败，状态码%d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover 发现文档基本不会变，拿到一次就一直用
+func discover(p OidcProvider) (oidcDiscovery, error) {
+	oidcLock.Lock()
+	d, ok := oidcDiscovered[p.Name]
+	oidcLock.Unlock()
+	if ok {
+		return d, nil
+	}
+	if err := getJSON(p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		zlog.Error("获取OIDC发现文档失败", zap.String("provider", p.Name), zap.Error(err))
+		return oidcDiscovery{}, err
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksURI == "" {
+		return oidcDiscovery{}, fmt.Errorf("OIDC发现文档不完整或issuer不一致: %s", p.Name)
+	}
+	oidcLock.Lock()
+	oidcDiscovered[p.Name] = d
+	oidcLock.Unlock()
+	return d, nil
+}
+
+// publicKey 找不到kid时重新拉一次JWKS，应对提供方轮换密钥，最多每分钟一次
+func publicKey(p OidcProvider, d oidcDiscovery, kid string) (*rsa.PublicKey, error) {
+	oidcLock.Lock()
+	set := oidcKeySets[p.Name]
+	oidcLock.Unlock()
+	if set != nil {
+		if key, ok := set.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(set.loadedAt) < time.Minute {
+			return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+		}
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(d.JwksURI, &jwks); err != nil {
+		zlog.Error("获取OIDC公钥失败", zap.String("provider", p.Name), zap.Error(err))
+		return nil, err
+	}
+	set = &oidcKeys{keys: make(map[string]*rsa.PublicKey), loadedAt: time.Now()}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		set.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	oidcLock.Lock()
+	oidcKeySets[p.Name] = set
+	oidcLock.Unlock()
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+	return key, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// BeginOidc 生成state、nonce和PKCE校验码，返回跳转到提供方的授权地址
+func BeginOidc(name string, linkUserId uint) (string, bool, error) {
+	p, ok := GetOidcProvider(name)
+	if !ok {
+		return "", false, nil
+	}
+	d, err := discover(p)
+	if err != nil {
+		return "", true, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", true, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", true, err
+	}
+	state, err := utils.MakeOnceToken(oidcPurpose)
+	if err != nil {
+		return "", true, err
+	}
+	value, _ := json.Marshal(oidcState{Provider: p.Name, Verifier: verifier, Nonce: nonce, UserID: linkUserId})
+	if err = global.UserRedis.SetOnceToken(oidcPurpose, state, string(value), oidcStateTTL); err != nil {
+		return "", true, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + query.Encode(), true, nil
+}
+
+type oidcClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func exchangeCode(p OidcProvider, d oidcDiscovery, code string, st oidcState) (oidcClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {st.Verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	resp, err := httpClient.PostForm(d.TokenEndpoint, form)
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IdToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return oidcClaims{}, err
+	}
+	if resp.StatusCode != http.StatusOK || body.IdToken == "" {
+		return oidcClaims{}, fmt.Errorf("换取令牌失败，状态码%d: %s", resp.StatusCode, body.Error)
+	}
+	token, err := jwt.Parse(body.IdToken, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("不支持的签名算法: %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return publicKey(p, d, kid)
+	})
+	if err != nil || !token.Valid {
+		return oidcClaims{}, fmt.Errorf("id_token校验失败: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if !claims.VerifyIssuer(d.Issuer, true) || !claims.VerifyAudience(p.ClientID, true) {
+		return oidcClaims{}, errors.New("id_token的issuer或audience不匹配")
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != st.Nonce {
+		return oidcClaims{}, errors.New("id_token的nonce不匹配")
+	}
+	c := oidcClaims{}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified, _ = strconv.ParseBool(v)
+	}
+	c.Name, _ = claims["name"].(string)
+	if c.Name == "" {
+		c.Name, _ = claims["preferred_username"].(string)
+	}
+	if c.Subject == "" {
+		return oidcClaims{}, errors.New("id_token缺少sub")
+	}
+	return c, nil
+}
+
+// CompleteOidc 处理提供方回调，state只能用一次
+func CompleteOidc(name string, code string, state string, ip string, userAgent string, device string) (OidcResult, error, bool) {
+	p, ok := GetOidcProvider(name)
+	if !ok || code == "" || !utils.VerifyOnceToken(oidcPurpose, state) {
+		return OidcResult{}, nil, false
+	}
+	value, err := global.UserRedis.ConsumeOnceToken(oidcPurpose, state)
+	if err != nil || value == "" {
+		return OidcResult{}, err, false
+	}
+	var st oidcState
+	if err = json.Unmarshal([]byte(value), &st); err != nil || st.Provider != p.Name {
+		return OidcResult{}, nil, false
+	}
+	d, err := discover(p)
+	if err != nil {
+		return OidcResult{}, err, false
+	}
+	claims, err := exchangeCode(p, d, code, st)
+	if err != nil {
+		zlog.Warn("第三方登录校验失败", zap.String("provider", p.Name), zap.String("ip", ip), zap.Error(err))
+		return OidcResult{}, nil, false
+	}
+	if st.UserID != 0 {
+		ok, err = global.User.CreateIdentity(&model.UserIdentity{UserID: st.UserID, Provider: p.Name, Subject: claims.Subject, Email: claims.Email})
+		if err != nil || !ok {
+			return OidcResult{}, err, false
+		}
+		return OidcResult{Linked: true}, nil, true
+	}
+	identity, err := global.User.GetIdentity(p.Name, claims.Subject)
+	if err != nil {
+		return OidcResult{}, err, false
+	}
+	var user *model.User
+	if identity.ID != 0 {
+		user, err = global.User.GetUserById(identity.UserID)
+	} else {
+		user, err = provision(p, claims)
+	}
+	if err != nil || user == nil || user.Anonymized {
+		return OidcResult{}, err, false
+	}
+	mfaToken, mfaRequired, err := BeginMfa(user.Account)
+	if err != nil {
+		return OidcResult{}, err, false
+	}
+	if mfaRequired {
+		return OidcResult{MfaToken: mfaToken}, nil, true
+	}
+	recordLoginSuccess(user.Account, ip, userAgent)
+	token, refreshToken, err := CreateSession(user.Account, ip, userAgent, device)
+	if err != nil {
+		return OidcResult{}, err, false
+	}
+	return OidcResult{Token: token, RefreshToken: refreshToken}, nil, true
+}
+
+// provision 第一次用第三方登录时自动建号，不设密码；邮箱已被占用就不带邮箱，不按邮箱自动合并账号
+func provision(p OidcProvider, claims oidcClaims) (*model.User, error) {
+	sum := sha256.Sum256([]byte(claims.Subject))
+	account := fmt.Sprintf("%s_%s", p.Name, hex.EncodeToString(sum[:])[:12])
+	existing, err := global.User.GetUser(account)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil { // 之前建过号又解绑了，换一个账号名
+		account = fmt.Sprintf("%s_%s", account, strconv.FormatInt(time.Now().UnixNano(), 36))
+	}
+	name, hits, err := filter.Filter(strings.TrimSpace(claims.Name))
+	if err != nil || name == "" {
+		name, hits = account, nil
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		name = string([]rune(name)[:50])
+	}
+	email := ""
+	if claims.EmailVerified && isEmail(claims.Email) {
+		other, err := global.User.GetUserByEmail(claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if other == nil {
+			email = claims.Email
+		}
+	}
+	userId, err := global.User.CreateUser(account, "", name, email)
+	if err != nil {
+		zlog.Error("第三方登录建号失败", zap.String("provider", p.Name), zap.Error(err))
+		return nil, err
+	}
+	if email != "" {
+		_, _ = global.User.VerifyEmail(userId, email)
+	}
+	ok, err := global.User.CreateIdentity(&model.UserIdentity{UserID: userId, Provider: p.Name, Subject: claims.Subject, Email: claims.Email})
+	if err != nil || !ok {
+		return nil, err
+	}
+	filter.Flag(model.ReportUser, userId, userId, hits)
+	indexer.User(userId)
+	zlog.Info("第三方登录自动建号", zap.String("provider", p.Name), zap.String("account", account))
+	return global.User.GetUserById(userId)
+}
+
+func GetIdentities(userId uint) ([]model.UserIdentity, error) {
+	return global.User.GetIdentities(userId)
+}
+
+func UnlinkOidc(userId uint, provider string) (error, bool, bool) { //第一个bool判断是否允许解绑，第二个bool判断是否绑定过
+	user, err := global.User.GetUserById(userId)
+	if err != nil || user == nil {
+		return err, false, false
+	}
+	identities, err := global.User.GetIdentities(userId)
+	if err != nil {
+		return err, false, false
+	}
+	if user.Hash == "" && len(identities) <= 1 { // 没设密码的账号至少要留一个登录方式
+		return nil, false, false
+	}
+	ok, err := global.User.DeleteIdentity(userId, strings.ToLower(provider))
+	if err != nil {
+		return err, true, false
+	}
+	return nil, true, ok
+}
@@ -0,0 +1,405 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/db/red"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/search"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+// mockIssuer 模拟第三方OIDC服务：发现文档、JWKS和令牌接口，令牌接口按PKCE校验code_verifier
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey // JWKS里公布的密钥
+	signer    *rsa.PrivateKey // 实际签id_token用的密钥，换成别的就是签名不对
+	lock      sync.Mutex
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims // 覆盖默认的id_token内容
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, signer: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JwksURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            m.URL,
+			"aud":            "client",
+			"sub":            "subject-1",
+			"nonce":          m.nonce,
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(m.signer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+type fakeUsers struct {
+	msq.UserData
+	users      map[uint]*model.User
+	identities []model.UserIdentity
+	sessions   int
+}
+
+func (f *fakeUsers) GetUser(account string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.Account == account {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUsers) GetUserById(userId uint) (*model.User, error) {
+	return f.users[userId], nil
+}
+
+func (f *fakeUsers) GetUsersByIds(userIds []uint) ([]model.User, error) {
+	var users []model.User
+	for _, id := range userIds {
+		if u, ok := f.users[id]; ok {
+			users = append(users, *u)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeUsers) GetUserByEmail(email string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.VerifiedEmail != nil && *u.VerifiedEmail == email {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUsers) CreateUser(account string, hash string, name string, email string) (uint, error) {
+	id := uint(len(f.users) + 1)
+	f.users[id] = &model.User{Account: account, Hash: hash, Email: email}
+	f.users[id].ID = id
+	f.users[id].UserProfile.Name = name
+	return id, nil
+}
+
+func (f *fakeUsers) VerifyEmail(userId uint, email string) (bool, error) {
+	u := f.users[userId]
+	u.EmailVerified = true
+	u.VerifiedEmail = &email
+	return true, nil
+}
+
+func (f *fakeUsers) CreateIdentity(identity *model.UserIdentity) (bool, error) {
+	for _, i := range f.identities {
+		if i.Provider == identity.Provider && i.Subject == identity.Subject {
+			return false, nil
+		}
+	}
+	identity.ID = uint(len(f.identities) + 1)
+	f.identities = append(f.identities, *identity)
+	return true, nil
+}
+
+func (f *fakeUsers) GetIdentity(provider string, subject string) (model.UserIdentity, error) {
+	for _, i := range f.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return model.UserIdentity{}, nil
+}
+
+func (f *fakeUsers) CreateSession(session *model.Session) error {
+	f.sessions++
+	session.ID = uint(f.sessions)
+	return nil
+}
+
+func (f *fakeUsers) SaveSecurityLog(model.SecurityLog) {}
+
+type fakeUserRedis struct {
+	red.UserRedis
+	tokens map[string]string
+}
+
+func (f *fakeUserRedis) SetOnceToken(purpose string, token string, value string, expiration time.Duration) error {
+	f.tokens[purpose+":"+token] = value
+	return nil
+}
+
+func (f *fakeUserRedis) ConsumeOnceToken(purpose string, token string) (string, error) {
+	value := f.tokens[purpose+":"+token]
+	delete(f.tokens, purpose+":"+token)
+	return value, nil
+}
+
+func (f *fakeUserRedis) ClearLoginFail(string) error {
+	return nil
+}
+
+type fakeModeration struct {
+	msq.ModerationData
+}
+
+func (fakeModeration) GetAllWords() ([]model.SensitiveWord, error) {
+	return nil, nil
+}
+
+type oidcEnv struct {
+	issuer *mockIssuer
+	users  *fakeUsers
+	redis  *fakeUserRedis
+}
+
+func setupOidc(t *testing.T) *oidcEnv {
+	t.Helper()
+	env := &oidcEnv{
+		issuer: newMockIssuer(t),
+		users:  &fakeUsers{users: make(map[uint]*model.User)},
+		redis:  &fakeUserRedis{tokens: make(map[string]string)},
+	}
+	oldUser, oldRedis, oldModeration, oldSearch := global.User, global.UserRedis, global.Moderation, global.Search
+	global.User, global.UserRedis, global.Moderation, global.Search = env.users, env.redis, fakeModeration{}, search.NewMemoryIndex()
+	viper.Set("oidc.providers.mock.issuer", env.issuer.URL)
+	viper.Set("oidc.providers.mock.clientId", "client")
+	viper.Set("oidc.providers.other.issuer", env.issuer.URL)
+	viper.Set("oidc.providers.other.clientId", "client")
+	resetOidcCache()
+	t.Cleanup(func() {
+		global.User, global.UserRedis, global.Moderation, global.Search = oldUser, oldRedis, oldModeration, oldSearch
+		resetOidcCache()
+	})
+	return env
+}
+
+func resetOidcCache() {
+	oidcLock.Lock()
+	oidcDiscovered = make(map[string]oidcDiscovery)
+	oidcKeySets = make(map[string]*oidcKeys)
+	oidcLock.Unlock()
+}
+
+// begin 走一遍BeginOidc，把授权地址里的PKCE challenge和nonce交给模拟的提供方，返回state
+func (env *oidcEnv) begin(t *testing.T, provider string, linkUserId uint) string {
+	t.Helper()
+	link, ok, err := BeginOidc(provider, linkUserId)
+	if err != nil || !ok {
+		t.Fatalf("BeginOidc() = %v, %v", ok, err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+		t.Fatalf("授权地址缺少参数: %s", link)
+	}
+	env.issuer.lock.Lock()
+	env.issuer.challenge = q.Get("code_challenge")
+	env.issuer.nonce = q.Get("nonce")
+	env.issuer.lock.Unlock()
+	return q.Get("state")
+}
+
+func (env *oidcEnv) complete(state string) (OidcResult, error, bool) {
+	return CompleteOidc("mock", "good-code", state, "127.0.0.1", "test", "")
+}
+
+func TestOidcProvisionsNewAccount(t *testing.T) {
+	env := setupOidc(t)
+	result, err, ok := env.complete(env.begin(t, "mock", 0))
+	if err != nil || !ok || result.Token == "" {
+		t.Fatalf("CompleteOidc() = %+v, %v, %v", result, err, ok)
+	}
+	if len(env.users.users) != 1 || len(env.users.identities) != 1 {
+		t.Fatalf("users = %d, identities = %d, want 1, 1", len(env.users.users), len(env.users.identities))
+	}
+	u := env.users.users[1]
+	if u.Hash != "" || u.Email != "alice@example.com" || !u.EmailVerified || u.UserProfile.Name != "Alice" {
+		t.Errorf("provisioned user = %+v", u)
+	}
+	// 同一个身份再登录一次，直接登进已有账号
+	result, err, ok = env.complete(env.begin(t, "mock", 0))
+	if err != nil || !ok || result.Token == "" || len(env.users.users) != 1 {
+		t.Fatalf("second login = %+v, %v, %v, users = %d", result, err, ok, len(env.users.users))
+	}
+}
+
+func TestOidcDoesNotMergeByEmail(t *testing.T) {
+	env := setupOidc(t)
+	id, _ := env.users.CreateUser("alice", "hash", "Alice", "alice@example.com")
+	_, _ = env.users.VerifyEmail(id, "alice@example.com")
+	_, err, ok := env.complete(env.begin(t, "mock", 0))
+	if err != nil || !ok {
+		t.Fatalf("CompleteOidc() = %v, %v", err, ok)
+	}
+	if len(env.users.users) != 2 {
+		t.Fatalf("users = %d, want 2", len(env.users.users))
+	}
+	if u := env.users.users[2]; u.Email != "" || u.EmailVerified {
+		t.Errorf("邮箱已被别的账号验证过，新账号不应带上邮箱: %+v", u)
+	}
+	if env.users.identities[0].UserID != 2 {
+		t.Errorf("identity bound to user %d, want 2", env.users.identities[0].UserID)
+	}
+}
+
+func TestOidcLinksExistingAccount(t *testing.T) {
+	env := setupOidc(t)
+	id, _ := env.users.CreateUser("alice", "hash", "Alice", "alice@example.com")
+	_, _ = env.users.VerifyEmail(id, "alice@example.com")
+	result, err, ok := env.complete(env.begin(t, "mock", id))
+	if err != nil || !ok || !result.Linked || result.Token != "" {
+		t.Fatalf("CompleteOidc() = %+v, %v, %v", result, err, ok)
+	}
+	if len(env.users.users) != 1 || len(env.users.identities) != 1 || env.users.identities[0].UserID != id {
+		t.Fatalf("users = %d, identities = %+v", len(env.users.users), env.users.identities)
+	}
+	// 绑定后用第三方登录进的是原账号
+	result, err, ok = env.complete(env.begin(t, "mock", 0))
+	if err != nil || !ok || result.Token == "" || len(env.users.users) != 1 {
+		t.Fatalf("login after link = %+v, %v, %v, users = %d", result, err, ok, len(env.users.users))
+	}
+}
+
+func TestOidcRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, env *oidcEnv) string
+	}{
+		{
+			name: "PKCE校验码对不上",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				state := env.begin(t, "mock", 0)
+				env.issuer.challenge = "not-the-challenge"
+				return state
+			},
+		},
+		{
+			name: "nonce不一致",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				state := env.begin(t, "mock", 0)
+				env.issuer.claims = jwt.MapClaims{"nonce": "replayed"}
+				return state
+			},
+		},
+		{
+			name: "audience不对",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				state := env.begin(t, "mock", 0)
+				env.issuer.claims = jwt.MapClaims{"aud": "someone-else"}
+				return state
+			},
+		},
+		{
+			name: "签名不对",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				rogue, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				state := env.begin(t, "mock", 0)
+				env.issuer.signer = rogue
+				return state
+			},
+		},
+		{
+			name: "伪造的state",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				env.begin(t, "mock", 0)
+				return "forged.state"
+			},
+		},
+		{
+			name: "state属于另一个提供方",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				return env.begin(t, "other", 0)
+			},
+		},
+		{
+			name: "state只能用一次",
+			setup: func(t *testing.T, env *oidcEnv) string {
+				state := env.begin(t, "mock", 0)
+				if _, _, ok := env.complete(state); !ok {
+					t.Fatal("first use should succeed")
+				}
+				env.users.users = make(map[uint]*model.User)
+				env.users.identities = nil
+				return state
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupOidc(t)
+			state := tt.setup(t, env)
+			result, err, ok := env.complete(state)
+			if ok || result.Token != "" || result.Linked {
+				t.Fatalf("CompleteOidc() = %+v, %v, %v, want rejected", result, err, ok)
+			}
+			if len(env.users.users) != 0 || len(env.users.identities) != 0 {
+				t.Errorf("rejected login must not create accounts: users = %d, identities = %d", len(env.users.users), len(env.users.identities))
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/utils"
+	"commmunity/app/zlog"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// CreateSession 登录成功后建立服务端会话并签发第一对令牌
+func CreateSession(account string, ip string, userAgent string, device string) (string, string, error) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return "", "", err
+	}
+	if device == "" {
+		device = "未知设备"
+	}
+	jti := uuid.New().String()
+	session := model.Session{
+		UserID:     user.ID,
+		Device:     device,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CurrentJTI: jti,
+		LastUsedAt: time.Now(),
+	}
+	if err = global.User.CreateSession(&session); err != nil {
+		return "", "", err
+	}
+	return utils.MakeToken(account, user.ID, user.Role, user.RoleVersion, session.ID, jti)
+}
+
+// RefreshSession 每次刷新都轮换refresh token，已经轮换过的旧令牌再次出现说明被盗用，直接注销整个会话
+func RefreshSession(refreshToken string, ip string, userAgent string) (string, string, error, bool) {
+	claims, err := utils.ParseRefreshToken(refreshToken)
+	if err != nil || claims.SessionId == 0 {
+		return "", "", nil, false
+	}
+	session, err := global.User.GetSession(claims.SessionId)
+	if err != nil {
+		return "", "", err, false
+	}
+	if session.ID == 0 || session.RevokedAt != nil || session.UserID != claims.UserId {
+		return "", "", nil, false
+	}
+	if session.CurrentJTI != claims.Id {
+		zlog.Warn("检测到refresh token重放，注销会话", zap.Uint("sessionId", session.ID), zap.String("ip", ip))
+		global.User.SaveSecurityLog(model.SecurityLog{
+			Account:   claims.Account,
+			IP:        ip,
+			UserAgent: userAgent,
+			Event:     model.EventTokenReuse,
+			Detail:    fmt.Sprintf("会话%d的旧refresh token被再次使用", session.ID),
+		})
+		return "", "", revokeSession(session.ID), false
+	}
+	role, roleVersion, err := global.User.GetRoleVersion(claims.UserId)
+	if err != nil {
+		return "", "", err, false
+	}
+	newJti := uuid.New().String()
+	flag, err := global.User.RotateSession(session.ID, claims.Id, newJti, ip)
+	if err != nil {
+		return "", "", err, false
+	}
+	if !flag {
+		return "", "", nil, false
+	}
+	token, newRefreshToken, err := utils.MakeToken(claims.Account, claims.UserId, role, roleVersion, session.ID, newJti)
+	if err != nil {
+		return "", "", err, false
+	}
+	return token, newRefreshToken, nil, true
+}
+
+func IsSessionValid(sessionId uint) bool {
+	if sessionId == 0 {
+		return true
+	}
+	return !global.UserRedis.IsSessionRevoked(sessionId)
+}
+
+// 数据库里标记注销后，再在redis里记一笔，让还没过期的access token也立即失效
+func revokeSession(sessionId uint) error {
+	if err := global.User.RevokeSession(sessionId); err != nil {
+		return err
+	}
+	return global.UserRedis.RevokeSession(sessionId, accessTokenTTL)
+}
+
+func LogoutEverywhere(userId uint) error {
+	ids, err := global.User.RevokeUserSessions(userId)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err = global.UserRedis.RevokeSession(id, accessTokenTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SessionDTO struct {
+	ID         uint   `json:"id"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	Current    bool   `json:"current"`
+}
+
+func GetSessions(userId uint, currentSessionId uint) ([]SessionDTO, error) {
+	sessions, err := global.User.GetActiveSessions(userId, time.Now().Add(-refreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SessionDTO, 0, len(sessions))
+	for _, s := range sessions {
+		results = append(results, SessionDTO{
+			ID:         s.ID,
+			Device:     s.Device,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt.Format("2006-01-02 15:04:05"),
+			LastUsedAt: s.LastUsedAt.Format("2006-01-02 15:04:05"),
+			Current:    s.ID == currentSessionId,
+		})
+	}
+	return results, nil
+}
+
+func DeleteSession(userId uint, sessionId uint) (error, bool) {
+	session, err := global.User.GetSession(sessionId)
+	if err != nil {
+		return err, false
+	}
+	if session.ID == 0 || session.UserID != userId {
+		return nil, false
+	}
+	return revokeSession(sessionId), true
+}
@@ -0,0 +1,116 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxAccessTokens = 20
+
+// AccessIdentity 个人访问令牌验证通过后得到的身份
+type AccessIdentity struct {
+	TokenID uint
+	UserID  uint
+	Account string
+	Role    int
+	Scopes  []string
+}
+
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := make(map[string]bool)
+	list := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		valid := false
+		for _, known := range model.AllScopes {
+			if s == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	return list, len(list) > 0
+}
+
+// CreateAccessToken 返回的明文令牌只出现这一次
+func CreateAccessToken(userId uint, req model.AccessTokenRequest) (string, model.AccessToken, bool, error) {
+	name := strings.TrimSpace(req.Name)
+	if n := utf8.RuneCountInString(name); n == 0 || n > 50 || req.ExpireDay < 0 || req.ExpireDay > 366 {
+		return "", model.AccessToken{}, false, nil
+	}
+	scopes, ok := normalizeScopes(req.Scopes)
+	if !ok {
+		return "", model.AccessToken{}, false, nil
+	}
+	count, err := global.User.CountAccessTokens(userId)
+	if err != nil {
+		return "", model.AccessToken{}, false, err
+	}
+	if count >= maxAccessTokens {
+		return "", model.AccessToken{}, false, nil
+	}
+	plain, err := utils.MakeAccessToken()
+	if err != nil {
+		return "", model.AccessToken{}, false, err
+	}
+	token := model.AccessToken{
+		UserID: userId,
+		Name:   name,
+		Prefix: plain[:10],
+		Hash:   utils.HashAccessToken(plain),
+		Scopes: strings.Join(scopes, ","),
+	}
+	if req.ExpireDay > 0 {
+		expireAt := time.Now().AddDate(0, 0, req.ExpireDay)
+		token.ExpireAt = &expireAt
+	}
+	if err = global.User.CreateAccessToken(&token); err != nil {
+		return "", model.AccessToken{}, false, err
+	}
+	return plain, token, true, nil
+}
+
+func GetAccessTokens(userId uint) ([]model.AccessToken, error) {
+	return global.User.GetAccessTokens(userId)
+}
+
+func RevokeAccessToken(userId uint, tokenId uint) (bool, error) {
+	return global.User.RevokeAccessToken(userId, tokenId)
+}
+
+// VerifyAccessToken 令牌不存在、已撤销、已过期或用户已注销都视为无效
+func VerifyAccessToken(plain string) (AccessIdentity, bool, error) {
+	if !strings.HasPrefix(plain, "pat_") {
+		return AccessIdentity{}, false, nil
+	}
+	token, err := global.User.GetAccessTokenByHash(utils.HashAccessToken(plain))
+	if err != nil {
+		return AccessIdentity{}, false, err
+	}
+	now := time.Now()
+	if token.ID == 0 || token.RevokedAt != nil || (token.ExpireAt != nil && token.ExpireAt.Before(now)) {
+		return AccessIdentity{}, false, nil
+	}
+	if token.User.ID == 0 || token.User.Anonymized {
+		return AccessIdentity{}, false, nil
+	}
+	_ = global.User.TouchAccessToken(token.ID, now)
+	return AccessIdentity{
+		TokenID: token.ID,
+		UserID:  token.UserID,
+		Account: token.User.Account,
+		Role:    token.User.Role,
+		Scopes:  strings.Split(token.Scopes, ","),
+	}, true, nil
+}
@@ -0,0 +1,164 @@
+package login
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/utils"
+	"commmunity/app/zlog"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	mfaPurpose        = "mfa-pending"
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+	totpIssuer        = "a-easy-community"
+)
+
+// EnrollTotp 生成密钥但暂不开启，用户用验证器扫码并回填验证码后才真正生效
+func EnrollTotp(account string) (string, string, error, bool) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return "", "", err, false
+	}
+	if user.TotpEnabled {
+		return "", "", nil, false
+	}
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		zlog.Error("生成两步验证密钥失败", zap.Error(err))
+		return "", "", err, false
+	}
+	if err = global.User.SetTotpSecret(user.ID, secret); err != nil {
+		return "", "", err, false
+	}
+	return secret, utils.TotpURI(totpIssuer, account, secret), nil, true
+}
+
+// ConfirmTotp 验证通过后开启两步验证，恢复码明文只在这里返回一次
+func ConfirmTotp(account string, code string) ([]string, error, bool) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return nil, err, false
+	}
+	if user.TotpEnabled || user.TotpSecret == "" {
+		return nil, nil, false
+	}
+	step, ok := utils.MatchTotp(user.TotpSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, nil, false
+	}
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		zlog.Error("生成恢复码失败", zap.Error(err))
+		return nil, err, false
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(c), bcrypt.DefaultCost)
+		if err != nil {
+			zlog.Error("恢复码哈希失败", zap.Error(err))
+			return nil, err, false
+		}
+		hashes = append(hashes, string(hash))
+	}
+	if err = global.User.EnableTotp(user.ID, hashes); err != nil {
+		return nil, err, false
+	}
+	//开启时用过的验证码不能再拿去登录
+	if _, err = global.User.UseTotpStep(user.ID, step); err != nil {
+		zlog.Warn("记录验证码时间步失败", zap.Uint("userId", user.ID))
+	}
+	return codes, nil, true
+}
+
+func DisableTotp(account string, code string) (error, bool) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return err, false
+	}
+	if !user.TotpEnabled {
+		return nil, false
+	}
+	flag, err := checkSecondFactor(user.ID, user.TotpSecret, code)
+	if err != nil || !flag {
+		return err, false
+	}
+	return global.User.DisableTotp(user.ID), true
+}
+
+// 验证码或者恢复码任意一个通过即可，恢复码用过即作废，验证码的时间步不能回退，防止被截获后重放
+func checkSecondFactor(userId uint, secret string, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := utils.MatchTotp(secret, code, time.Now()); ok {
+		return global.User.UseTotpStep(userId, step)
+	}
+	codes, err := global.User.GetRecoveryCodes(userId)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(c.Hash), []byte(strings.ToLower(code))) == nil {
+			return global.User.UseRecoveryCode(c.ID)
+		}
+	}
+	return false, nil
+}
+
+// BeginMfa 密码验证通过后，开启了两步验证的账号先拿到一个短期的待验证令牌
+func BeginMfa(account string) (string, bool, error) {
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return "", false, err
+	}
+	if !user.TotpEnabled {
+		return "", false, nil
+	}
+	token, err := utils.MakeOnceToken(mfaPurpose)
+	if err != nil {
+		return "", false, err
+	}
+	if err = global.UserRedis.SetOnceToken(mfaPurpose, token, account, mfaTokenTTL); err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+func CompleteMfa(mfaToken string, code string, ip string, userAgent string, device string) (string, string, time.Duration, error, bool) {
+	if !utils.VerifyOnceToken(mfaPurpose, mfaToken) {
+		return "", "", 0, nil, false
+	}
+	account, err := global.UserRedis.GetOnceToken(mfaPurpose, mfaToken)
+	if err != nil || account == "" {
+		return "", "", 0, err, false
+	}
+	ttl, err := LoginLockTTL(account, ip)
+	if err != nil || ttl > 0 {
+		return "", "", ttl, err, false
+	}
+	user, err := global.User.GetUser(account)
+	if user == nil || err != nil {
+		return "", "", 0, err, false
+	}
+	flag, err := checkSecondFactor(user.ID, user.TotpSecret, code)
+	if err != nil {
+		return "", "", 0, err, false
+	}
+	if !flag {
+		recordLoginFail(account, ip, userAgent)
+		return "", "", 0, nil, false
+	}
+	value, err := global.UserRedis.ConsumeOnceToken(mfaPurpose, mfaToken)
+	if err != nil || value == "" {
+		return "", "", 0, err, false
+	}
+	recordLoginSuccess(account, ip, userAgent)
+	token, refreshToken, err := CreateSession(account, ip, userAgent, device)
+	if err != nil {
+		return "", "", 0, err, false
+	}
+	return token, refreshToken, 0, nil, true
+}
@@ -0,0 +1,127 @@
+package meter
+
+import (
+	"commmunity/app/internal/ai"
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/rbac"
+	"errors"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 额度档位，对应配置ai.quota.<tier>.daily和ai.quota.<tier>.monthly，-1表示不限
+const (
+	TierTrial = "trial" // 普通用户的免费试用
+	TierVip   = "vip"
+	TierAdmin = "admin"
+)
+
+var ErrQuotaExceeded = errors.New("AI使用次数已用完")
+
+// Quota Remaining为-1表示不限
+type Quota struct {
+	Tier             string `json:"tier"`
+	DailyLimit       int    `json:"daily_limit"`
+	DailyRemaining   int    `json:"daily_remaining"`
+	MonthlyLimit     int    `json:"monthly_limit"`
+	MonthlyRemaining int    `json:"monthly_remaining"`
+}
+
+// TierOf admin档位看角色有没有ai.unlimited权限，改角色权限就能调整，不写死在角色上
+func TierOf(user model.User) string {
+	if rbac.HasPermission(user.Role, model.PermAIUnlimited) {
+		return TierAdmin
+	}
+	if user.Vip {
+		return TierVip
+	}
+	return TierTrial
+}
+
+func remaining(limit int, used int64) int {
+	if limit < 0 {
+		return -1
+	}
+	return max(limit-int(used), 0)
+}
+
+func quotaOf(tier string, daily int64, monthly int64) Quota {
+	dailyLimit := viper.GetInt("ai.quota." + tier + ".daily")
+	monthlyLimit := viper.GetInt("ai.quota." + tier + ".monthly")
+	return Quota{
+		Tier:             tier,
+		DailyLimit:       dailyLimit,
+		DailyRemaining:   remaining(dailyLimit, daily),
+		MonthlyLimit:     monthlyLimit,
+		MonthlyRemaining: remaining(monthlyLimit, monthly),
+	}
+}
+
+// Exhausted 不占额度，只看还有没有剩
+func (q Quota) Exhausted() bool {
+	return q.DailyRemaining == 0 || q.MonthlyRemaining == 0
+}
+
+func Remaining(user model.User) (Quota, error) {
+	daily, monthly, err := global.Quota.GetQuotaUsed(user.ID, time.Now())
+	if err != nil {
+		return Quota{}, err
+	}
+	return quotaOf(TierOf(user), daily, monthly), nil
+}
+
+func RemainingOf(account string) (Quota, error) {
+	user, err := global.User.GetUserId(account)
+	if err != nil {
+		return Quota{}, err
+	}
+	return Remaining(user)
+}
+
+// Reserve 发起调用前先占一次额度，用完了返回ErrQuotaExceeded；调用失败要Refund
+func Reserve(user model.User) (Quota, error) {
+	tier := TierOf(user)
+	q := quotaOf(tier, 0, 0)
+	daily, monthly, ok, err := global.Quota.ReserveQuota(user.ID, time.Now(), q.DailyLimit, q.MonthlyLimit)
+	if err != nil {
+		return Quota{}, err
+	}
+	q = quotaOf(tier, daily, monthly)
+	if !ok {
+		return q, ErrQuotaExceeded
+	}
+	return q, nil
+}
+
+// Refund 跨天、跨月的边界情况不处理，最多少算一次
+func Refund(userId uint) {
+	_ = global.Quota.RefundQuota(userId, time.Now())
+}
+
+// Cost 按ai.pricing.input/output（元/千token）估算
+func Cost(usage ai.Usage) float64 {
+	return (float64(usage.PromptTokens)*viper.GetFloat64("ai.pricing.input") +
+		float64(usage.CompletionTokens)*viper.GetFloat64("ai.pricing.output")) / 1000
+}
+
+// Record 记录一次调用，写库失败只影响报表
+func Record(userId uint, feature string, provider string, resp ai.Response, callErr error) {
+	_ = global.Usage.SaveUsage(&model.AIUsage{
+		UserID:           userId,
+		Feature:          feature,
+		Provider:         provider,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		Estimated:        resp.Usage.Estimated,
+		LatencyMs:        resp.Latency.Milliseconds(),
+		Cost:             Cost(resp.Usage),
+		Success:          callErr == nil,
+	})
+}
+
+func Report(query model.UsageQuery) ([]model.UsageStat, error) {
+	return global.Usage.UsageReport(query, 100)
+}
@@ -0,0 +1,110 @@
+package meter
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/model"
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	old := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, old) })
+}
+
+func TestQuotaOf(t *testing.T) {
+	setConfig(t, "ai.quota.trial.daily", 3)
+	setConfig(t, "ai.quota.trial.monthly", 10)
+	setConfig(t, "ai.quota.vip.daily", 50)
+	setConfig(t, "ai.quota.vip.monthly", -1)
+	setConfig(t, "ai.quota.admin.daily", -1)
+	setConfig(t, "ai.quota.admin.monthly", -1)
+	tests := []struct {
+		name      string
+		tier      string
+		daily     int64
+		monthly   int64
+		want      Quota
+		exhausted bool
+	}{
+		{
+			name: "还没用过",
+			tier: TierTrial,
+			want: Quota{Tier: TierTrial, DailyLimit: 3, DailyRemaining: 3, MonthlyLimit: 10, MonthlyRemaining: 10},
+		},
+		{
+			name: "用了一部分", tier: TierTrial, daily: 2, monthly: 7,
+			want: Quota{Tier: TierTrial, DailyLimit: 3, DailyRemaining: 1, MonthlyLimit: 10, MonthlyRemaining: 3},
+		},
+		{
+			name: "当天用完", tier: TierTrial, daily: 3, monthly: 5,
+			want:      Quota{Tier: TierTrial, DailyLimit: 3, DailyRemaining: 0, MonthlyLimit: 10, MonthlyRemaining: 5},
+			exhausted: true,
+		},
+		{
+			name: "当月用完，当天还有", tier: TierTrial, daily: 1, monthly: 10,
+			want:      Quota{Tier: TierTrial, DailyLimit: 3, DailyRemaining: 2, MonthlyLimit: 10, MonthlyRemaining: 0},
+			exhausted: true,
+		},
+		{
+			name: "超用了剩余按0算", tier: TierTrial, daily: 5, monthly: 12,
+			want:      Quota{Tier: TierTrial, DailyLimit: 3, DailyRemaining: 0, MonthlyLimit: 10, MonthlyRemaining: 0},
+			exhausted: true,
+		},
+		{
+			name: "月度不限", tier: TierVip, daily: 10, monthly: 1000,
+			want: Quota{Tier: TierVip, DailyLimit: 50, DailyRemaining: 40, MonthlyLimit: -1, MonthlyRemaining: -1},
+		},
+		{
+			name: "全部不限", tier: TierAdmin, daily: 1000, monthly: 100000,
+			want: Quota{Tier: TierAdmin, DailyLimit: -1, DailyRemaining: -1, MonthlyLimit: -1, MonthlyRemaining: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quotaOf(tt.tier, tt.daily, tt.monthly)
+			if got != tt.want {
+				t.Errorf("quotaOf = %+v, want %+v", got, tt.want)
+			}
+			if got.Exhausted() != tt.exhausted {
+				t.Errorf("Exhausted = %v, want %v", got.Exhausted(), tt.exhausted)
+			}
+		})
+	}
+}
+
+type fakeUsers struct {
+	msq.UserData
+}
+
+// GetRoles 读不到权限矩阵时rbac按默认权限判断
+func (fakeUsers) GetRoles() ([]model.Role, error) {
+	return nil, errors.New("no roles in tests")
+}
+
+// 默认只有管理员和超级管理员有ai.unlimited
+func TestTierOf(t *testing.T) {
+	oldUser := global.User
+	global.User = fakeUsers{}
+	t.Cleanup(func() { global.User = oldUser })
+	tests := []struct {
+		user model.User
+		want string
+	}{
+		{user: model.User{}, want: TierTrial},
+		{user: model.User{Vip: true}, want: TierVip},
+		{user: model.User{Role: model.RoleModerator}, want: TierTrial},
+		{user: model.User{Role: model.RoleAdmin}, want: TierAdmin},
+		{user: model.User{Role: model.RoleSuperAdmin, Vip: true}, want: TierAdmin},
+	}
+	for _, tt := range tests {
+		if got := TierOf(tt.user); got != tt.want {
+			t.Errorf("TierOf(role=%d, vip=%v) = %q, want %q", tt.user.Role, tt.user.Vip, got, tt.want)
+		}
+	}
+}
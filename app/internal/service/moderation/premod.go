@@ -0,0 +1,83 @@
+package moderation
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/audit"
+	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/ws"
+	"fmt"
+	"time"
+)
+
+type PendingPostDTO struct {
+	PostID    uint   `json:"post_id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	UserId    uint   `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+func GetPendingPosts(role int, offset int, limit int) ([]PendingPostDTO, bool, error) {
+	if !rbac.HasPermission(role, model.PermPostReview) {
+		return nil, false, nil
+	}
+	posts, err := global.Post.GetPendingPosts(offset, limit)
+	if err != nil {
+		return nil, true, err
+	}
+	dtos := make([]PendingPostDTO, 0, len(posts))
+	for _, p := range posts {
+		dtos = append(dtos, PendingPostDTO{
+			PostID:    p.ID,
+			Title:     p.Title,
+			Content:   p.Content,
+			UserId:    p.UserID,
+			Name:      p.User.UserProfile.Name,
+			CreatedAt: p.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return dtos, true, nil
+}
+
+func ReviewPost(actor audit.Actor, role int, postId uint, approve bool, reason string) (error, bool, bool) { //第一个bool判断是否有权限，第二个bool判断帖子是否待审核
+	if !rbac.HasPermission(role, model.PermPostReview) {
+		return nil, false, false
+	}
+	post, err := global.Post.GetPostDetail(postId)
+	if err != nil {
+		return err, true, false
+	}
+	status := model.PostPublished
+	if !approve {
+		status = model.PostRejected
+	}
+	ok, err := global.Post.ReviewPost(postId, status)
+	if err != nil || !ok {
+		return err, true, false
+	}
+	if err = global.PostRedis.DelPostCache(postId); err != nil {
+		return err, true, false
+	}
+	if approve {
+		hot.Track(postId, time.Now())
+		feed.Publish(post.UserID, postId)
+		indexer.Post(postId)
+		_ = global.PostRedis.DelPostListCache()
+	}
+	audit.Record(actor, model.AuditPostReview, "post", postId,
+		map[string]interface{}{"status": model.PostPendingReview}, map[string]interface{}{"status": status, "reason": reason})
+	content := fmt.Sprintf("你的帖子《%s》已通过审核", post.Title)
+	if !approve {
+		content = fmt.Sprintf("你的帖子《%s》未通过审核", post.Title)
+		if reason != "" {
+			content += "，原因：" + reason
+		}
+	}
+	ws.SendNotice(post.UserID, model.NoticeSystem, actor.UserID, postId, content)
+	return nil, true, true
+}
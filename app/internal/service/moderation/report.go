@@ -0,0 +1,253 @@
+package moderation
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/audit"
+	"commmunity/app/internal/service/controller"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/service/sanction"
+	"commmunity/app/internal/ws"
+	"commmunity/app/zlog"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var targetNames = map[int]string{
+	model.ReportPost:    "帖子",
+	model.ReportComment: "评论",
+	model.ReportUser:    "用户",
+	model.ReportMessage: "私信",
+}
+
+// findAuthor 找到被举报内容的作者，内容不存在返回0
+func findAuthor(reporterId uint, targetType int, targetId uint) (uint, error) {
+	switch targetType {
+	case model.ReportPost:
+		post, err := global.Post.GetPostDetail(targetId)
+		if err != nil {
+			return 0, err
+		}
+		return post.UserID, nil
+	case model.ReportComment:
+		comment, err := global.Post.GetCommentDetail(targetId)
+		if err != nil {
+			return 0, err
+		}
+		return comment.UserID, nil
+	case model.ReportUser:
+		user, err := global.Post.GetUserProfile(targetId)
+		if err != nil {
+			return 0, err
+		}
+		return user.ID, nil
+	case model.ReportMessage:
+		message, err := global.Message.GetMessage(targetId)
+		if err != nil {
+			return 0, err
+		}
+		//只有私信的双方能举报
+		if message.FromUserID != reporterId && message.ToUserID != reporterId {
+			return 0, nil
+		}
+		return message.FromUserID, nil
+	}
+	return 0, nil
+}
+
+// hide 隐藏或恢复内容，并清理帖子缓存；已经是目标状态时直接返回false
+func hide(targetType int, targetId uint, hidden bool) (bool, error) {
+	changed, err := global.Moderation.SetHidden(targetType, targetId, hidden)
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, clearHidden(targetType, targetId, hidden)
+}
+
+func clearHidden(targetType int, targetId uint, hidden bool) error {
+	switch targetType {
+	case model.ReportPost:
+		if hidden {
+			hot.Remove(targetId)
+		}
+		indexer.Post(targetId)
+		_ = global.PostRedis.DelPostListCache()
+		return global.PostRedis.DelPostCache(targetId)
+	case model.ReportComment:
+		indexer.Comment(targetId)
+		comment, err := global.Post.GetCommentDetail(targetId)
+		if err != nil {
+			return err
+		}
+		return global.PostRedis.DelPostCache(comment.PostID)
+	case model.ReportMessage:
+		message, err := global.Message.GetMessage(targetId)
+		if err != nil {
+			return err
+		}
+		return clearMessage(message)
+	}
+	return nil
+}
+
+// clearMessage 私信被隐藏或删除后，双方缓存的历史消息里都不能再出现
+func clearMessage(message model.Message) error {
+	if message.ID == 0 {
+		return nil
+	}
+	return global.MessageRedis.DelMessageCache(message.FromUserID, message.ToUserID)
+}
+
+func deleteMessage(messageId uint) error {
+	message, err := global.Message.GetMessage(messageId)
+	if err != nil {
+		return err
+	}
+	if err = global.Message.DeleteMessage(messageId); err != nil {
+		return err
+	}
+	return clearMessage(message)
+}
+
+func Report(reporterId uint, targetType int, targetId uint, reason int, detail string) (error, bool) {
+	if _, ok := targetNames[targetType]; !ok || reason < model.ReasonSpam || reason > model.ReasonOther {
+		return nil, false
+	}
+	if utf8.RuneCountInString(detail) > 500 {
+		return nil, false
+	}
+	authorId, err := findAuthor(reporterId, targetType, targetId)
+	if err != nil {
+		return err, false
+	}
+	if authorId == 0 || authorId == reporterId {
+		return nil, false
+	}
+	report := model.Report{
+		ReporterID: reporterId,
+		TargetType: targetType,
+		TargetID:   targetId,
+		AuthorID:   authorId,
+		Reason:     reason,
+		Detail:     detail,
+	}
+	created, err := global.Moderation.CreateReport(&report)
+	if err != nil {
+		return err, false
+	}
+	//重复举报不计数，直接返回成功
+	if !created {
+		return nil, true
+	}
+	count, err := global.Moderation.CountPendingReports(targetType, targetId)
+	if err != nil {
+		return err, false
+	}
+	//达到阈值后每次新举报都会再检查一遍，已经隐藏的不会重复处理
+	if count >= int64(viper.GetInt("moderation.hideThreshold")) {
+		hidden, err := hide(targetType, targetId, true)
+		if err != nil {
+			return err, false
+		}
+		if hidden {
+			zlog.Info("内容被举报过多，已自动隐藏", zap.Int("type", targetType), zap.Uint("id", targetId))
+		}
+	}
+	return nil, true
+}
+
+func GetQueue(role int, offset int, limit int) ([]model.ReportGroup, bool, error) {
+	if !rbac.HasPermission(role, model.PermReportReview) {
+		return nil, false, nil
+	}
+	groups, err := global.Moderation.GetReportQueue(offset, limit)
+	if err != nil {
+		return nil, true, err
+	}
+	return groups, true, nil
+}
+
+func GetReports(role int, targetType int, targetId uint) ([]model.Report, bool, error) {
+	if !rbac.HasPermission(role, model.PermReportReview) {
+		return nil, false, nil
+	}
+	reports, err := global.Moderation.GetTargetReports(targetType, targetId)
+	if err != nil {
+		return nil, true, err
+	}
+	return reports, true, nil
+}
+
+func Handle(actor audit.Actor, account string, role int, targetType int, targetId uint, req model.ReportActionRequest) (error, bool, bool) { //第一个bool判断是否有权限，第二个bool判断操作是否有效
+	if !rbac.HasPermission(role, model.PermReportReview) {
+		return nil, false, false
+	}
+	reports, err := global.Moderation.GetTargetReports(targetType, targetId)
+	if err != nil {
+		return err, true, false
+	}
+	if len(reports) == 0 {
+		return nil, true, false
+	}
+	status := model.ReportResolved
+	switch req.Action {
+	case model.ReportActionDismiss:
+		status = model.ReportDismissed
+		if _, err = hide(targetType, targetId, false); err != nil {
+			return err, true, false
+		}
+	case model.ReportActionDelete:
+		var flag bool
+		switch targetType {
+		case model.ReportPost:
+			err, flag = controller.DeletePost(account, targetId, role, actor)
+		case model.ReportComment:
+			err, flag = controller.DeleteComment(account, targetId, role, actor)
+		case model.ReportMessage:
+			err, flag = deleteMessage(targetId), true
+		default:
+			return nil, true, false
+		}
+		if err != nil {
+			return err, true, false
+		}
+		if !flag {
+			return nil, false, false
+		}
+	case model.ReportActionSanction:
+		authorId := reports[0].AuthorID
+		before, err := sanction.GetActive(authorId)
+		if err != nil {
+			return err, true, false
+		}
+		err, flag1, flag2 := sanction.Issue(actor.UserID, role, authorId, req.Type, req.Reason, time.Duration(req.Duration)*time.Minute)
+		if err != nil || !flag1 || !flag2 {
+			return err, flag1, false
+		}
+		after, _ := sanction.GetActive(authorId)
+		audit.Record(actor, model.AuditSanctionIssue, "user", authorId, before, after)
+	default:
+		return nil, true, false
+	}
+	if _, err = global.Moderation.ResolveReports(targetType, targetId, status, actor.UserID); err != nil {
+		return err, true, false
+	}
+	audit.Record(actor, model.AuditReportHandle, targetNames[targetType], targetId, nil, req)
+	result := "已处理"
+	if status == model.ReportDismissed {
+		result = "经审核未违规"
+	}
+	for _, r := range reports {
+		if r.ReporterID == 0 { //敏感词自动送审
+			continue
+		}
+		ws.SendNotice(r.ReporterID, model.NoticeSystem, 0, 0, fmt.Sprintf("你举报的%s%s，感谢你的反馈", targetNames[targetType], result))
+	}
+	return nil, true, true
+}
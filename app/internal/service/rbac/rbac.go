@@ -0,0 +1,158 @@
+package rbac
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/zlog"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const reloadInterval = time.Minute
+
+var (
+	lock        sync.RWMutex
+	permissions map[int]map[string]bool
+	loadedAt    time.Time
+)
+
+// 权限矩阵放在内存里，每分钟从数据库重新加载一次
+func load() error {
+	roles, err := global.User.GetRoles()
+	if err != nil {
+		return err
+	}
+	m := make(map[int]map[string]bool, len(roles))
+	for _, r := range roles {
+		m[r.ID] = make(map[string]bool, len(r.Permissions))
+		for _, p := range r.Permissions {
+			m[r.ID][p.Permission] = true
+		}
+	}
+	lock.Lock()
+	permissions = m
+	loadedAt = time.Now()
+	lock.Unlock()
+	return nil
+}
+
+func HasPermission(role int, permission string) bool {
+	lock.RLock()
+	stale := permissions == nil || time.Since(loadedAt) > reloadInterval
+	lock.RUnlock()
+	if stale {
+		if err := load(); err != nil {
+			zlog.Error("加载权限矩阵失败", zap.Error(err))
+		}
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	if permissions == nil {
+		return slices.Contains(model.DefaultRolePermissions[role], permission)
+	}
+	return permissions[role][permission]
+}
+
+// CurrentRole 以数据库里的角色为准，token里的角色版本落后说明角色已经变更过
+func CurrentRole(userId uint, tokenVersion int) (int, bool, error) {
+	role, version, ok, err := global.UserRedis.GetRoleCache(userId)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		role, version, err = global.User.GetRoleVersion(userId)
+		if err != nil {
+			return 0, false, err
+		}
+		_ = global.UserRedis.SetRoleCache(userId, role, version)
+	}
+	return role, version == tokenVersion, nil
+}
+
+func AssignRole(operatorRole int, userId uint, role int) (bool, bool, error) { //第一个bool判断是否有权限，第二个bool判断角色是否存在
+	if !HasPermission(operatorRole, model.PermRoleAssign) {
+		return false, false, nil
+	}
+	if _, ok := model.RoleNames[role]; !ok {
+		return true, false, nil
+	}
+	if err := global.User.SetUserRole(userId, role); err != nil {
+		return true, true, err
+	}
+	if err := global.UserRedis.DelRoleCache(userId); err != nil {
+		return true, true, err
+	}
+	return true, true, global.UserRedis.DelUserCache(userId)
+}
+
+// Outranks 操作者的角色要严格高于目标，同级之间也不能互相处理
+func Outranks(operatorRole int, targetRole int) bool {
+	return model.RoleRanks[operatorRole] > model.RoleRanks[targetRole]
+}
+
+// RoleOf 审计用，取用户当前的角色
+func RoleOf(userId uint) (int, error) {
+	role, _, err := global.User.GetRoleVersion(userId)
+	return role, err
+}
+
+// RolePermissions 审计用，取角色当前在数据库里的权限
+func RolePermissions(roleId int) ([]string, error) {
+	roles, err := GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		if r.ID == roleId {
+			return r.Permissions, nil
+		}
+	}
+	return nil, nil
+}
+
+type RoleDTO struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+func GetRoles() ([]RoleDTO, error) {
+	roles, err := global.User.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]RoleDTO, 0, len(roles))
+	for _, r := range roles {
+		perms := make([]string, 0, len(r.Permissions))
+		for _, p := range r.Permissions {
+			perms = append(perms, p.Permission)
+		}
+		results = append(results, RoleDTO{ID: r.ID, Name: r.Name, Permissions: perms})
+	}
+	return results, nil
+}
+
+func SetRolePermissions(operatorRole int, roleId int, perms []string) (bool, bool, error) { //第一个bool判断是否有权限，第二个bool判断参数是否合法
+	if !HasPermission(operatorRole, model.PermRoleAssign) {
+		return false, false, nil
+	}
+	if _, ok := model.RoleNames[roleId]; !ok {
+		return true, false, nil
+	}
+	for _, p := range perms {
+		if !slices.Contains(model.AllPermissions, p) {
+			return true, false, nil
+		}
+	}
+	// 不允许超级管理员把自己的分配权限收回，避免没有人能再修改权限
+	if roleId == model.RoleSuperAdmin && !slices.Contains(perms, model.PermRoleAssign) {
+		return true, false, nil
+	}
+	if err := global.User.SetRolePermissions(roleId, perms); err != nil {
+		return true, true, err
+	}
+	return true, true, load()
+}
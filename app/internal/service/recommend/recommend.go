@@ -0,0 +1,324 @@
+package recommend
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/service/hot"
+	"commmunity/app/zlog"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 推荐理由，直接返回给前端展示
+const (
+	ReasonHot     = "近期热门"
+	ReasonFollow  = "来自你关注的作者"
+	ReasonSimilar = "和你喜欢相同帖子的人也喜欢"
+)
+
+const (
+	hotCandidates    = 200
+	followCandidates = 100
+	likedSample      = 50 // 取自己最近点赞的帖子数
+	likersSample     = 20 // 每个帖子随机取的点赞人数
+	neighborLiked    = 30 // 每个相似用户取的最近点赞数
+	activeWindow     = 3 * 24 * time.Hour
+)
+
+type candidates struct {
+	scores  map[uint]float64
+	best    map[uint]float64 // 每个帖子贡献最大的来源的分数，用来决定推荐理由
+	reasons map[uint]string
+}
+
+func newCandidates() *candidates {
+	return &candidates{
+		scores:  make(map[uint]float64),
+		best:    make(map[uint]float64),
+		reasons: make(map[uint]string),
+	}
+}
+
+func (c *candidates) add(postId uint, score float64, reason string) {
+	if score <= 0 {
+		return
+	}
+	c.scores[postId] += score
+	if score > c.best[postId] {
+		c.best[postId] = score
+		c.reasons[postId] = reason
+	}
+}
+
+// addRanked 按名次线性衰减，排第一的拿满权重
+func (c *candidates) addRanked(ids []uint, weight float64, reason string) {
+	for i, id := range ids {
+		c.add(id, weight*(1-float64(i)/float64(len(ids))), reason)
+	}
+}
+
+func fromHot(c *candidates) error {
+	entries, err := hot.Top(hot.WindowWeek, hotCandidates)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PostID
+	}
+	c.addRanked(ids, viper.GetFloat64("recommend.hotWeight"), ReasonHot)
+	return nil
+}
+
+func fromFollowing(c *candidates, userId uint) error {
+	followings, err := global.User.GetFollowingIds(userId)
+	if err != nil {
+		return err
+	}
+	ids, err := global.Post.GetPostIdsByUsers(followings, followCandidates)
+	if err != nil {
+		return err
+	}
+	c.addRanked(ids, viper.GetFloat64("recommend.followWeight"), ReasonFollow)
+	return nil
+}
+
+// fromSimilar 基于点赞的协同过滤：找和自己点赞过相同帖子的人，看他们还点赞了什么
+func fromSimilar(c *candidates, account string, liked []uint) error {
+	likedSet := make(map[uint]bool, len(liked))
+	for _, id := range liked {
+		likedSet[id] = true
+	}
+	neighbors := make(map[string]bool)
+	for _, postId := range liked {
+		accounts, err := global.Recommend.GetLikers(postId, likersSample)
+		if err != nil {
+			return err
+		}
+		for _, a := range accounts {
+			if a != account {
+				neighbors[a] = true
+			}
+		}
+	}
+	counts := make(map[uint]int)
+	max := 0
+	for neighbor := range neighbors {
+		ids, err := global.Recommend.GetLiked(neighbor, neighborLiked)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if likedSet[id] {
+				continue
+			}
+			counts[id]++
+			if counts[id] > max {
+				max = counts[id]
+			}
+		}
+	}
+	weight := viper.GetFloat64("recommend.similarWeight")
+	for id, n := range counts {
+		c.add(id, weight*float64(n)/float64(max), ReasonSimilar)
+	}
+	return nil
+}
+
+// build 汇总各路候选，过滤掉点赞过的、自己发的、已推荐过的和已删除的帖子后写入候选池
+func build(userId uint, account string) error {
+	c := newCandidates()
+	if err := fromHot(c); err != nil {
+		return err
+	}
+	if err := fromFollowing(c, userId); err != nil {
+		return err
+	}
+	liked, err := global.Recommend.GetLiked(account, likedSample)
+	if err != nil {
+		return err
+	}
+	if err = fromSimilar(c, account, liked); err != nil {
+		return err
+	}
+	for _, id := range liked {
+		delete(c.scores, id)
+	}
+	ids := make([]uint, 0, len(c.scores))
+	for id := range c.scores {
+		ids = append(ids, id)
+	}
+	ids, err = global.Recommend.FilterSeen(userId, ids)
+	if err != nil {
+		return err
+	}
+	sort.Slice(ids, func(i, j int) bool { return c.scores[ids[i]] > c.scores[ids[j]] })
+	if size := viper.GetInt("recommend.poolSize"); len(ids) > size {
+		ids = ids[:size]
+	}
+	posts, err := global.Post.HotPosts(ids)
+	if err != nil {
+		return err
+	}
+	scores := make(map[uint]float64, len(posts))
+	reasons := make(map[uint]string, len(posts))
+	for _, p := range posts {
+		if p.UserID == userId {
+			continue
+		}
+		scores[p.ID] = c.scores[p.ID]
+		reasons[p.ID] = c.reasons[p.ID]
+	}
+	return global.Recommend.SetCandidates(userId, scores, reasons)
+}
+
+// Like 点赞和取消点赞时维护协同过滤用的点赞历史
+func Like(account string, postId uint, like bool) {
+	_ = global.Recommend.TrackLike(account, postId, like)
+}
+
+type PostDTO struct {
+	Name         string `json:"name"`
+	Avatar       string `json:"avatar"`
+	PostID       uint   `json:"post_id"`
+	Title        string `json:"title"`
+	ViewCount    uint   `json:"view_count"`
+	LikeCount    uint   `json:"like_count"`
+	CommentCount uint   `json:"comment_count"`
+	Reason       string `json:"reason"`
+}
+
+// GetRecommended 每次从候选池取走分数最高的一批，取过的记为已看，所以连续请求就是往下翻。
+// 候选池里的帖子可能之后被删或被隐藏，取出来查不到的不算数，接着从池里补满一页
+func GetRecommended(userId uint, account string, limit int) ([]PostDTO, error) {
+	_ = global.Recommend.MarkRecommendActive(userId)
+	exists, err := global.Recommend.CandidatesExist(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = build(userId, account); err != nil {
+			return nil, err
+		}
+	}
+	rebuilt := !exists
+	posts := make([]PostDTO, 0, limit)
+	for len(posts) < limit {
+		ids, reasons, err := global.Recommend.PopCandidates(userId, limit-len(posts))
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			if rebuilt {
+				break
+			}
+			//候选池取完了，重新算一次
+			if err = build(userId, account); err != nil {
+				return nil, err
+			}
+			rebuilt = true
+			continue
+		}
+		if err = global.Recommend.MarkSeen(userId, ids); err != nil {
+			return nil, err
+		}
+		ps, err := global.Post.HotPosts(ids)
+		if err != nil {
+			return nil, err
+		}
+		byId := make(map[uint]PostDTO, len(ps))
+		for _, p := range ps {
+			byId[p.ID] = PostDTO{
+				Name:         p.User.UserProfile.Name,
+				Avatar:       p.User.UserProfile.Avatar,
+				PostID:       p.ID,
+				Title:        p.Title,
+				ViewCount:    p.ViewCount,
+				LikeCount:    p.LikeCount,
+				CommentCount: p.CommentCount,
+				Reason:       reasons[p.ID],
+			}
+		}
+		for _, id := range ids {
+			if p, ok := byId[id]; ok {
+				posts = append(posts, p)
+			}
+		}
+	}
+	return posts, nil
+}
+
+// Precompute 定时给最近活跃的用户预先算好候选池，请求时不用现算
+func Precompute(ctx context.Context) {
+	users, err := global.Recommend.GetRecommendActive(time.Now().Add(-activeWindow))
+	if err != nil {
+		return
+	}
+	count := 0
+	for _, userId := range users {
+		select {
+		case <-ctx.Done():
+			zlog.Info("推荐预计算任务被取消")
+			return
+		default:
+		}
+		user, err := global.User.GetUserById(userId)
+		if err != nil || user == nil {
+			continue
+		}
+		if err = build(user.ID, user.Account); err != nil {
+			zlog.Warn("推荐候选池计算失败", zap.Uint("userId", userId), zap.Error(err))
+			continue
+		}
+		count++
+	}
+	zlog.Info("推荐候选池已刷新", zap.Int("count", count))
+}
+
+// BackfillLiked 点赞的反向索引是后加的，启动时把post:likes里已有的点赞补进去，补完才让导出和注销改用索引
+func BackfillLiked(ctx context.Context) {
+	ready, err := global.Recommend.LikedIndexReady()
+	if err != nil || ready {
+		return
+	}
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info("点赞索引回填被取消")
+			return
+		default:
+		}
+		next, keys, err := global.PostRedis.ScanRedis("post:likes:*", cursor)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			id, err := strconv.ParseUint(strings.TrimPrefix(key, "post:likes:"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if err = global.Recommend.IndexLikes(uint(id)); err != nil {
+				return
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if err = global.Recommend.MarkLikedIndexReady(); err != nil {
+		return
+	}
+	zlog.Info("点赞索引回填完成", zap.Int("posts", len(seen)))
+}
@@ -0,0 +1,94 @@
+package recommend
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/db/red"
+	"commmunity/app/internal/model"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type fakeRecommend struct {
+	red.RecommendRedis
+	pool map[uint]float64
+	seen map[uint]bool
+}
+
+func (f *fakeRecommend) MarkRecommendActive(userId uint) error { return nil }
+
+func (f *fakeRecommend) CandidatesExist(userId uint) (bool, error) { return true, nil }
+
+func (f *fakeRecommend) PopCandidates(userId uint, count int) ([]uint, map[uint]string, error) {
+	ids := make([]uint, 0, len(f.pool))
+	for id := range f.pool {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return f.pool[ids[i]] > f.pool[ids[j]] })
+	if len(ids) > count {
+		ids = ids[:count]
+	}
+	reasons := make(map[uint]string, len(ids))
+	for _, id := range ids {
+		delete(f.pool, id)
+		reasons[id] = ReasonHot
+	}
+	return ids, reasons, nil
+}
+
+func (f *fakeRecommend) MarkSeen(userId uint, postIds []uint) error {
+	for _, id := range postIds {
+		f.seen[id] = true
+	}
+	return nil
+}
+
+// fakePosts 只返回可见的帖子，和HotPosts过滤掉隐藏、删除的帖子一样
+type fakePosts struct {
+	msq.PostData
+	visible map[uint]bool
+}
+
+func (f *fakePosts) HotPosts(postIds []uint) ([]model.Post, error) {
+	ps := make([]model.Post, 0, len(postIds))
+	for _, id := range postIds {
+		if f.visible[id] {
+			p := model.Post{Title: "t"}
+			p.ID = id
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
+func TestGetRecommendedRefillsPage(t *testing.T) {
+	rec := &fakeRecommend{
+		pool: map[uint]float64{1: 6, 2: 5, 3: 4, 4: 3, 5: 2, 6: 1},
+		seen: make(map[uint]bool),
+	}
+	posts := &fakePosts{visible: map[uint]bool{1: true, 4: true, 5: true, 6: true}}
+	oldRec, oldPost := global.Recommend, global.Post
+	global.Recommend, global.Post = rec, posts
+	t.Cleanup(func() { global.Recommend, global.Post = oldRec, oldPost })
+
+	got, err := GetRecommended(9, "u9", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint, len(got))
+	for i, p := range got {
+		ids[i] = p.PostID
+	}
+	if want := []uint{1, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for _, id := range []uint{1, 2, 3, 4, 5} {
+		if !rec.seen[id] {
+			t.Errorf("post %d should be marked seen", id)
+		}
+	}
+	if rec.seen[6] {
+		t.Error("post 6 was not served and should stay in the pool")
+	}
+}
@@ -0,0 +1,395 @@
+package sanction
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/login"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/ws"
+	"commmunity/app/zlog"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var typeNames = map[int]string{
+	model.SanctionMute:    "禁言",
+	model.SanctionPostBan: "禁止发帖",
+	model.SanctionBan:     "封禁",
+}
+
+// 封禁标记借用token黑名单存放，过期时间与封禁结束时间一致
+func banKey(userId uint) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+func permissionOf(typ int) string {
+	if typ == model.SanctionBan {
+		return model.PermUserBan
+	}
+	return model.PermUserMute
+}
+
+// canHandle 只能处理角色比自己低的用户，版主不能封管理员
+func canHandle(role int, userId uint) (bool, error) {
+	targetRole, err := rbac.RoleOf(userId)
+	if err != nil {
+		return false, err
+	}
+	return rbac.Outranks(role, targetRole), nil
+}
+
+func Issue(operatorId uint, role int, userId uint, typ int, reason string, duration time.Duration) (error, bool, bool) { //第一个bool判断是否有权限，第二个bool判断参数是否合法
+	if _, ok := typeNames[typ]; !ok {
+		return nil, true, false
+	}
+	if !rbac.HasPermission(role, permissionOf(typ)) {
+		return nil, false, false
+	}
+	if reason == "" || duration < 0 || userId == operatorId {
+		return nil, true, false
+	}
+	target, err := global.User.GetUserById(userId)
+	if err != nil {
+		return err, true, false
+	}
+	if target == nil {
+		return nil, true, false
+	}
+	if !rbac.Outranks(role, target.Role) {
+		return nil, false, false
+	}
+	now := time.Now()
+	sanction := model.Sanction{
+		UserID:   userId,
+		Type:     typ,
+		Reason:   reason,
+		IssuerID: operatorId,
+		StartAt:  now,
+	}
+	if duration > 0 {
+		end := now.Add(duration)
+		sanction.EndAt = &end
+	}
+	if err := global.Moderation.CreateSanction(&sanction); err != nil {
+		return err, true, false
+	}
+	if err := apply(sanction); err != nil {
+		return err, true, false
+	}
+	until := "永久"
+	if sanction.EndAt != nil {
+		until = sanction.EndAt.Format("2006-01-02 15:04:05")
+	}
+	ws.SendNotice(userId, model.NoticeSystem, operatorId, 0, fmt.Sprintf("你已被%s至%s，原因：%s", typeNames[typ], until, reason))
+	return nil, true, true
+}
+
+func apply(sanction model.Sanction) error {
+	switch sanction.Type {
+	case model.SanctionMute:
+		if err := global.User.Muted(sanction.UserID, true); err != nil {
+			return err
+		}
+		return global.UserRedis.DelUserCache(sanction.UserID)
+	case model.SanctionBan:
+		if err := syncBan(sanction.UserID); err != nil {
+			return err
+		}
+		return login.LogoutEverywhere(sanction.UserID)
+	}
+	return nil
+}
+
+// 同类型的处罚可能叠加，只有全部失效后才恢复；封禁还要按剩下最晚结束的那个重设过期时间
+func restore(userId uint, typ int) error {
+	if typ == model.SanctionBan {
+		return syncBan(userId)
+	}
+	count, err := global.Moderation.CountActiveSanctions(userId, typ, time.Now())
+	if err != nil || count > 0 {
+		return err
+	}
+	switch typ {
+	case model.SanctionMute:
+		if err = global.User.Muted(userId, false); err != nil {
+			return err
+		}
+		return global.UserRedis.DelUserCache(userId)
+	}
+	return nil
+}
+
+// banExpiration 多个封禁叠加时以最晚结束的为准，有永久封禁就返回0
+func banExpiration(sanctions []model.Sanction, now time.Time) time.Duration {
+	var latest time.Time
+	for _, s := range sanctions {
+		if s.EndAt == nil {
+			return 0
+		}
+		if s.EndAt.After(latest) {
+			latest = *s.EndAt
+		}
+	}
+	return latest.Sub(now)
+}
+
+// syncBan 按数据库里生效的封禁重写Redis标记，数据库才是封禁状态的来源
+func syncBan(userId uint) error {
+	now := time.Now()
+	sanctions, err := global.Moderation.GetActiveSanctions(userId, now)
+	if err != nil {
+		return err
+	}
+	bans := make([]model.Sanction, 0, len(sanctions))
+	for _, s := range sanctions {
+		if s.Type == model.SanctionBan {
+			bans = append(bans, s)
+		}
+	}
+	if len(bans) == 0 {
+		return global.UserRedis.RemoveFromBlacklist(banKey(userId))
+	}
+	return global.UserRedis.AddToBlacklist(banKey(userId), banExpiration(bans, now))
+}
+
+// restoring 同一时间只跑一个重建，Redis刚被清空时大量请求会同时发现标记缺失
+var restoring atomic.Bool
+
+// RestoreBans 启动时以及Redis被清空后，从数据库重建所有封禁标记
+func RestoreBans(ctx context.Context) {
+	if !restoring.CompareAndSwap(false, true) {
+		return
+	}
+	defer restoring.Store(false)
+	now := time.Now()
+	sanctions, err := global.Moderation.GetActiveSanctionsByType(model.SanctionBan, now)
+	if err != nil {
+		return
+	}
+	byUser := make(map[uint][]model.Sanction)
+	for _, s := range sanctions {
+		byUser[s.UserID] = append(byUser[s.UserID], s)
+	}
+	for userId, bans := range byUser {
+		select {
+		case <-ctx.Done():
+			zlog.Info("封禁标记重建被取消")
+			return
+		default:
+		}
+		if err = global.UserRedis.AddToBlacklist(banKey(userId), banExpiration(bans, now)); err != nil {
+			zlog.Error("重建封禁标记失败", zap.Uint("userId", userId), zap.Error(err))
+			return
+		}
+	}
+	if err = global.UserRedis.MarkBansSynced(); err != nil {
+		zlog.Error("记录封禁标记重建状态失败", zap.Error(err))
+		return
+	}
+	zlog.Info("封禁标记重建完成", zap.Int("users", len(byUser)))
+}
+
+func lift(sanction model.Sanction, message string) error {
+	flag, err := global.Moderation.LiftSanction(sanction.ID)
+	if err != nil || !flag {
+		return err
+	}
+	if err = restore(sanction.UserID, sanction.Type); err != nil {
+		return err
+	}
+	ws.SendNotice(sanction.UserID, model.NoticeSystem, 0, 0, message)
+	return nil
+}
+
+func Lift(role int, sanctionId uint) (error, bool) {
+	sanction, err := global.Moderation.GetSanction(sanctionId)
+	if err != nil {
+		return err, false
+	}
+	if sanction.ID == 0 || !rbac.HasPermission(role, permissionOf(sanction.Type)) {
+		return nil, false
+	}
+	if ok, err := canHandle(role, sanction.UserID); err != nil || !ok {
+		return err, false
+	}
+	return lift(sanction, fmt.Sprintf("你的%s已被解除", typeNames[sanction.Type])), true
+}
+
+// SetMuted 兼容原来的禁言开关：开启即永久禁言，关闭即解除所有禁言
+func SetMuted(operatorId uint, role int, userId uint, isMuted bool) (error, bool) {
+	if isMuted {
+		err, flag, _ := Issue(operatorId, role, userId, model.SanctionMute, "管理员禁言", 0)
+		return err, flag
+	}
+	if !rbac.HasPermission(role, model.PermUserMute) {
+		return nil, false
+	}
+	if ok, err := canHandle(role, userId); err != nil || !ok {
+		return err, false
+	}
+	sanctions, err := global.Moderation.GetActiveSanctions(userId, time.Now())
+	if err != nil {
+		return err, false
+	}
+	for _, s := range sanctions {
+		if s.Type != model.SanctionMute {
+			continue
+		}
+		if err = lift(s, "你的禁言已被解除"); err != nil {
+			return err, false
+		}
+	}
+	return restore(userId, model.SanctionMute), true
+}
+
+// IsBanned 平时只查Redis；重建标记不在说明Redis丢过数据，先查数据库兜底，再在后台重建
+func IsBanned(userId uint) bool {
+	if global.UserRedis.IsInBlacklist(banKey(userId)) {
+		return true
+	}
+	synced, err := global.UserRedis.BansSynced()
+	if err == nil && synced {
+		return false
+	}
+	if err == nil {
+		go RestoreBans(context.Background())
+	}
+	count, err := global.Moderation.CountActiveSanctions(userId, model.SanctionBan, time.Now())
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+func IsPostBanned(userId uint) (bool, error) {
+	count, err := global.Moderation.CountActiveSanctions(userId, model.SanctionPostBan, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func LiftExpired(ctx context.Context) {
+	sanctions, err := global.Moderation.GetExpiredSanctions(time.Now())
+	if err != nil {
+		return
+	}
+	for _, s := range sanctions {
+		select {
+		case <-ctx.Done():
+			zlog.Info("处罚解除任务被取消")
+			return
+		default:
+		}
+		if err = lift(s, fmt.Sprintf("你的%s已到期自动解除", typeNames[s.Type])); err != nil {
+			zlog.Error("自动解除处罚失败", zap.Uint("sanctionId", s.ID), zap.Error(err))
+		}
+	}
+}
+
+type SanctionDTO struct {
+	ID           uint   `json:"id"`
+	UserID       uint   `json:"user_id"`
+	Type         int    `json:"type"`
+	TypeName     string `json:"type_name"`
+	Reason       string `json:"reason"`
+	StartAt      string `json:"start_at"`
+	EndAt        string `json:"end_at"`
+	Appeal       string `json:"appeal"`
+	AppealStatus int    `json:"appeal_status"`
+}
+
+func toDTO(s model.Sanction) SanctionDTO {
+	dto := SanctionDTO{
+		ID:           s.ID,
+		UserID:       s.UserID,
+		Type:         s.Type,
+		TypeName:     typeNames[s.Type],
+		Reason:       s.Reason,
+		StartAt:      s.StartAt.Format("2006-01-02 15:04:05"),
+		Appeal:       s.Appeal,
+		AppealStatus: s.AppealStatus,
+	}
+	if s.EndAt != nil {
+		dto.EndAt = s.EndAt.Format("2006-01-02 15:04:05")
+	}
+	return dto
+}
+
+// Get 审计用，处罚不存在时ID为0
+func Get(sanctionId uint) (SanctionDTO, error) {
+	s, err := global.Moderation.GetSanction(sanctionId)
+	if err != nil || s.ID == 0 {
+		return SanctionDTO{}, err
+	}
+	return toDTO(s), nil
+}
+
+func GetActive(userId uint) ([]SanctionDTO, error) {
+	sanctions, err := global.Moderation.GetActiveSanctions(userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SanctionDTO, 0, len(sanctions))
+	for _, s := range sanctions {
+		results = append(results, toDTO(s))
+	}
+	return results, nil
+}
+
+func Appeal(userId uint, sanctionId uint, appeal string) (error, bool) {
+	if appeal == "" {
+		return nil, false
+	}
+	sanction, err := global.Moderation.GetSanction(sanctionId)
+	if err != nil {
+		return err, false
+	}
+	if sanction.ID == 0 || sanction.UserID != userId {
+		return nil, false
+	}
+	flag, err := global.Moderation.AppealSanction(sanctionId, appeal)
+	return err, flag
+}
+
+func ReviewAppeal(role int, sanctionId uint, accept bool) (error, bool) {
+	sanction, err := global.Moderation.GetSanction(sanctionId)
+	if err != nil {
+		return err, false
+	}
+	if sanction.ID == 0 || !rbac.HasPermission(role, permissionOf(sanction.Type)) {
+		return nil, false
+	}
+	if ok, err := canHandle(role, sanction.UserID); err != nil || !ok {
+		return err, false
+	}
+	status := model.AppealRejected
+	if accept {
+		status = model.AppealAccepted
+	}
+	flag, err := global.Moderation.ReviewAppeal(sanctionId, status)
+	if err != nil || !flag {
+		return err, flag
+	}
+	if accept {
+		return lift(sanction, fmt.Sprintf("你的申诉已通过，%s已解除", typeNames[sanction.Type])), true
+	}
+	ws.SendNotice(sanction.UserID, model.NoticeSystem, 0, 0, fmt.Sprintf("你对%s的申诉未通过", typeNames[sanction.Type]))
+	return nil, true
+}
+
+func GetPendingAppeals(offset int, limit int) ([]SanctionDTO, error) {
+	sanctions, err := global.Moderation.GetPendingAppeals(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SanctionDTO, 0, len(sanctions))
+	for _, s := range sanctions {
+		results = append(results, toDTO(s))
+	}
+	return results, nil
+}
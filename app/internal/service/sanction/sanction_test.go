@@ -0,0 +1,108 @@
+package sanction
+
+import (
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/db/msq"
+	"commmunity/app/internal/model"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeUsers struct {
+	msq.UserData
+	users map[uint]model.User
+}
+
+func (f *fakeUsers) GetUserById(userId uint) (*model.User, error) {
+	u, ok := f.users[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (f *fakeUsers) GetRoleVersion(userId uint) (int, int, error) {
+	return f.users[userId].Role, 0, nil
+}
+
+// GetRoles 读不到权限矩阵时rbac按默认权限判断
+func (f *fakeUsers) GetRoles() ([]model.Role, error) {
+	return nil, errors.New("no roles in tests")
+}
+
+type fakeModeration struct {
+	msq.ModerationData
+	sanctions map[uint]model.Sanction
+	created   int
+}
+
+func (f *fakeModeration) GetSanction(sanctionId uint) (model.Sanction, error) {
+	return f.sanctions[sanctionId], nil
+}
+
+func (f *fakeModeration) CreateSanction(sanction *model.Sanction) error {
+	f.created++
+	return nil
+}
+
+func useFakes(t *testing.T) *fakeModeration {
+	t.Helper()
+	users := &fakeUsers{users: make(map[uint]model.User)}
+	for id, role := range map[uint]int{1: model.RoleUser, 2: model.RoleModerator, 3: model.RoleAdmin, 4: model.RoleSuperAdmin, 5: model.RoleModerator} {
+		u := model.User{Role: role}
+		u.ID = id
+		users.users[id] = u
+	}
+	moderation := &fakeModeration{sanctions: make(map[uint]model.Sanction)}
+	oldUser, oldModeration := global.User, global.Moderation
+	global.User, global.Moderation = users, moderation
+	t.Cleanup(func() { global.User, global.Moderation = oldUser, oldModeration })
+	return moderation
+}
+
+func TestIssueRefusesEqualOrHigherRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator uint
+		role     int
+		target   uint
+		typ      int
+		flag1    bool
+		flag2    bool
+	}{
+		{name: "版主不能封管理员", operator: 2, role: model.RoleModerator, target: 3, typ: model.SanctionMute},
+		{name: "版主不能禁言另一个版主", operator: 2, role: model.RoleModerator, target: 5, typ: model.SanctionMute},
+		{name: "管理员不能封超级管理员", operator: 3, role: model.RoleAdmin, target: 4, typ: model.SanctionBan},
+		{name: "目标用户不存在", operator: 3, role: model.RoleAdmin, target: 99, typ: model.SanctionBan, flag1: true},
+		{name: "不能处罚自己", operator: 3, role: model.RoleAdmin, target: 3, typ: model.SanctionBan, flag1: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moderation := useFakes(t)
+			err, flag1, flag2 := Issue(tt.operator, tt.role, tt.target, tt.typ, "原因", time.Hour)
+			if err != nil || flag1 != tt.flag1 || flag2 != tt.flag2 {
+				t.Errorf("Issue = %v, %v, %v, want nil, %v, %v", err, flag1, flag2, tt.flag1, tt.flag2)
+			}
+			if moderation.created != 0 {
+				t.Error("被拒绝时不应该创建处罚")
+			}
+		})
+	}
+}
+
+func TestLiftAndReviewRefuseEqualOrHigherRole(t *testing.T) {
+	moderation := useFakes(t)
+	s := model.Sanction{UserID: 3, Type: model.SanctionMute}
+	s.ID = 7
+	moderation.sanctions[7] = s
+	if err, flag := Lift(model.RoleModerator, 7); err != nil || flag {
+		t.Errorf("版主解除管理员的处罚: %v, %v", err, flag)
+	}
+	if err, flag := ReviewAppeal(model.RoleModerator, 7, true); err != nil || flag {
+		t.Errorf("版主处理管理员的申诉: %v, %v", err, flag)
+	}
+	if err, flag := SetMuted(2, model.RoleModerator, 3, false); err != nil || flag {
+		t.Errorf("版主给管理员解除禁言: %v, %v", err, flag)
+	}
+}
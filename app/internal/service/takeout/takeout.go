@@ -0,0 +1,423 @@
+package takeout
+
+import (
+	"archive/zip"
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/ws"
+	"commmunity/app/utils"
+	"commmunity/app/zlog"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const batchSize = 500
+
+var imagePattern = regexp.MustCompile(`/static/(post_file|avatars)/([A-Za-z0-9_.\-]+)`)
+
+func signPath(jobId uint) string {
+	return fmt.Sprintf("export:%d", jobId)
+}
+
+func downloadLink(jobId uint, expireAt time.Time) string {
+	expires := expireAt.Unix()
+	return fmt.Sprintf("%s/account/export/%d/download?expires=%d&sig=%s",
+		viper.GetString("mail.linkBase"), jobId, expires, utils.SignURL(signPath(jobId), expires))
+}
+
+// RequestExport 同一时间只允许一个排队或打包中的任务
+func RequestExport(userId uint) (bool, error) {
+	job, err := global.Export.GetLatestExportJob(userId)
+	if err != nil {
+		return false, err
+	}
+	if job.ID != 0 && (job.Status == model.ExportPending || job.Status == model.ExportRunning) {
+		return false, nil
+	}
+	return true, global.Export.CreateExportJob(&model.ExportJob{UserID: userId})
+}
+
+type ExportDTO struct {
+	ID        uint   `json:"id"`
+	Status    int    `json:"status"`
+	CreatedAt string `json:"created_at"`
+	ExpireAt  string `json:"expire_at,omitempty"`
+	Link      string `json:"link,omitempty"`
+}
+
+func GetLatest(userId uint) (ExportDTO, error) {
+	job, err := global.Export.GetLatestExportJob(userId)
+	if err != nil || job.ID == 0 {
+		return ExportDTO{}, err
+	}
+	dto := ExportDTO{
+		ID:        job.ID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if job.Status == model.ExportDone && job.ExpireAt != nil && job.ExpireAt.After(time.Now()) {
+		dto.ExpireAt = job.ExpireAt.Format("2006-01-02 15:04:05")
+		dto.Link = downloadLink(job.ID, *job.ExpireAt)
+	}
+	return dto, nil
+}
+
+// DownloadPath 校验签名后返回压缩包路径
+func DownloadPath(jobId uint, expires int64, sig string) (string, bool, error) {
+	if !utils.VerifyURL(signPath(jobId), expires, sig) {
+		return "", false, nil
+	}
+	job, err := global.Export.GetExportJob(jobId)
+	if err != nil {
+		return "", false, err
+	}
+	if job.Status != model.ExportDone || job.FilePath == "" {
+		return "", false, nil
+	}
+	return job.FilePath, true, nil
+}
+
+// failStale 打包中超过export.staleMinutes没有结束的任务标记为失败，用户可以重新申请
+func failStale() {
+	staleBefore := time.Now().Add(-time.Duration(viper.GetInt("export.staleMinutes")) * time.Minute)
+	jobs, err := global.Export.GetStaleExportJobs(staleBefore)
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		ok, err := global.Export.FailStaleExportJob(job.ID, staleBefore, "打包超时")
+		if err != nil || !ok {
+			continue
+		}
+		zlog.Warn("导出任务打包超时", zap.Uint("job", job.ID))
+		ws.SendNotice(job.UserID, model.NoticeSystem, 0, 0, "数据导出超时失败，请重新申请")
+	}
+}
+
+// ProcessPending 由定时任务调用，先清理卡住的任务，再逐个抢占并打包
+func ProcessPending(ctx context.Context) {
+	failStale()
+	jobs, err := global.Export.GetPendingExportJobs(5)
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		select {
+		case <-ctx.Done():
+			zlog.Info("导出任务被取消")
+			return
+		default:
+		}
+		ok, err := global.Export.ClaimExportJob(job.ID)
+		if err != nil || !ok {
+			continue
+		}
+		run(job)
+	}
+}
+
+func run(job model.ExportJob) {
+	path, err := build(job)
+	if err != nil {
+		zlog.Error("打包导出数据失败", zap.Uint("job", job.ID), zap.Error(err))
+		_ = global.Export.FinishExportJob(job.ID, model.ExportFailed, "", nil, err.Error())
+		ws.SendNotice(job.UserID, model.NoticeSystem, 0, 0, "数据导出失败，请稍后重试")
+		return
+	}
+	expireAt := time.Now().Add(time.Duration(viper.GetInt("export.ttlHours")) * time.Hour)
+	if err = global.Export.FinishExportJob(job.ID, model.ExportDone, path, &expireAt, ""); err != nil {
+		_ = os.Remove(path)
+		return
+	}
+	ws.SendNotice(job.UserID, model.NoticeSystem, 0, 0,
+		fmt.Sprintf("你的数据导出已完成，下载链接（%s前有效）：%s", expireAt.Format("2006-01-02 15:04:05"), downloadLink(job.ID, expireAt)))
+}
+
+// CleanExpired 删除过期的压缩包
+func CleanExpired(ctx context.Context) {
+	jobs, err := global.Export.GetExpiredExportJobs(time.Now())
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if err = os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			zlog.Warn("删除过期导出文件失败", zap.String("path", job.FilePath), zap.Error(err))
+			continue
+		}
+		_ = global.Export.FinishExportJob(job.ID, model.ExportExpired, "", job.ExpireAt, "")
+	}
+}
+
+func build(job model.ExportJob) (string, error) {
+	dir := viper.GetString("export.dir")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	random, err := utils.MakeOnceToken("export")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d_%d_%s.zip", job.UserID, job.ID, strings.SplitN(random, ".", 2)[0])
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	w := zip.NewWriter(f)
+	err = writeArchive(w, job.UserID)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+func writeJSON(w *zip.Writer, name string, v interface{}) error {
+	fw, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type relationDTO struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func writeArchive(w *zip.Writer, userId uint) error {
+	user, err := global.Post.GetUserProfile(userId)
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		return fmt.Errorf("用户%d不存在", userId)
+	}
+	images := make(map[string]bool)
+	collectImages(user.UserProfile.Avatar, images)
+	err = writeJSON(w, "profile.json", map[string]interface{}{
+		"id":           user.ID,
+		"account":      user.Account,
+		"email":        user.Email,
+		"name":         user.UserProfile.Name,
+		"introduction": user.UserProfile.Introduction,
+		"avatar":       user.UserProfile.Avatar,
+		"vip":          user.Vip,
+		"role":         user.Role,
+		"created_at":   user.CreatedAt.Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return err
+	}
+	if err = writePosts(w, userId, images); err != nil {
+		return err
+	}
+	if err = writeComments(w, userId); err != nil {
+		return err
+	}
+	if err = writeMessages(w, userId); err != nil {
+		return err
+	}
+	followers, err := global.User.GetFollowers(userId)
+	if err != nil {
+		return err
+	}
+	if err = writeJSON(w, "followers.json", relations(followers)); err != nil {
+		return err
+	}
+	followings, err := global.User.GetFollowings(userId)
+	if err != nil {
+		return err
+	}
+	if err = writeJSON(w, "followings.json", relations(followings)); err != nil {
+		return err
+	}
+	likes, err := likedPosts(user.Account)
+	if err != nil {
+		return err
+	}
+	if err = writeJSON(w, "likes.json", likes); err != nil {
+		return err
+	}
+	return writeImages(w, images)
+}
+
+func relations(users []model.User) []relationDTO {
+	list := make([]relationDTO, 0, len(users))
+	for _, u := range users {
+		list = append(list, relationDTO{ID: u.ID, Name: u.UserProfile.Name})
+	}
+	return list
+}
+
+func writePosts(w *zip.Writer, userId uint, images map[string]bool) error {
+	lastId := uint(0)
+	for {
+		posts, err := global.Export.GetUserPosts(userId, lastId, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, p := range posts {
+			fw, err := w.Create(fmt.Sprintf("posts/%d.md", p.ID))
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(fw, "# %s\n\n> 发布于 %s · 浏览 %d · 点赞 %d · 评论 %d\n\n%s\n",
+				p.Title, p.CreatedAt.Format("2006-01-02 15:04:05"), p.ViewCount, p.LikeCount, p.CommentCount, p.Content)
+			if err != nil {
+				return err
+			}
+			collectImages(p.Content, images)
+		}
+		if len(posts) < batchSize {
+			return nil
+		}
+		lastId = posts[len(posts)-1].ID
+	}
+}
+
+type commentDTO struct {
+	ID        uint   `json:"id"`
+	PostID    uint   `json:"post_id"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+func writeComments(w *zip.Writer, userId uint) error {
+	list := make([]commentDTO, 0)
+	lastId := uint(0)
+	for {
+		comments, err := global.Export.GetUserComments(userId, lastId, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, c := range comments {
+			list = append(list, commentDTO{ID: c.ID, PostID: c.PostID, Content: c.Content, CreatedAt: c.CreatedAt.Format("2006-01-02 15:04:05")})
+		}
+		if len(comments) < batchSize {
+			break
+		}
+		lastId = comments[len(comments)-1].ID
+	}
+	return writeJSON(w, "comments.json", list)
+}
+
+type messageDTO struct {
+	ID         uint   `json:"id"`
+	FromUserID uint   `json:"from_user_id"`
+	ToUserID   uint   `json:"to_user_id"`
+	Type       int    `json:"type"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func writeMessages(w *zip.Writer, userId uint) error {
+	list := make([]messageDTO, 0)
+	lastId := uint(0)
+	for {
+		messages, err := global.Export.GetUserMessages(userId, lastId, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			list = append(list, messageDTO{ID: m.ID, FromUserID: m.FromUserID, ToUserID: m.ToUserID, Type: m.Type,
+				Content: m.Content, CreatedAt: m.CreatedAt.Format("2006-01-02 15:04:05")})
+		}
+		if len(messages) < batchSize {
+			break
+		}
+		lastId = messages[len(messages)-1].ID
+	}
+	return writeJSON(w, "messages.json", list)
+}
+
+// likedPosts 点赞只存在redis里，优先用按账号的反向索引，索引还没回填完时才扫描所有帖子的点赞集合
+func likedPosts(account string) ([]uint, error) {
+	ready, err := global.Recommend.LikedIndexReady()
+	if err != nil {
+		return nil, err
+	}
+	if ready {
+		return global.Recommend.GetAllLiked(account)
+	}
+	ids := make([]uint, 0)
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		next, keys, err := global.PostRedis.ScanRedis("post:likes:*", cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			liked, err := global.PostRedis.IsLike(key, account)
+			if err != nil {
+				return nil, err
+			}
+			if !liked {
+				continue
+			}
+			id, err := strconv.ParseUint(strings.TrimPrefix(key, "post:likes:"), 10, 64)
+			if err == nil {
+				ids = append(ids, uint(id))
+			}
+		}
+		if next == 0 {
+			return ids, nil
+		}
+		cursor = next
+	}
+}
+
+func collectImages(text string, images map[string]bool) {
+	for _, m := range imagePattern.FindAllStringSubmatch(text, -1) {
+		images[filepath.Join(m[1], m[2])] = true
+	}
+}
+
+// writeImages 只打包uploads下能找到的文件，丢失的图片直接跳过
+func writeImages(w *zip.Writer, images map[string]bool) error {
+	for rel := range images {
+		f, err := os.Open(filepath.Join("uploads", rel))
+		if err != nil {
+			continue
+		}
+		fw, err := w.Create(filepath.ToSlash(filepath.Join("images", rel)))
+		if err == nil {
+			_, err = io.Copy(fw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
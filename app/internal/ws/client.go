@@ -3,6 +3,7 @@ package ws
 import (
 	"commmunity/app/internal/db/global"
 	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/filter"
 	"commmunity/app/zlog"
 	"encoding/json"
 	"net/http"
@@ -53,7 +54,16 @@ func (client *Client) ReadMessage() {
 			zlog.Error("json序列化失败", zap.Error(err))
 			continue
 		}
-		global.Message.SaveMessage(client.UserId, MessageRequest.ToUserID, MessageRequest.Content, MessageRequest.Type)
+		var hits []string
+		if MessageRequest.Type == 1 {
+			MessageRequest.Content, hits, err = filter.Filter(MessageRequest.Content)
+			if err != nil {
+				GlobalManager.SendToUser(client.UserId, Response{Code: Error, Data: ErrorData{Message: err.Error()}})
+				continue
+			}
+		}
+		messageId := global.Message.SaveMessage(client.UserId, MessageRequest.ToUserID, MessageRequest.Content, MessageRequest.Type)
+		filter.Flag(model.ReportMessage, messageId, client.UserId, hits)
 		_ = global.MessageRedis.DelMessageCache(client.UserId, MessageRequest.ToUserID)
 		res := Response{
 			Code: Chat,
@@ -12,6 +12,7 @@ import (
 const (
 	Chat         = 1
 	Notification = 2
+	Error        = 3
 )
 
 type Response struct {
@@ -36,6 +37,10 @@ type NoticeData struct {
 	CreatedAt string `json:"created_at"`
 }
 
+type ErrorData struct {
+	Message string `json:"message"`
+}
+
 type Client struct {
 	Manager *Manager
 	UserId  uint
@@ -93,3 +98,10 @@ func (manager *Manager) SendToUser(userId uint, message interface{}) {
 		zlog.Info("用户不在线，消息未发送")
 	}
 }
+
+func (manager *Manager) IsOnline(userId uint) bool {
+	manager.Lock.RLock()
+	_, ok := manager.Clients[userId]
+	manager.Lock.RUnlock()
+	return ok
+}
@@ -4,6 +4,8 @@ import (
 	"commmunity/app/internal/response"
 	"commmunity/app/internal/service/controller"
 	"commmunity/app/internal/service/login"
+	"commmunity/app/internal/service/rbac"
+	"commmunity/app/internal/service/sanction"
 	"commmunity/app/utils"
 	"fmt"
 	"net/http"
@@ -11,9 +13,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func JwtAuthMiddleware() gin.HandlerFunc {
+	return jwtAuth(false)
+}
+
+// JwtAuthAllowBannedMiddleware 被封禁的用户也能通过，只用于查看处罚和申诉
+func JwtAuthAllowBannedMiddleware() gin.HandlerFunc {
+	return jwtAuth(true)
+}
+
+func jwtAuth(allowBanned bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		var tokenString string
@@ -26,6 +38,10 @@ func JwtAuthMiddleware() gin.HandlerFunc {
 			}
 		} else {
 			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) == 2 && parts[0] == "Token" {
+				accessTokenAuth(c, parts[1], allowBanned)
+				return
+			}
 			if len(parts) != 2 || parts[0] != "Bearer" {
 				response.FailWithMessage(c, "token格式不对")
 				c.Abort()
@@ -45,9 +61,116 @@ func JwtAuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if !login.IsSessionValid(claims.SessionId) {
+			response.FailWithMessage(c, "登录已失效，请重新登录")
+			c.Abort()
+			return
+		}
+		if !allowBanned && sanction.IsBanned(claims.UserId) {
+			response.FailWithMessage(c, "账号已被封禁")
+			c.Abort()
+			return
+		}
+		role, ok, err := rbac.CurrentRole(claims.UserId, claims.RoleVersion)
+		if err != nil {
+			response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+			c.Abort()
+			return
+		}
+		if !ok {
+			response.FailWithMessage(c, "权限已变更，请重新登录")
+			c.Abort()
+			return
+		}
 		c.Set("account", (*claims).Account)
-		c.Set("role", (*claims).Role)
+		c.Set("role", role)
 		c.Set("userId", (*claims).UserId)
+		c.Set("sessionId", (*claims).SessionId)
+		c.Next()
+	}
+}
+
+// accessTokenAuth 个人访问令牌没有会话，上下文里多一个scopes，由RequireScope按路由组检查
+func accessTokenAuth(c *gin.Context, token string, allowBanned bool) {
+	identity, ok, err := login.VerifyAccessToken(token)
+	if err != nil {
+		response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+		c.Abort()
+		return
+	}
+	if !ok {
+		response.FailWithMessage(c, "访问令牌无效或已过期")
+		c.Abort()
+		return
+	}
+	if !allowBanned && sanction.IsBanned(identity.UserID) {
+		response.FailWithMessage(c, "账号已被封禁")
+		c.Abort()
+		return
+	}
+	c.Set("account", identity.Account)
+	c.Set("role", identity.Role)
+	c.Set("userId", identity.UserID)
+	c.Set("tokenId", identity.TokenID)
+	c.Set("scopes", identity.Scopes)
+	c.Next()
+}
+
+// RequireScope 只限制个人访问令牌，登录会话拥有全部权限范围
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get("scopes")
+		if !ok {
+			c.Next()
+			return
+		}
+		for _, s := range v.([]string) {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		response.FailWithMessage(c, "访问令牌没有"+scope+"权限")
+		c.Abort()
+	}
+}
+
+// SessionOnly 账号安全相关的接口不允许用访问令牌调用
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("scopes"); ok {
+			response.FailWithMessage(c, "该接口需要登录后操作，不支持访问令牌")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission 需要同时拥有所有列出的权限
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetInt("role")
+		for _, p := range permissions {
+			if !rbac.HasPermission(role, p) {
+				response.FailWithMessage(c, "暂无权限")
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequestIdMiddleware 给每个请求一个ID，沿用客户端传来的X-Request-Id
+func RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader("X-Request-Id")
+		if requestId == "" || len(requestId) > 64 {
+			requestId = uuid.NewString()
+		}
+		c.Set("requestId", requestId)
+		c.Header("X-Request-Id", requestId)
 		c.Next()
 	}
 }
@@ -87,3 +210,22 @@ func RateLimitingMiddleware(limitKey string, limitDuration time.Duration, limitC
 		c.Next()
 	}
 }
+
+// IpRateLimitingMiddleware 按IP限流，用于登录等不需要鉴权的接口
+func IpRateLimitingMiddleware(limitKey string, limitDuration time.Duration, limitCount int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := fmt.Sprintf("rate:limit:%s:ip:%s", limitKey, c.ClientIP())
+		isPost, err := controller.RateLimiting(c, key, limitDuration, limitCount)
+		if err != nil {
+			response.FailWithCode(c, response.INTERNAL_ERROR, response.GetMsg(response.INTERNAL_ERROR))
+			c.Abort()
+			return
+		}
+		if !isPost {
+			response.FailWithMessage(c, "操作频繁，请稍后再试")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
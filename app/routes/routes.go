@@ -3,6 +3,12 @@ package routes
 import (
 	"commmunity/app/internal/api"
 	"commmunity/app/internal/cron"
+	"commmunity/app/internal/db/global"
+	"commmunity/app/internal/model"
+	"commmunity/app/internal/service/feed"
+	"commmunity/app/internal/service/indexer"
+	"commmunity/app/internal/service/recommend"
+	"commmunity/app/internal/service/sanction"
 	"commmunity/app/internal/ws"
 	"commmunity/app/middleware"
 	"context"
@@ -12,62 +18,187 @@ import (
 )
 
 func Routes() {
+	global.Init()
 	cronLikeManager := cron.NewCronManager(1 * time.Minute)
 	cronLikeManager.Start(context.Background(), cron.SyncPostLikes)
 	cronViewManager := cron.NewCronManager(5 * time.Minute)
 	cronViewManager.Start(context.Background(), cron.SyncView)
-	cronHotRankManager := cron.NewCronManager(5 * time.Hour)
+	cronHotRankManager := cron.NewCronManager(10 * time.Minute)
 	cronHotRankManager.Start(context.Background(), cron.RefreshHot)
+	cronCreatorManager := cron.NewCronManager(1 * time.Hour)
+	cronCreatorManager.Start(context.Background(), cron.RefreshCreators)
+	cronRecommendManager := cron.NewCronManager(30 * time.Minute)
+	cronRecommendManager.Start(context.Background(), cron.PrecomputeRecommend)
+	cronHotSearchManager := cron.NewCronManager(1 * time.Hour)
+	cronHotSearchManager.Start(context.Background(), cron.DecayHotSearches)
+	cronAnnouncementManager := cron.NewCronManager(1 * time.Minute)
+	cronAnnouncementManager.Start(context.Background(), cron.PublishAnnouncements)
+	cronSanctionManager := cron.NewCronManager(1 * time.Minute)
+	cronSanctionManager.Start(context.Background(), cron.LiftExpiredSanctions)
+	cronExportManager := cron.NewCronManager(30 * time.Second)
+	cronExportManager.Start(context.Background(), cron.ProcessExports)
+	cronDeletionManager := cron.NewCronManager(1 * time.Hour)
+	cronDeletionManager.Start(context.Background(), cron.PurgeDeletedAccounts)
 	go ws.GlobalManager.Start()
+	go feed.StartFanout()
+	go indexer.Rebuild(context.Background())
+	go indexer.RebuildVectors(context.Background())
+	go sanction.RestoreBans(context.Background())
+	go recommend.BackfillLiked(context.Background())
 	r := gin.Default()
+	r.Use(middleware.RequestIdMiddleware())
 	r.Use(middleware.CorsMiddleWare())
 	r.Static("/static", "./uploads")
 	account := r.Group("/account")
 	{
 		account.POST("/register", api.Register)
-		account.POST("/login", api.Login)
+		account.POST("/login", middleware.IpRateLimitingMiddleware("login", time.Minute, 30), api.Login)
+		account.POST("/login/2fa", middleware.IpRateLimitingMiddleware("loginMfa", time.Minute, 10), api.LoginMfa)
 		account.POST("/refresh", api.RefreshToken)
 	}
+	{
+		account.GET("/verify-email", api.VerifyEmail)                                                                                           // 验证邮箱
+		account.POST("/password-reset/request", middleware.IpRateLimitingMiddleware("passwordReset", time.Minute, 3), api.RequestPasswordReset) // 申请重置密码
+		account.POST("/password-reset", api.ResetPassword)                                                                                      // 重置密码
+	}
+	{
+		account.GET("/oidc", api.GetOidcProviders)                                                                        // 可用的第三方登录
+		account.GET("/oidc/:provider/login", middleware.IpRateLimitingMiddleware("oidc", time.Minute, 30), api.OidcLogin) // 跳转第三方授权（授权码+PKCE）
+		account.GET("/oidc/:provider/callback", api.OidcCallback)                                                         // 第三方回调，登录或完成绑定
+	}
+	{
+		account.POST("/export", middleware.JwtAuthMiddleware(), middleware.SessionOnly(), middleware.RateLimitingMiddleware("export", time.Hour, 3), api.RequestExport) // 申请导出个人数据
+		account.GET("/export", middleware.JwtAuthMiddleware(), middleware.SessionOnly(), api.GetExport)                                                                 // 查看导出进度和下载链接
+		account.GET("/export/:Id/download", api.DownloadExport)                                                                                                         // 签名下载链接
+	}
+	sanctions := r.Group("/account/sanctions")
+	sanctions.Use(middleware.JwtAuthAllowBannedMiddleware(), middleware.SessionOnly())
+	{
+		sanctions.GET("", api.GetMySanctions)             // 查看自己生效中的处罚
+		sanctions.POST("/:Id/appeal", api.AppealSanction) // 申诉
+	}
 	protected := r.Group("/account/protected")
 	protected.Use(middleware.JwtAuthMiddleware())
+	// 个人访问令牌按路由组限制权限范围，登录会话不受影响
+	self := protected.Group("", middleware.SessionOnly())
+	{
+		self.PATCH("/username", api.ChangeUserName)                                                                              // 修改用户名
+		self.POST("/avatar", api.ChangeAvatar)                                                                                   // 修改头像
+		self.PATCH("/introduction", api.ChangeIntroduction)                                                                      // 修改简介
+		self.POST("/email", middleware.RateLimitingMiddleware("bindEmail", time.Minute, 1), api.BindEmail)                       // 绑定邮箱并发送验证邮件
+		self.POST("/logout-all", api.LogoutEverywhere)                                                                           // 退出所有设备
+		self.GET("/sessions", api.GetSessions)                                                                                   // 查看登录设备
+		self.DELETE("/sessions/:Id", api.DeleteSession)                                                                          // 下线指定设备
+		self.POST("/logout", api.Logout)                                                                                         // 退出登录
+		self.DELETE("/delete-user", api.DeleteUser)                                                                              // 申请注销账户（14天冷静期）
+		self.GET("/delete-user", api.GetDeletion)                                                                                // 查看注销申请
+		self.POST("/delete-user/cancel", api.CancelDeletion)                                                                     // 撤销注销
+		self.POST("/password-change", middleware.RateLimitingMiddleware("changePassword", 5*time.Second, 1), api.ChangePassword) // 修改密码
+	}
+	{
+		self.POST("/2fa/enroll", api.EnrollTotp)   // 生成两步验证密钥
+		self.POST("/2fa/verify", api.ConfirmTotp)  // 验证并开启两步验证，返回恢复码
+		self.POST("/2fa/disable", api.DisableTotp) // 关闭两步验证
+	}
+	{
+		self.POST("/tokens", api.CreateAccessToken)       // 创建个人访问令牌，明文只返回一次
+		self.GET("/tokens", api.GetAccessTokens)          // 我的访问令牌
+		self.DELETE("/tokens/:Id", api.RevokeAccessToken) // 撤销访问令牌
+	}
+	{
+		self.GET("/identities", api.GetIdentities)           // 已绑定的第三方账号
+		self.POST("/identities/:provider", api.LinkOidc)     // 绑定第三方账号，返回授权地址
+		self.DELETE("/identities/:provider", api.UnlinkOidc) // 解绑第三方账号
+	}
+	{
+		self.DELETE("/search/history", api.ClearSearchHistory) // 清除搜索历史，带q时只删一条
+	}
+	read := protected.Group("", middleware.RequireScope(model.ScopeRead))
+	{
+		read.GET("/profile", api.GetProfile)                    // 获取个人信息
+		read.GET("/users/:Id", api.GetUserProfile)              // 查看指定用户主页
+		read.GET("/posts", api.GetPostList)                     // 论坛主页/帖子列表
+		read.GET("/posts/recommended", api.GetRecommendedPosts) // 为你推荐
+		read.GET("/posts/:postId", api.GetPostDetail)           // 文章详情
+		read.GET("/posts/:postId/related", api.GetRelatedPosts) // 相关帖子
+		read.GET("/search", api.SearchPosts)                    // 搜索帖子
+		read.GET("/search/suggest", api.Suggest)                // 搜索联想
+		read.GET("/search/hot", api.GetHotSearches)             // 热搜榜
+		read.GET("/search/history", api.GetSearchHistory)       // 我的搜索历史
+		read.GET("/hot_rank", api.GetHotRank)                   // 热度榜单
+		read.GET("/creators/popular", api.GetPopularCreators)   // 热门作者
+		read.GET("/following", api.GetFollowings)               // 我的关注列表
+		read.GET("/follow", api.GetFollowers)                   // 我的粉丝列表
+		read.GET("/following_post", api.GetFollowingPost)       // 关注人的动态
+		read.GET("/notices", api.GetNotice)                     // 获取通知
+		read.GET("/announcements", api.GetAnnouncements)        // 查看生效中的公告
+		read.GET("/ai/quota", api.GetAIQuota)                   // 我的AI剩余次数
+	}
+	post := protected.Group("", middleware.RequireScope(model.ScopePost))
+	{
+		post.POST("/posts/:postId/summary", api.AiSummary)                                                     //总结文章（VIP专属）
+		post.GET("/posts/:postId/summary/stream", api.AiSummaryStream)                                         // 流式总结文章（SSE）
+		post.POST("/upload", api.UploadImage)                                                                  // 上传文章图片
+		post.POST("/posts", middleware.RateLimitingMiddleware("createPost", 5*time.Second, 1), api.CreatePost) // 发布帖子
+		post.DELETE("/posts/:postId", api.DeletePost)                                                          // 删除帖子
+	}
+	{
+		post.POST("/posts/:postId", middleware.RateLimitingMiddleware("createComment", 3*time.Second, 1), api.CreateComment) // 发表评论
+		post.DELETE("/posts/:postId/:posterId/:commentId", api.DeleteComment)                                                // 删除评论
+	}
+	{
+		post.POST("posts/:postId/like", middleware.RateLimitingMiddleware("like", 5*time.Second, 2), api.ToggleLike) //点赞
+		post.POST("/follow/:Id", api.Follow)                                                                         // 关注/取消关注用户
+		post.POST("/reports", middleware.IpRateLimitingMiddleware("report", time.Minute, 10), api.CreateReport)      // 举报帖子/评论/用户/私信
+	}
+	message := protected.Group("", middleware.RequireScope(model.ScopeMessage))
+	{
+		message.GET("/websocket", ws.HandleWebSocket)
+		message.GET("/messages/:Id", api.GetHistoryMessage) // 获取历史消息
+	}
+	admin := protected.Group("", middleware.RequireScope(model.ScopeAdmin))
+	{
+		admin.POST("/muted/:Id", middleware.RequirePermission(model.PermUserMute), api.Muted)               // 禁言用户
+		admin.POST("/login-unlock", middleware.RequirePermission(model.PermUserUnlock), api.UnlockLogin)    // 解除登录锁定（管理员）
+		admin.POST("vip/:Id", middleware.RequirePermission(model.PermVipGrant), api.SetVip)                 //设置vip用户
+		admin.POST("/paid-post/:postId", middleware.RequirePermission(model.PermPostPaid), api.SetPostPaid) //设置需要花费文章
+	}
+	{
+		admin.POST("/users/:Id/sanctions", api.IssueSanction)                                   // 处罚用户（禁言/禁止发帖/封禁）
+		admin.DELETE("/sanctions/:Id", api.LiftSanction)                                        // 解除处罚
+		admin.GET("/appeals", middleware.RequirePermission(model.PermUserMute), api.GetAppeals) // 待处理申诉
+		admin.POST("/appeals/:Id", api.ReviewAppeal)                                            // 处理申诉
+	}
+	{
+		admin.GET("/reports", middleware.RequirePermission(model.PermReportReview), api.GetReportQueue) // 审核队列
+		admin.GET("/reports/:Type/:Id", api.GetReports)                                                 // 某个内容的举报详情
+		admin.POST("/reports/:Type/:Id", api.HandleReport)                                              // 处理举报
+	}
+	{
+		admin.GET("/pending-posts", middleware.RequirePermission(model.PermPostReview), api.GetPendingPosts) // 待审核帖子
+		admin.POST("/pending-posts/:postId", api.ReviewPost)                                                 // 审核帖子
+	}
 	{
-		protected.GET("/profile", api.GetProfile)                                                                                     // 获取个人信息
-		protected.PATCH("/username", api.ChangeUserName)                                                                              // 修改用户名
-		protected.POST("/avatar", api.ChangeAvatar)                                                                                   // 修改头像
-		protected.PATCH("/introduction", api.ChangeIntroduction)                                                                      // 修改简介
-		protected.POST("/logout", api.Logout)                                                                                         // 退出登录
-		protected.DELETE("/delete-user", api.DeleteUser)                                                                              // 注销账户
-		protected.POST("/password-change", middleware.RateLimitingMiddleware("changePassword", 5*time.Second, 1), api.ChangePassword) // 修改密码
-		protected.GET("/users/:Id", api.GetUserProfile)                                                                               // 查看指定用户主页
-		protected.POST("/muted/:Id", api.Muted)                                                                                       // 禁言用户
-		protected.POST("vip/:Id", api.SetVip)                                                                                         //设置vip用户
+		admin.GET("/sensitive-words", api.GetSensitiveWords)          // 敏感词列表
+		admin.POST("/sensitive-words", api.AddSensitiveWord)          // 添加敏感词
+		admin.PUT("/sensitive-words/:Id", api.UpdateSensitiveWord)    // 修改处理方式
+		admin.DELETE("/sensitive-words/:Id", api.DeleteSensitiveWord) // 删除敏感词
 	}
 	{
-		protected.GET("/posts", api.GetPostList)                                                                    // 论坛主页/帖子列表
-		protected.POST("/posts/:postId/summary", api.AiSummary)                                                     //总结文章（VIP专属）
-		protected.GET("/posts/:postId", api.GetPostDetail)                                                          // 文章详情
-		protected.GET("/search", api.SearchPosts)                                                                   // 搜索帖子
-		protected.POST("/upload", api.UploadImage)                                                                  // 上传文章图片
-		protected.GET("/hot_rank", api.GetHotRank)                                                                  // 热度榜单
-		protected.POST("/posts", middleware.RateLimitingMiddleware("createPost", 5*time.Second, 1), api.CreatePost) // 发布帖子
-		protected.DELETE("/posts/:postId", api.DeletePost)                                                          // 删除帖子
-		protected.POST("/paid-post/:postId", api.SetPostPaid)                                                       //设置需要花费文章
+		admin.GET("/audit-logs", middleware.RequirePermission(model.PermAuditView), api.GetAuditLogs)           // 审计日志
+		admin.GET("/audit-logs/export", middleware.RequirePermission(model.PermAuditView), api.ExportAuditLogs) // 导出审计日志CSV
 	}
 	{
-		protected.POST("/posts/:postId", middleware.RateLimitingMiddleware("createComment", 3*time.Second, 1), api.CreateComment) // 发表评论
-		protected.DELETE("/posts/:postId/:posterId/:commentId", api.DeleteComment)                                                // 删除评论
+		admin.GET("/roles", middleware.RequirePermission(model.PermRoleAssign), api.GetRoles)                           // 角色权限矩阵
+		admin.PUT("/roles/:Id/permissions", middleware.RequirePermission(model.PermRoleAssign), api.SetRolePermissions) // 修改角色权限
+		admin.POST("/users/:Id/role", middleware.RequirePermission(model.PermRoleAssign), api.SetUserRole)              // 修改用户角色
 	}
 	{
-		protected.POST("posts/:postId/like", middleware.RateLimitingMiddleware("like", 5*time.Second, 2), api.ToggleLike) //点赞
-		protected.POST("/follow/:Id", api.Follow)                                                                         // 关注/取消关注用户
-		protected.GET("/following", api.GetFollowings)                                                                    // 我的关注列表
-		protected.GET("/follow", api.GetFollowers)                                                                        // 我的粉丝列表
-		protected.GET("/following_post", api.GetFollowingPost)                                                            // 关注人的动态
+		admin.POST("/announcements", middleware.RequirePermission(model.PermAnnouncement), api.CreateAnnouncement)       // 发布公告（管理员）
+		admin.DELETE("/announcements/:Id", middleware.RequirePermission(model.PermAnnouncement), api.CancelAnnouncement) // 撤回公告（管理员）
 	}
 	{
-		protected.GET("/websocket", ws.HandleWebSocket)
-		protected.GET("/messages/:Id", api.GetHistoryMessage) // 获取历史消息
-		protected.GET("/notices", api.GetNotice)              // 获取通知
+		admin.GET("/ai/usage", middleware.RequirePermission(model.PermAIUsage), api.GetAIUsageReport) // AI用量报表
 	}
 
 	r.Run(":8080")
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// EncodeCursor 游标对客户端是不透明的，只保证原样传回
+func EncodeCursor(t time.Time, id uint) string {
+	raw := fmt.Sprintf("%d_%d", t.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (time.Time, uint, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	var nano int64
+	var id uint
+	if _, err = fmt.Sscanf(string(raw), "%d_%d", &nano, &id); err != nil || id == 0 {
+		return time.Time{}, 0, false
+	}
+	return time.Unix(0, nano), id, true
+}
@@ -2,7 +2,13 @@ package utils
 
 import (
 	"commmunity/app/zlog"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/rand"
 	"strings"
 	"time"
@@ -17,19 +23,24 @@ var jwtKey = viper.GetString("jwtKey")
 var jwtRefreshKey = viper.GetString("jwtRefreshKey")
 
 type MyClaims struct {
-	Account string `json:"account"`
-	Role    int    `json:"role"`
-	UserId  uint   `json:"userId"`
-	Type    string `json:"type"`
+	Account     string `json:"account"`
+	Role        int    `json:"role"`
+	UserId      uint   `json:"userId"`
+	Type        string `json:"type"`
+	SessionId   uint   `json:"sid"`
+	RoleVersion int    `json:"rv"`
 	jwt.StandardClaims
 }
 
-func MakeToken(account string, userId uint, role int) (string, string, error) {
+// MakeToken refreshJti用于刷新时判断令牌是否已经被轮换过
+func MakeToken(account string, userId uint, role int, roleVersion int, sessionId uint, refreshJti string) (string, string, error) {
 	claim := &MyClaims{
-		Account: account,
-		Role:    role,
-		UserId:  userId,
-		Type:    "access",
+		Account:     account,
+		Role:        role,
+		UserId:      userId,
+		Type:        "access",
+		SessionId:   sessionId,
+		RoleVersion: roleVersion,
 		StandardClaims: jwt.StandardClaims{
 			NotBefore: time.Now().Add(-5 * time.Second).Unix(),
 			ExpiresAt: time.Now().Add(15 * time.Minute).Unix(),
@@ -43,11 +54,14 @@ func MakeToken(account string, userId uint, role int) (string, string, error) {
 		return "", "", err
 	}
 	newClaim := &MyClaims{
-		Account: account,
-		Role:    role,
-		UserId:  userId,
-		Type:    "refresh",
+		Account:     account,
+		Role:        role,
+		UserId:      userId,
+		Type:        "refresh",
+		SessionId:   sessionId,
+		RoleVersion: roleVersion,
 		StandardClaims: jwt.StandardClaims{
+			Id:        refreshJti,
 			NotBefore: time.Now().Add(-5 * time.Second).Unix(),
 			ExpiresAt: time.Now().Add(7 * 24 * time.Hour).Unix(),
 			Issuer:    "Tom",
@@ -120,3 +134,58 @@ func TruncateContent(content string, maxLines int, maxChars int) string {
 	resultBuilder.WriteString("\n\n> 🔒 **剩余内容为付费会员专享，请升级后查看...**")
 	return resultBuilder.String()
 }
+
+// MakeOnceToken 生成带签名的随机令牌，签名可以在查redis之前先挡掉伪造的令牌
+func MakeOnceToken(purpose string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := crand.Read(b); err != nil {
+		zlog.Error("生成随机令牌失败", zap.Error(err))
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	return raw + "." + signOnceToken(purpose, raw), nil
+}
+
+func VerifyOnceToken(purpose string, token string) bool {
+	raw, sig, ok := strings.Cut(token, ".")
+	if !ok || raw == "" {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(signOnceToken(purpose, raw)))
+}
+
+// SignURL 给下载链接签名，过期时间一起参与签名
+func SignURL(path string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(viper.GetString("jwtKey")))
+	mac.Write([]byte(fmt.Sprintf("url:%s:%d", path, expires)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyURL(path string, expires int64, sig string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(SignURL(path, expires)))
+}
+
+func signOnceToken(purpose string, raw string) string {
+	mac := hmac.New(sha256.New, []byte(viper.GetString("jwtKey")))
+	mac.Write([]byte(purpose + ":" + raw))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// MakeAccessToken 生成个人访问令牌，明文只在创建时返回一次
+func MakeAccessToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := crand.Read(b); err != nil {
+		zlog.Error("生成访问令牌失败", zap.Error(err))
+		return "", err
+	}
+	return "pat_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAccessToken 令牌本身是高熵随机串，sha256就够了，不需要bcrypt
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}